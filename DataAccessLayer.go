@@ -1,36 +1,104 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
+	"log/slog"
+	"slices"
+	"time"
 )
 
 type Id string
 type Title string
 type Priority string
 type Complete bool
+type Tag string
+
+// Whoever a request is being made on behalf of. Items created before there
+// were users belong to AnonymousUser
+type User string
+
+const AnonymousUser User = ""
 
 type ToDoItem struct {
 	Id       `json:"id"`
 	Title    `json:"title"`
 	Priority `json:"priority"`
 	Complete `json:"complete"`
+	Owner    User   `json:"owner,omitempty"`
+	List     ListId `json:"list,omitempty"`
+	// When the item should be done by, in the timezone it was given in
+	Due *time.Time `json:"due,omitempty"`
+	// A set of labels, kept lower cased and sorted
+	Tags []Tag `json:"tags,omitempty"`
+	// Steps towards the item, in the order they should be done
+	Checklist []SubItem `json:"checklist,omitempty"`
+	// Items that must be complete before this one can be
+	BlockedBy []Id `json:"blocked_by,omitempty"`
+	// How often the item comes round again. Completing it makes the next
+	// occurrence, which shares its Series, the Id of the first. Occurrence
+	// counts them from 1. Both are set by the DAL
+	Recurrence `json:"recurrence,omitempty"`
+	Series     Id  `json:"series,omitempty"`
+	Occurrence int `json:"occurrence,omitempty"`
+	// Stamped by the DAL on every write, whatever the request says. Items
+	// written before these were kept have none of them
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	UpdatedBy   User       `json:"updated_by,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// Counts the writes to the item. Set it to the version last read to have
+	// Update and Delete fail with ErrConflict if someone has changed it since,
+	// or leave it 0 to write regardless
+	Version int `json:"version,omitempty"`
+}
+
+// Items are copied in and out of the stores that keep them in memory, so
+// callers can never share a slice with the store
+func (item ToDoItem) clone() ToDoItem {
+	item.Tags = slices.Clone(item.Tags)
+	item.Checklist = slices.Clone(item.Checklist)
+	item.BlockedBy = slices.Clone(item.BlockedBy)
+	return item
 }
 
+// Builds an item with a fresh Id, normalising its Priority. Whether it can be
+// stored is not checked, use NewToDoItem to find out
 func ConstructToDoItem(t Title, p Priority, c Complete) ToDoItem {
+	item, _ := NewToDoItem(t, p, c)
+	return item
+}
+
+// As ConstructToDoItem, but also returns a *ValidationError if the item
+// cannot be stored
+func NewToDoItem(t Title, p Priority, c Complete) (ToDoItem, error) {
 	return ToDoItem{
-		Id(uuid.NewString()),
-		t,
-		p,
-		c,
-	}
+		Id:       Id(uuid.NewString()),
+		Title:    t,
+		Priority: p,
+		Complete: c,
+	}.validate()
 }
 
 type DataStore interface {
-	create(item ToDoItem) error
-	read() []ToDoItem
-	update(item ToDoItem) error
-	delete(item ToDoItem) error
+	create(ctx context.Context, item ToDoItem) error
+	read(ctx context.Context) ([]ToDoItem, error)
+	// Only ever given a Query that has been through validate
+	query(ctx context.Context, q Query) (Page, error)
+	// Items with a word starting with each word of `text`, best matches first
+	search(ctx context.Context, text string) ([]ToDoItem, error)
+	get(ctx context.Context, id Id) (ToDoItem, error)
+	// Always given `item` at the version after the stored one
+	update(ctx context.Context, item ToDoItem) error
+	delete(ctx context.Context, item ToDoItem) error
+	createList(ctx context.Context, list List) error
+	readLists(ctx context.Context) ([]List, error)
+	getList(ctx context.Context, id ListId) (List, error)
+	updateList(ctx context.Context, list List) error
+	deleteList(ctx context.Context, id ListId) error
+	close() error
 }
 
 var ErrCannotCreate = errors.New("cannot create item as it already exists in datastore")
@@ -39,6 +107,25 @@ var ErrCannotDelete = errors.New("cannot delete item as it does not exist in dat
 var ErrCannotQuery = errors.New("cannot query, as item does not exist in datastore")
 var ErrUnknownAction = errors.New("unknown action")
 var ErrOverWritten = errors.New("item overwritten")
+var ErrClosed = errors.New("data access layer is closed")
+var ErrConflict = errors.New("item has been changed since the given version")
+var ErrForbidden = errors.New("your role on this list does not allow that")
+
+// Wraps a failure of whatever sits under a DataStore (file I/O, parsing, the
+// database, ...) so it can be told apart from the Err* values above, which are
+// down to the request itself
+type StorageError struct {
+	Op  string
+	Err error
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("datastore could not %s: %v", e.Op, e.Err)
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
 
 func toDoMapper(data []ToDoItem) (error, map[Id]ToDoItem) {
 	dataMap := make(map[Id]ToDoItem)
@@ -67,25 +154,73 @@ const (
 	Read
 	Update
 	Delete
+	Get
+	Close
+	View
+	Transact
 )
 
+func (a action) String() string {
+	switch a {
+	case Create:
+		return "create"
+	case Read:
+		return "read"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	case Get:
+		return "get"
+	case Close:
+		return "close"
+	case View:
+		return "view"
+	case Transact:
+		return "transact"
+	default:
+		return "unknown"
+	}
+}
+
 // Use for sending requests to DB
 //
 // Wait on `errorReturnChan` for errors, if nil is returned then action was successful
 // Wait on `dataReturnChan` if you anticipate data being returned
 //
-// Both channels with have 1 item of data sent down it and then get closed
+// Both channels with have 1 item of data sent down it. `ctx` is checked
+// before the request is acted on and is passed through to the DataStore
+//
+// View and Transact requests run `transaction` against the DataStore instead,
+// Views alongside other reads and Transacts with the DataStore to themselves
 type dbRequest struct {
+	ctx  context.Context
+	user User
 	action
 	ToDoItem
 	errorReturnChan chan error
 	dataReturnChan  chan []ToDoItem
+	transaction     func(ctx context.Context, db DataStore) error
 }
 
+// How a DataAccessLayer treats the items it writes
+type DALOptions struct {
+	// Complete an item when the last step of its checklist is completed, and
+	// reopen it when a step is reopened
+	AutoCompleteChecklists bool
+}
+
+var defaultDALOptions = DALOptions{AutoCompleteChecklists: true}
+
 func NewDataAccessLayer(db DataStore) DataAccessLayer {
+	return NewDataAccessLayerWithOptions(db, defaultDALOptions)
+}
+
+func NewDataAccessLayerWithOptions(db DataStore, options DALOptions) DataAccessLayer {
 	dal := DataAccessLayer{
 		db,
 		make(chan dbRequest),
+		options,
 	}
 	go dal.act()
 	return dal
@@ -99,94 +234,406 @@ func NewEmptyDAL() DataAccessLayer {
 type DataAccessLayer struct {
 	db       DataStore
 	requests chan dbRequest
+	options  DALOptions
 }
 
-func (d DataAccessLayer) Create(item ToDoItem) error {
-	errChan := make(chan error)
-	dataChan := make(chan []ToDoItem)
-	d.requests <- dbRequest{
-		Create,
+// Hands a request to `act` and waits for the outcome, giving up with the
+// context's error if it is cancelled or its deadline passes first. The return
+// channels are buffered so `act` never blocks on a request nobody is waiting for
+func (d DataAccessLayer) submit(ctx context.Context, user User, a action, item ToDoItem) ([]ToDoItem, error) {
+	request := dbRequest{
+		ctx,
+		user,
+		a,
 		item,
-		errChan,
-		dataChan,
+		make(chan error, 1),
+		make(chan []ToDoItem, 1),
+		nil,
 	}
-	err := <-errChan
-	close(errChan)
-	<-dataChan
-	close(dataChan)
-	return err
+	return d.send(request)
 }
 
-func (d DataAccessLayer) Update(item ToDoItem) error {
-	errChan := make(chan error)
-	dataChan := make(chan []ToDoItem)
-	d.requests <- dbRequest{
-		Update,
-		item,
-		errChan,
-		dataChan,
+// Runs `transaction` inside `act` so nothing else touches the DataStore part
+// way through. Anything it needs to hand back should be captured by the
+// closure, which is safe to read once transact has returned without error
+func (d DataAccessLayer) transact(ctx context.Context, readOnly bool, transaction func(ctx context.Context, db DataStore) error) error {
+	a := Transact
+	if readOnly {
+		a = View
 	}
-	err := <-errChan
-	close(errChan)
-	<-dataChan
-	close(dataChan)
+	request := dbRequest{
+		ctx,
+		AnonymousUser,
+		a,
+		ToDoItem{},
+		make(chan error, 1),
+		make(chan []ToDoItem, 1),
+		transaction,
+	}
+	_, err := d.send(request)
 	return err
 }
 
-func (d DataAccessLayer) Delete(item ToDoItem) error {
-	errChan := make(chan error)
-	dataChan := make(chan []ToDoItem)
-	d.requests <- dbRequest{
-		Delete,
-		item,
-		errChan,
-		dataChan,
+func (d DataAccessLayer) send(request dbRequest) ([]ToDoItem, error) {
+	ctx, a := request.ctx, request.action
+	select {
+	case d.requests <- request:
+	case <-ctx.Done():
+		slog.WarnContext(ctx, "gave up submitting request", "action", a, "err", ctx.Err())
+		return nil, ctx.Err()
+	}
+	select {
+	case err := <-request.errorReturnChan:
+		return <-request.dataReturnChan, err
+	case <-ctx.Done():
+		slog.WarnContext(ctx, "gave up waiting on request", "action", a, "err", ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+// The item is created by `user`, whatever its Owner says. Items in a shared
+// List can be created by its editors and owners. Fails with a
+// *ValidationError if the item cannot be stored. Returns the item as it was
+// stored
+func (d DataAccessLayer) Create(ctx context.Context, user User, item ToDoItem) (ToDoItem, error) {
+	item, err := item.validate()
+	if err != nil {
+		return ToDoItem{}, err
+	}
+	return d.submitOne(ctx, user, Create, item)
+}
+
+// Only items `user` can see can be updated, other users' items are treated
+// as if they do not exist. Items in a shared List can only be updated by its
+// editors and owners. Items never change List or Owner. Fails with a
+// *ValidationError if the item cannot be stored, ErrConflict if its Version
+// is stale, ErrDependencyCycle if it would end up blocked by itself or
+// ErrBlocked if it is completed while its blockers are open and `ctx` is not
+// forced. Completing a recurring item creates its next occurrence. Returns
+// the item as it was stored
+func (d DataAccessLayer) Update(ctx context.Context, user User, item ToDoItem) (ToDoItem, error) {
+	item, err := item.validate()
+	if err != nil {
+		return ToDoItem{}, err
+	}
+	return d.submitOne(ctx, user, Update, item)
+}
+
+// Applies `change` to the stored item atomically, so changes made at the same
+// time to other fields are never lost. Checks the same as Update, with
+// `version` 0 applying the change whatever the item's Version. `change` must
+// not keep hold of the item, and cannot change its Id or Version
+func (d DataAccessLayer) Patch(ctx context.Context, user User, id Id, version int, change func(item *ToDoItem) error) (ToDoItem, error) {
+	var patched ToDoItem
+	err := d.transact(ctx, false, func(ctx context.Context, db DataStore) error {
+		existing, err := d.writable(ctx, user, id, version, ErrCannotUpdate)
+		if err != nil {
+			return err
+		}
+		if patched, err = d.patch(ctx, user, existing, change); err != nil {
+			return err
+		}
+		return d.replace(ctx, user, patched, existing)
+	})
+	if err != nil {
+		return ToDoItem{}, err
+	}
+	return patched, nil
+}
+
+// Returns `existing` with `change` applied, ready to be written over it, for
+// Patch and EditSeries
+func (d *DataAccessLayer) patch(ctx context.Context, user User, existing ToDoItem, change func(item *ToDoItem) error) (ToDoItem, error) {
+	item := existing.clone()
+	if err := change(&item); err != nil {
+		return ToDoItem{}, err
+	}
+	item.Id, item.Version = existing.Id, existing.Version
+	item, err := item.validate()
+	if err != nil {
+		return ToDoItem{}, err
+	}
+	if item, err = d.settle(ctx, user, item, &existing); err != nil {
+		return ToDoItem{}, err
+	}
+	return replacing(item, existing, user), nil
+}
+
+// Writes `item` over `existing`, making its next occurrence first if it is
+// being completed. If the item cannot be written the occurrence is removed
+// again, so neither is kept without the other
+func (d *DataAccessLayer) replace(ctx context.Context, user User, item ToDoItem, existing ToDoItem) error {
+	next, made, err := d.recur(ctx, user, item, existing)
+	if err != nil {
+		return err
+	}
+	err = d.db.update(ctx, item)
+	if err != nil && made {
+		if undo := d.db.delete(ctx, next); undo != nil {
+			slog.ErrorContext(ctx, "could not remove occurrence", "id", next.Id, "err", undo)
+		}
 	}
-	err := <-errChan
-	close(errChan)
-	<-dataChan
-	close(dataChan)
 	return err
 }
 
-func (d DataAccessLayer) Read() []ToDoItem {
-	errChan := make(chan error)
-	dataChan := make(chan []ToDoItem)
-	d.requests <- dbRequest{
-		Read,
-		ToDoItem{},
-		errChan,
-		dataChan,
+// Only items `user` can see can be deleted, other users' items are treated
+// as if they do not exist. Items in a shared List can only be deleted by its
+// editors and owners. Fails with ErrConflict if the item's Version is stale
+func (d DataAccessLayer) Delete(ctx context.Context, user User, item ToDoItem) error {
+	_, err := d.submit(ctx, user, Delete, item)
+	return err
+}
+
+// Returns the items in `list`, which `user` must be able to view. The empty
+// ListId is the user's own personal list
+func (d DataAccessLayer) Read(ctx context.Context, user User, list ListId) ([]ToDoItem, error) {
+	return d.submit(ctx, user, Read, ToDoItem{List: list})
+}
+
+// Returns ErrCannotQuery if no item with the given Id can be seen by `user`
+func (d DataAccessLayer) Get(ctx context.Context, user User, id Id) (ToDoItem, error) {
+	return d.submitOne(ctx, user, Get, ToDoItem{Id: id})
+}
+
+// For actions that answer with a single item
+func (d DataAccessLayer) submitOne(ctx context.Context, user User, a action, item ToDoItem) (ToDoItem, error) {
+	data, err := d.submit(ctx, user, a, item)
+	if err != nil {
+		return ToDoItem{}, err
 	}
-	<-errChan
-	close(errChan)
-	data := <-dataChan
-	close(dataChan)
-	return data
+	return data[0], nil
+}
+
+// Waits for in flight requests, closes the DataStore (flushing anything it
+// has buffered) and fails every later request with ErrClosed
+func (d DataAccessLayer) Close(ctx context.Context) error {
+	_, err := d.submit(ctx, AnonymousUser, Close, ToDoItem{})
+	return err
 }
 
 func (request *dbRequest) complete(err error, data []ToDoItem) {
+	if err != nil {
+		slog.DebugContext(request.ctx, "request failed", "action", request.action, "err", err)
+	}
 	request.errorReturnChan <- err
 	request.dataReturnChan <- data
 }
 
+func (a action) isRead() bool {
+	return a == Read || a == Get || a == View
+}
+
+// Reads are handed off to their own goroutine so they can run concurrently,
+// writes are only acted on once every in flight read has reported back on
+// `readDone`, so they always have the DataStore to themselves
 func (d *DataAccessLayer) act() {
-	for request := range d.requests {
-		switch request.action {
-		case Create:
-			err := d.db.create(request.ToDoItem)
-			request.complete(err, []ToDoItem{})
-		case Update:
-			err := d.db.update(request.ToDoItem)
-			request.complete(err, []ToDoItem{})
-		case Delete:
-			err := d.db.delete(request.ToDoItem)
-			request.complete(err, []ToDoItem{})
-		case Read:
-			data := d.db.read()
-			request.complete(nil, data)
-		default:
-			request.complete(ErrUnknownAction, []ToDoItem{})
+	readDone := make(chan struct{})
+	activeReads := 0
+	closed := false
+	waitForReads := func() {
+		for ; activeReads > 0; activeReads-- {
+			<-readDone
+		}
+	}
+	for {
+		select {
+		case <-readDone:
+			activeReads--
+		case request, open := <-d.requests:
+			if !open {
+				waitForReads()
+				return
+			}
+			slog.DebugContext(request.ctx, "acting on request", "action", request.action, "id", request.ToDoItem.Id)
+			if err := request.ctx.Err(); err != nil {
+				request.complete(err, []ToDoItem{})
+				continue
+			}
+			if closed {
+				request.complete(ErrClosed, []ToDoItem{})
+				continue
+			}
+			if request.action.isRead() {
+				activeReads++
+				go func() {
+					d.actOnRead(request)
+					readDone <- struct{}{}
+				}()
+				continue
+			}
+			waitForReads()
+			if err := request.ctx.Err(); err != nil {
+				request.complete(err, []ToDoItem{})
+				continue
+			}
+			d.actOnWrite(request)
+			closed = request.action == Close
+		}
+	}
+}
+
+func (d *DataAccessLayer) actOnRead(request dbRequest) {
+	switch request.action {
+	case Read:
+		data, err := d.readList(request.ctx, request.user, request.ToDoItem.List)
+		request.complete(err, data)
+	case Get:
+		item, err := d.db.get(request.ctx, request.ToDoItem.Id)
+		if err == nil {
+			err = d.authorise(request.ctx, request.user, item, RoleViewer, ErrCannotQuery)
+		}
+		if err != nil {
+			item = ToDoItem{}
+		}
+		request.complete(err, []ToDoItem{item})
+	case View:
+		err := request.transaction(request.ctx, d.db)
+		request.complete(err, []ToDoItem{})
+	}
+}
+
+func (d *DataAccessLayer) readList(ctx context.Context, user User, list ListId) ([]ToDoItem, error) {
+	q, _ := Query{List: list}.validate()
+	page, err := d.query(ctx, user, q)
+	return page.Items, err
+}
+
+// Fails with `notFound` if `user` cannot see `item` at all, or ErrForbidden
+// if they can but their role is below `min`. Personal items can only be seen
+// by whoever created them
+func (d *DataAccessLayer) authorise(ctx context.Context, user User, item ToDoItem, min Role, notFound error) error {
+	if item.List == "" {
+		if item.Owner != user {
+			return notFound
+		}
+		return nil
+	}
+	_, err := d.listWithRole(ctx, user, item.List, min)
+	if errors.Is(err, ErrNoList) {
+		return notFound
+	}
+	return err
+}
+
+// Fetches the List `user` wants to act on, failing with ErrNoList if they
+// are not a member or ErrForbidden if their role is below `min`
+func (d *DataAccessLayer) listWithRole(ctx context.Context, user User, id ListId, min Role) (List, error) {
+	list, err := d.db.getList(ctx, id)
+	if err != nil {
+		return List{}, err
+	}
+	role, member := list.Members[user]
+	if !member {
+		return List{}, ErrNoList
+	}
+	if !role.atLeast(min) {
+		return List{}, ErrForbidden
+	}
+	return list, nil
+}
+
+// Fetches the stored item `user` wants to change, failing with `notFound` if
+// they cannot see it or ErrConflict if `version` is set and stale
+func (d *DataAccessLayer) writable(ctx context.Context, user User, id Id, version int, notFound error) (ToDoItem, error) {
+	existing, err := d.db.get(ctx, id)
+	if errors.Is(err, ErrCannotQuery) {
+		return ToDoItem{}, notFound
+	}
+	if err != nil {
+		return ToDoItem{}, err
+	}
+	if err = d.authorise(ctx, user, existing, RoleEditor, notFound); err != nil {
+		return ToDoItem{}, err
+	}
+	if version != 0 && version != existing.Version {
+		return ToDoItem{}, ErrConflict
+	}
+	return existing, nil
+}
+
+// Items stay in the List they were created in and keep whoever created them,
+// whatever the request says. Returns `item` as it should be written over
+// `existing`
+func replacing(item ToDoItem, existing ToDoItem, user User) ToDoItem {
+	item.Owner = existing.Owner
+	item.List = existing.List
+	return stamp(item, &existing, user, stampTime())
+}
+
+// Checks `user` may change the stored item the request is for. Returns the
+// stored item
+func (d *DataAccessLayer) checkWrite(request dbRequest, notFound error) (ToDoItem, error) {
+	item := request.ToDoItem
+	return d.writable(request.ctx, request.user, item.Id, item.Version, notFound)
+}
+
+// Times are kept in UTC to the microsecond, which every store can hold
+func stampTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// Sets the times and user the DAL keeps on `item`, carrying over what should
+// not change from `existing`, which is nil for a new item
+func stamp(item ToDoItem, existing *ToDoItem, user User, now time.Time) ToDoItem {
+	item.CreatedAt = &now
+	item.CompletedAt = nil
+	item.Version = 1
+	if existing != nil {
+		item.CreatedAt = existing.CreatedAt
+		item.Version = existing.Version + 1
+		if existing.Complete && item.Complete {
+			item.CompletedAt = existing.CompletedAt
+		}
+	}
+	if item.Complete && item.CompletedAt == nil {
+		item.CompletedAt = &now
+	}
+	item.UpdatedAt = &now
+	item.UpdatedBy = user
+	return item
+}
+
+func (d *DataAccessLayer) actOnWrite(request dbRequest) {
+	switch request.action {
+	case Create:
+		item := request.ToDoItem
+		item.Owner = request.user
+		var err error
+		if item.List != "" {
+			_, err = d.listWithRole(request.ctx, request.user, item.List, RoleEditor)
+		}
+		if err == nil {
+			item, err = d.settle(request.ctx, request.user, item, nil)
+		}
+		if err == nil {
+			item = stamp(item, nil, request.user, stampTime())
+			err = d.db.create(request.ctx, item)
+		}
+		request.complete(err, []ToDoItem{item})
+	case Update:
+		existing, err := d.checkWrite(request, ErrCannotUpdate)
+		item := request.ToDoItem
+		if err == nil {
+			item, err = d.settle(request.ctx, request.user, item, &existing)
+		}
+		if err == nil {
+			item = replacing(item, existing, request.user)
+			err = d.replace(request.ctx, request.user, item, existing)
+		}
+		request.complete(err, []ToDoItem{item})
+	case Delete:
+		item, err := d.checkWrite(request, ErrCannotDelete)
+		if err == nil {
+			err = d.db.delete(request.ctx, item)
 		}
+		request.complete(err, []ToDoItem{})
+	case Transact:
+		err := request.transaction(request.ctx, d.db)
+		request.complete(err, []ToDoItem{})
+	case Close:
+		err := d.db.close()
+		request.complete(err, []ToDoItem{})
+	default:
+		request.complete(ErrUnknownAction, []ToDoItem{})
 	}
 }
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestChannelCreate(t *testing.T) {
@@ -19,23 +25,26 @@ func TestChannelCreate(t *testing.T) {
 		if err != nil {
 			t.Fatalf("setup failed! -> %v", err)
 		}
-		want := NewDataAccessLayer(&inMemoryDataStore{data})
+		want := NewDataAccessLayer(&inMemoryDataStore{data: data})
 
 		db := newEmptyInMemoryDataStore()
 		dal := NewDataAccessLayer(&db)
 		dal.requests <- dbRequest{
+			context.Background(),
+			AnonymousUser,
 			Create,
 			item,
 			errChan,
 			dataChan,
+			nil,
 		}
 
 		err = <-errChan
 		if err != nil {
 			t.Errorf("Unexpected error thrown! %v", err)
 		}
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), unstamped(readAll(t, dal.db))) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 	t.Run("Add existing value to store", func(t *testing.T) {
@@ -51,24 +60,27 @@ func TestChannelCreate(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{data}
+		db2 := inMemoryDataStore{data: data}
 		dal := NewDataAccessLayer(&db2)
 		dal.requests <- dbRequest{
+			context.Background(),
+			AnonymousUser,
 			Create,
 			item,
 			errChan,
 			dataChan,
+			nil,
 		}
 
 		err := <-errChan
 		if err != ErrCannotCreate {
 			t.Errorf("Unexpected error thrown! got %v want %v", err, ErrCannotCreate)
 		}
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), readAll(t, dal.db)) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 }
@@ -85,18 +97,18 @@ func TestAPICreate(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{make(map[Id]ToDoItem)}
+		db2 := inMemoryDataStore{data: make(map[Id]ToDoItem)}
 		dal := NewDataAccessLayer(&db2)
-		err := dal.Create(item)
+		_, err := dal.Create(context.Background(), AnonymousUser, item)
 
 		if err != nil {
 			t.Errorf("Unexpected error! -> %v", err)
 		}
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), unstamped(readAll(t, dal.db))) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 	t.Run("Add existing value to store", func(t *testing.T) {
@@ -111,20 +123,20 @@ func TestAPICreate(t *testing.T) {
 		if err != nil {
 			t.Fatalf("setup failed! -> %v", err)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{make(map[Id]ToDoItem)}
+		db2 := inMemoryDataStore{data: make(map[Id]ToDoItem)}
 		dal := NewDataAccessLayer(&db2)
-		dal.Create(item)
-		err = dal.Create(item)
+		dal.Create(context.Background(), AnonymousUser, item)
+		_, err = dal.Create(context.Background(), AnonymousUser, item)
 
 		if err != ErrCannotCreate {
 			t.Fatal("Error not thrown")
 		}
 
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), unstamped(readAll(t, dal.db))) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 }
@@ -132,7 +144,7 @@ func BenchmarkAPICreateConcurrency(t *testing.B) {
 	db := newEmptyInMemoryDataStore()
 	dal := NewDataAccessLayer(&db)
 	title := Title("Something")
-	priority := Priority("something else")
+	priority := Priority("High")
 	expectedNumItems := t.N
 	finChan := make(chan struct{})
 	for i := 0; i < expectedNumItems; i++ {
@@ -142,7 +154,9 @@ func BenchmarkAPICreateConcurrency(t *testing.B) {
 				priority,
 				false,
 			)
-			dal.Create(item)
+			if _, err := dal.Create(context.Background(), AnonymousUser, item); err != nil {
+				t.Errorf("Unexpected error thrown! Got: %v", err)
+			}
 			fin <- struct{}{}
 		}(dal, finChan)
 	}
@@ -150,8 +164,8 @@ func BenchmarkAPICreateConcurrency(t *testing.B) {
 		<-finChan
 	}
 
-	if len(dal.db.read()) != expectedNumItems {
-		t.Errorf("Incorrect number of items found in DB! got %v want %v", len(dal.db.read()), expectedNumItems)
+	if len(readAll(t, dal.db)) != expectedNumItems {
+		t.Errorf("Incorrect number of items found in DB! got %v want %v", len(readAll(t, dal.db)), expectedNumItems)
 	}
 }
 
@@ -169,25 +183,28 @@ func TestChannelUpdate(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{map[Id]ToDoItem{initialItem.Id: initialItem}}
+		db2 := inMemoryDataStore{data: map[Id]ToDoItem{initialItem.Id: initialItem}}
 		dal := NewDataAccessLayer(&db2)
 		errReturnChan := make(chan error)
 		dataReturnChan := make(chan []ToDoItem)
 		dal.requests <- dbRequest{
+			context.Background(),
+			AnonymousUser,
 			Update,
 			updateItem,
 			errReturnChan,
 			dataReturnChan,
+			nil,
 		}
 		err := <-errReturnChan
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), unstamped(readAll(t, dal.db))) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 	t.Run("Update non-existent item in store", func(t *testing.T) {
@@ -202,18 +219,21 @@ func TestChannelUpdate(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{make(map[Id]ToDoItem)}
+		db2 := inMemoryDataStore{data: make(map[Id]ToDoItem)}
 		dal := NewDataAccessLayer(&db2)
 		errReturnChan := make(chan error)
 		dataReturnChan := make(chan []ToDoItem)
 		dal.requests <- dbRequest{
+			context.Background(),
+			AnonymousUser,
 			Update,
 			item,
 			errReturnChan,
 			dataReturnChan,
+			nil,
 		}
 		err := <-errReturnChan
 
@@ -221,8 +241,8 @@ func TestChannelUpdate(t *testing.T) {
 			t.Fatal("Error not thrown")
 		}
 
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), readAll(t, dal.db)) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 }
@@ -241,18 +261,18 @@ func TestAPIUpdate(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{map[Id]ToDoItem{initialItem.Id: initialItem}}
+		db2 := inMemoryDataStore{data: map[Id]ToDoItem{initialItem.Id: initialItem}}
 		dal := NewDataAccessLayer(&db2)
-		err := dal.Update(updateItem)
+		_, err := dal.Update(context.Background(), AnonymousUser, updateItem)
 
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), unstamped(readAll(t, dal.db))) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 	t.Run("Update non-existent item in store", func(t *testing.T) {
@@ -267,19 +287,19 @@ func TestAPIUpdate(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{make(map[Id]ToDoItem)}
+		db2 := inMemoryDataStore{data: make(map[Id]ToDoItem)}
 		dal := NewDataAccessLayer(&db2)
-		err := dal.Update(item)
+		_, err := dal.Update(context.Background(), AnonymousUser, item)
 
 		if err != ErrCannotUpdate {
 			t.Fatal("Error not thrown")
 		}
 
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), readAll(t, dal.db)) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 }
@@ -294,18 +314,21 @@ func TestChannelDelete(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{map[Id]ToDoItem{item.Id: item}}
+		db2 := inMemoryDataStore{data: map[Id]ToDoItem{item.Id: item}}
 		dal := NewDataAccessLayer(&db2)
 		errReturnChan := make(chan error)
 		dataReturnChan := make(chan []ToDoItem)
 		dal.requests <- dbRequest{
+			context.Background(),
+			AnonymousUser,
 			Delete,
 			item,
 			errReturnChan,
 			dataReturnChan,
+			nil,
 		}
 		err := <-errReturnChan
 
@@ -313,8 +336,8 @@ func TestChannelDelete(t *testing.T) {
 			t.Errorf("Unexpected error thrown! Got: %v", err)
 		}
 
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), readAll(t, dal.db)) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 	t.Run("Deleting non-existent item", func(t *testing.T) {
@@ -327,18 +350,21 @@ func TestChannelDelete(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{make(map[Id]ToDoItem)}
+		db2 := inMemoryDataStore{data: make(map[Id]ToDoItem)}
 		dal := NewDataAccessLayer(&db2)
 		errReturnChan := make(chan error)
 		dataReturnChan := make(chan []ToDoItem)
 		dal.requests <- dbRequest{
+			context.Background(),
+			AnonymousUser,
 			Delete,
 			item,
 			errReturnChan,
 			dataReturnChan,
+			nil,
 		}
 		err := <-errReturnChan
 
@@ -346,8 +372,8 @@ func TestChannelDelete(t *testing.T) {
 			t.Fatal("Error not thrown")
 		}
 
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), readAll(t, dal.db)) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 }
@@ -362,19 +388,19 @@ func TestAPIDelete(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{map[Id]ToDoItem{item.Id: item}}
+		db2 := inMemoryDataStore{data: map[Id]ToDoItem{item.Id: item}}
 		dal := NewDataAccessLayer(&db2)
-		err := dal.Delete(item)
+		err := dal.Delete(context.Background(), AnonymousUser, item)
 
 		if err != nil {
 			t.Errorf("Unexpected error thrown! Got: %v", err)
 		}
 
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), readAll(t, dal.db)) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 	t.Run("Deleting non-existent item", func(t *testing.T) {
@@ -387,19 +413,19 @@ func TestAPIDelete(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		want := NewDataAccessLayer(&db)
 
-		db2 := inMemoryDataStore{make(map[Id]ToDoItem)}
+		db2 := inMemoryDataStore{data: make(map[Id]ToDoItem)}
 		dal := NewDataAccessLayer(&db2)
-		err := dal.Delete(item)
+		err := dal.Delete(context.Background(), AnonymousUser, item)
 
 		if err != ErrCannotDelete {
 			t.Fatal("Error not thrown")
 		}
 
-		if !equalSlicesNoOrder(want.db.read(), dal.db.read()) {
-			t.Errorf("want %v, got %v", want.db.read(), dal.db.read())
+		if !equalSlicesNoOrder(readAll(t, want.db), readAll(t, dal.db)) {
+			t.Errorf("want %v, got %v", readAll(t, want.db), readAll(t, dal.db))
 		}
 	})
 }
@@ -410,16 +436,19 @@ func TestChannelRead(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		dal := NewDataAccessLayer(&db)
 
 		errReturnChan := make(chan error)
 		dataReturnChan := make(chan []ToDoItem)
 		dbr := dbRequest{
+			context.Background(),
+			AnonymousUser,
 			Read,
 			ToDoItem{},
 			errReturnChan,
 			dataReturnChan,
+			nil,
 		}
 		dal.requests <- dbr
 		err := <-errReturnChan
@@ -443,13 +472,515 @@ func TestAPIRead(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		db := inMemoryDataStore{data}
+		db := inMemoryDataStore{data: data}
 		dal := NewDataAccessLayer(&db)
 
-		got := dal.Read()
+		got, err := dal.Read(context.Background(), AnonymousUser, "")
 
+		if err != nil {
+			t.Errorf("Unexpected error thrown! Got: %v", err)
+		}
 		if !equalSlicesNoOrder(items, got) {
 			t.Errorf("want %v, got %v", items, got)
 		}
 	})
 }
+func TestChannelGet(t *testing.T) {
+	t.Run("Getting item", func(t *testing.T) {
+		items := populatedToDoList()
+		dataErr, data := toDoMapper(items)
+		if dataErr != nil {
+			t.Fatalf("setup failed! -> %v", dataErr)
+		}
+		db := inMemoryDataStore{data: data}
+		dal := NewDataAccessLayer(&db)
+
+		errReturnChan := make(chan error)
+		dataReturnChan := make(chan []ToDoItem)
+		dal.requests <- dbRequest{
+			context.Background(),
+			AnonymousUser,
+			Get,
+			ToDoItem{Id: items[3].Id},
+			errReturnChan,
+			dataReturnChan,
+			nil,
+		}
+		err := <-errReturnChan
+		got := <-dataReturnChan
+
+		if err != nil {
+			t.Errorf("Unexpected error thrown! Got: %v", err)
+		}
+		if len(got) != 1 || !equalItems(got[0], items[3]) {
+			t.Errorf("want %v, got %v", items[3], got)
+		}
+	})
+}
+func TestAPIGet(t *testing.T) {
+	t.Run("Getting item", func(t *testing.T) {
+		items := populatedToDoList()
+		dataErr, data := toDoMapper(items)
+		if dataErr != nil {
+			t.Fatalf("setup failed! -> %v", dataErr)
+		}
+		db := inMemoryDataStore{data: data}
+		dal := NewDataAccessLayer(&db)
+
+		got, err := dal.Get(context.Background(), AnonymousUser, items[3].Id)
+
+		if err != nil {
+			t.Errorf("Unexpected error thrown! Got: %v", err)
+		}
+		if !equalItems(got, items[3]) {
+			t.Errorf("want %v, got %v", items[3], got)
+		}
+	})
+	t.Run("Getting non-existent item", func(t *testing.T) {
+		dal := NewEmptyDAL()
+
+		_, err := dal.Get(context.Background(), AnonymousUser, "Keep sanity")
+
+		if err != ErrCannotQuery {
+			t.Fatal("Error not thrown")
+		}
+	})
+}
+
+// Holds every read until the test releases it, reporting on `entered` as each
+// read gets inside the DataStore
+type heldReadDataStore struct {
+	inMemoryDataStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (d heldReadDataStore) read(ctx context.Context) ([]ToDoItem, error) {
+	d.entered <- struct{}{}
+	<-d.release
+	return d.inMemoryDataStore.read(ctx)
+}
+
+func (d heldReadDataStore) query(ctx context.Context, q Query) (Page, error) {
+	d.entered <- struct{}{}
+	<-d.release
+	return d.inMemoryDataStore.query(ctx, q)
+}
+
+func TestConcurrentReads(t *testing.T) {
+	t.Run("Reads are not serialised", func(t *testing.T) {
+		numReads := 10
+		db := heldReadDataStore{
+			newEmptyInMemoryDataStore(),
+			make(chan struct{}),
+			make(chan struct{}),
+		}
+		dal := NewDataAccessLayer(&db)
+		for i := 0; i < numReads; i++ {
+			go dal.Read(context.Background(), AnonymousUser, "")
+		}
+
+		for i := 0; i < numReads; i++ {
+			select {
+			case <-db.entered:
+			case <-time.After(time.Second):
+				t.Fatalf("only %d of %d reads ran concurrently", i, numReads)
+			}
+		}
+		close(db.release)
+	})
+	t.Run("Writes wait for in flight reads", func(t *testing.T) {
+		db := heldReadDataStore{
+			newEmptyInMemoryDataStore(),
+			make(chan struct{}),
+			make(chan struct{}),
+		}
+		dal := NewDataAccessLayer(&db)
+		go dal.Read(context.Background(), AnonymousUser, "")
+		<-db.entered
+
+		created := make(chan error)
+		go func() {
+			_, err := dal.Create(context.Background(), AnonymousUser, ConstructToDoItem("Keep sanity", "high", false))
+			created <- err
+		}()
+		select {
+		case <-created:
+			t.Fatal("write acted on while a read was in flight")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(db.release)
+		if err := <-created; err != nil {
+			t.Errorf("Unexpected error thrown! Got: %v", err)
+		}
+	})
+}
+
+func TestParallelReadsAndWrites(t *testing.T) {
+	numWriters := 100
+	dal := NewEmptyDAL()
+	t.Run("group", func(t *testing.T) {
+		for i := 0; i < numWriters; i++ {
+			t.Run(fmt.Sprintf("writer %d", i), func(t *testing.T) {
+				t.Parallel()
+				item := ConstructToDoItem(
+					Title(fmt.Sprintf("item %d", i)),
+					"high",
+					false,
+				)
+				if _, err := dal.Create(context.Background(), AnonymousUser, item); err != nil {
+					t.Fatalf("Unexpected error on create: %v", err)
+				}
+				item.Complete = true
+				item, err := dal.Update(context.Background(), AnonymousUser, item)
+				if err != nil {
+					t.Fatalf("Unexpected error on update: %v", err)
+				}
+				got, err := dal.Get(context.Background(), AnonymousUser, item.Id)
+				if err != nil {
+					t.Fatalf("Unexpected error on get: %v", err)
+				}
+				if !equalItems(got, item) {
+					t.Errorf("want %v, got %v", item, got)
+				}
+			})
+			t.Run(fmt.Sprintf("reader %d", i), func(t *testing.T) {
+				t.Parallel()
+				dal.Read(context.Background(), AnonymousUser, "")
+			})
+		}
+	})
+
+	items := readAll(t, dal.db)
+	if len(items) != numWriters {
+		t.Fatalf("Incorrect number of items found in DB! got %v want %v", len(items), numWriters)
+	}
+	for _, item := range items {
+		if !item.Complete {
+			t.Errorf("update lost for %v", item)
+		}
+	}
+}
+
+func TestUserIsolation(t *testing.T) {
+	users := []User{"alice", "bob"}
+	numItems := 50
+	dal := NewEmptyDAL()
+	t.Run("group", func(t *testing.T) {
+		for _, user := range users {
+			for i := 0; i < numItems; i++ {
+				t.Run(fmt.Sprintf("%s %d", user, i), func(t *testing.T) {
+					t.Parallel()
+					ctx := context.Background()
+					item := ConstructToDoItem(Title(fmt.Sprintf("%s %d", user, i)), "high", false)
+					if _, err := dal.Create(ctx, user, item); err != nil {
+						t.Fatalf("Unexpected error on create: %v", err)
+					}
+					items, err := dal.Read(ctx, user, "")
+					if err != nil {
+						t.Fatalf("Unexpected error on read: %v", err)
+					}
+					for _, got := range items {
+						if got.Owner != user {
+							t.Errorf("%s read %v", user, got)
+						}
+					}
+					for _, other := range users {
+						if other == user {
+							continue
+						}
+						if _, err := dal.Get(ctx, other, item.Id); err != ErrCannotQuery {
+							t.Errorf("%s got %s's item, err %v", other, user, err)
+						}
+						stolen := item
+						stolen.Title = "stolen"
+						if _, err := dal.Update(ctx, other, stolen); err != ErrCannotUpdate {
+							t.Errorf("%s updated %s's item, err %v", other, user, err)
+						}
+						if err := dal.Delete(ctx, other, item); err != ErrCannotDelete {
+							t.Errorf("%s deleted %s's item, err %v", other, user, err)
+						}
+					}
+				})
+			}
+		}
+	})
+
+	for _, user := range users {
+		items, err := dal.Read(context.Background(), user, "")
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if len(items) != numItems {
+			t.Errorf("%s has %d items, want %d", user, len(items), numItems)
+		}
+		for _, item := range items {
+			if item.Owner != user || item.Title == "stolen" {
+				t.Errorf("%s's list holds %v", user, item)
+			}
+		}
+	}
+	if items, _ := dal.Read(context.Background(), AnonymousUser, ""); len(items) != 0 {
+		t.Errorf("anonymous user can see %v", items)
+	}
+}
+
+func TestCreateSetsOwner(t *testing.T) {
+	dal := NewEmptyDAL()
+	item := ConstructToDoItem("Keep sanity", "high", false)
+	item.Owner = "mallory"
+
+	if _, err := dal.Create(context.Background(), "alice", item); err != nil {
+		t.Fatalf("Unexpected error thrown! Got: %v", err)
+	}
+
+	if _, err := dal.Get(context.Background(), "mallory", item.Id); err != ErrCannotQuery {
+		t.Errorf("item created for the owner it claimed, err %v", err)
+	}
+	got, err := dal.Get(context.Background(), "alice", item.Id)
+	if err != nil || got.Owner != "alice" {
+		t.Errorf("want owner alice, got %v, err %v", got, err)
+	}
+}
+
+func TestStamps(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	claimed := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	item := ConstructToDoItem("Keep sanity", "high", false)
+	item.CreatedAt, item.UpdatedAt, item.UpdatedBy, item.CompletedAt = &claimed, &claimed, "mallory", &claimed
+
+	created, err := dal.Create(ctx, "alice", item)
+	if err != nil {
+		t.Fatalf("Unexpected error thrown! Got: %v", err)
+	}
+
+	t.Run("Create stamps the item", func(t *testing.T) {
+		if created.CreatedAt == nil || created.CreatedAt.Equal(claimed) || created.UpdatedAt == nil || !created.UpdatedAt.Equal(*created.CreatedAt) {
+			t.Errorf("want created and updated now, got %v and %v", created.CreatedAt, created.UpdatedAt)
+		}
+		if created.UpdatedBy != "alice" || created.CompletedAt != nil {
+			t.Errorf("want updated by alice and not completed, got %v and %v", created.UpdatedBy, created.CompletedAt)
+		}
+		if got, _ := dal.Get(ctx, "alice", item.Id); !equalItems(got, created) {
+			t.Errorf("want %v, got %v", created, got)
+		}
+	})
+	t.Run("Completing keeps when it was created", func(t *testing.T) {
+		completing := created
+		completing.Complete = true
+		completing.CreatedAt = &claimed
+
+		got, err := dal.Update(ctx, "alice", completing)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if !got.CreatedAt.Equal(*created.CreatedAt) || got.CompletedAt == nil || got.UpdatedAt.Before(*created.UpdatedAt) {
+			t.Errorf("want created at %v and completed, got %v", created.CreatedAt, got)
+		}
+		again, _ := dal.Update(ctx, "alice", got)
+		if !again.CompletedAt.Equal(*got.CompletedAt) {
+			t.Errorf("completed time moved from %v to %v", got.CompletedAt, again.CompletedAt)
+		}
+	})
+	t.Run("Reopening clears when it was completed", func(t *testing.T) {
+		reopening, _ := dal.Get(ctx, "alice", item.Id)
+		reopening.Complete = false
+
+		got, err := dal.Update(ctx, "alice", reopening)
+
+		if err != nil || got.CompletedAt != nil {
+			t.Errorf("want no completed time, got %v %v", got.CompletedAt, err)
+		}
+	})
+}
+
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	first, _ := dal.Create(ctx, AnonymousUser, ConstructToDoItem("Keep sanity", "high", false))
+	if first.Version != 1 {
+		t.Fatalf("want version 1, got %v", first.Version)
+	}
+	second := first
+	second.Title = "Lose sanity"
+	second, err := dal.Update(ctx, AnonymousUser, second)
+	if err != nil || second.Version != 2 {
+		t.Fatalf("want version 2, got %v %v", second.Version, err)
+	}
+
+	t.Run("Stale updates conflict", func(t *testing.T) {
+		stale := first
+		stale.Complete = true
+
+		if _, err := dal.Update(ctx, AnonymousUser, stale); err != ErrConflict {
+			t.Errorf("want %v, got %v", ErrConflict, err)
+		}
+		if got, _ := dal.Get(ctx, AnonymousUser, first.Id); !equalItems(got, second) {
+			t.Errorf("want %v, got %v", second, got)
+		}
+	})
+	t.Run("Stale deletes conflict", func(t *testing.T) {
+		if err := dal.Delete(ctx, AnonymousUser, first); err != ErrConflict {
+			t.Errorf("want %v, got %v", ErrConflict, err)
+		}
+	})
+	t.Run("Version 0 writes regardless", func(t *testing.T) {
+		unversioned := second
+		unversioned.Version = 0
+
+		got, err := dal.Update(ctx, AnonymousUser, unversioned)
+
+		if err != nil || got.Version != 3 {
+			t.Errorf("want version 3, got %v %v", got.Version, err)
+		}
+	})
+}
+
+func TestPatch(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Concurrent patches to different fields are all kept", func(t *testing.T) {
+		dal := NewEmptyDAL()
+		item, _ := dal.Create(ctx, AnonymousUser, ConstructToDoItem("Keep sanity", "low", false))
+		changes := []func(item *ToDoItem) error{
+			func(item *ToDoItem) error { item.Title = "Lose sanity"; return nil },
+			func(item *ToDoItem) error { item.Priority = PriorityHigh; return nil },
+			func(item *ToDoItem) error { item.Complete = true; return nil },
+		}
+		var wg sync.WaitGroup
+		for _, change := range changes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := dal.Patch(ctx, AnonymousUser, item.Id, 0, change); err != nil {
+					t.Errorf("Unexpected error thrown! Got: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		got, _ := dal.Get(ctx, AnonymousUser, item.Id)
+		if got.Title != "Lose sanity" || got.Priority != PriorityHigh || !bool(got.Complete) || got.Version != 4 {
+			t.Errorf("want every change kept at version 4, got %v", got)
+		}
+	})
+	t.Run("Patches are checked like updates", func(t *testing.T) {
+		dal := NewEmptyDAL()
+		item, _ := dal.Create(ctx, "alice", ConstructToDoItem("Keep sanity", "low", false))
+		retitle := func(title Title) func(item *ToDoItem) error {
+			return func(item *ToDoItem) error { item.Title = title; return nil }
+		}
+
+		if _, err := dal.Patch(ctx, "mallory", item.Id, 0, retitle("Mine now")); err != ErrCannotUpdate {
+			t.Errorf("want %v, got %v", ErrCannotUpdate, err)
+		}
+		if _, err := dal.Patch(ctx, "alice", item.Id, 0, retitle(" ")); !errors.As(err, new(*ValidationError)) {
+			t.Errorf("want a ValidationError, got %v", err)
+		}
+		if _, err := dal.Patch(ctx, "alice", item.Id, 2, retitle("Lose sanity")); err != ErrConflict {
+			t.Errorf("want %v, got %v", ErrConflict, err)
+		}
+		if got, _ := dal.Get(ctx, "alice", item.Id); !equalItems(got, item) {
+			t.Errorf("want %v untouched, got %v", item, got)
+		}
+	})
+	t.Run("The DAL's fields cannot be patched", func(t *testing.T) {
+		dal := NewEmptyDAL()
+		item, _ := dal.Create(ctx, "alice", ConstructToDoItem("Keep sanity", "low", false))
+
+		got, err := dal.Patch(ctx, "alice", item.Id, 0, func(patched *ToDoItem) error {
+			patched.Id, patched.Owner, patched.Version, patched.CreatedAt = "other", "mallory", 9, nil
+			return nil
+		})
+
+		if err != nil || got.Id != item.Id || got.Owner != "alice" || got.Version != 2 || !got.CreatedAt.Equal(*item.CreatedAt) {
+			t.Errorf("want only the stamps moved on, got %v %v", got, err)
+		}
+	})
+}
+
+// Holds every create until the test releases it
+type hungDataStore struct {
+	inMemoryDataStore
+	release chan struct{}
+}
+
+func (d *hungDataStore) create(ctx context.Context, item ToDoItem) error {
+	<-d.release
+	return d.inMemoryDataStore.create(ctx, item)
+}
+
+func TestContextCancellation(t *testing.T) {
+	t.Run("Cancelled requests are not acted on", func(t *testing.T) {
+		dal := NewEmptyDAL()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := dal.Create(ctx, AnonymousUser, ConstructToDoItem("Keep sanity", "high", false))
+
+		if err != context.Canceled {
+			t.Errorf("want %v, got %v", context.Canceled, err)
+		}
+		if got := readAll(t, dal.db); len(got) != 0 {
+			t.Errorf("item was created, got %v", got)
+		}
+	})
+	t.Run("Deadline passes on a hung datastore", func(t *testing.T) {
+		db := hungDataStore{newEmptyInMemoryDataStore(), make(chan struct{})}
+		dal := NewDataAccessLayer(&db)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := dal.Create(ctx, AnonymousUser, ConstructToDoItem("Keep sanity", "high", false))
+
+		if err != context.DeadlineExceeded {
+			t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+		}
+		close(db.release)
+		if _, err := dal.Read(context.Background(), AnonymousUser, ""); err != nil {
+			t.Errorf("DAL did not recover after hung request: %v", err)
+		}
+	})
+}
+
+func TestClose(t *testing.T) {
+	t.Run("Requests after close are refused", func(t *testing.T) {
+		dal := NewEmptyDAL()
+
+		if err := dal.Close(context.Background()); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		_, err := dal.Create(context.Background(), AnonymousUser, ConstructToDoItem("Keep sanity", "high", false))
+
+		if err != ErrClosed {
+			t.Errorf("want %v, got %v", ErrClosed, err)
+		}
+	})
+	t.Run("Buffered writes are flushed", func(t *testing.T) {
+		db, err := newJSONDataStore(filepath.Join(t.TempDir(), "data.json"), 0, time.Hour)
+		if err != nil {
+			t.Fatalf("setup failed! -> %v", err)
+		}
+		dal := NewDataAccessLayer(db)
+		item, _ := dal.Create(context.Background(), AnonymousUser, ConstructToDoItem("Keep sanity", "high", false))
+
+		dal.Close(context.Background())
+
+		if got, _ := readToDoFile(db.fileName); !equalItems(got[item.Id], item) {
+			t.Errorf("write not flushed on close, file holds %v", got)
+		}
+	})
+}
+
+// Drops what the DAL stamps on every write, for comparing against items
+// built before they were written
+func unstamped(items []ToDoItem) []ToDoItem {
+	stripped := make([]ToDoItem, 0, len(items))
+	for _, item := range items {
+		item.CreatedAt, item.UpdatedAt, item.UpdatedBy, item.CompletedAt, item.Version = nil, nil, "", nil, 0
+		stripped = append(stripped, item)
+	}
+	return stripped
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// A registered user. Only a hash of the password is ever kept
+type Account struct {
+	Name         User   `json:"name"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// What an APIKey may be used for
+type Scope string
+
+const (
+	ScopeRead      Scope = "read"
+	ScopeReadWrite Scope = "read-write"
+)
+
+func (s Scope) valid() bool {
+	return s == ScopeRead || s == ScopeReadWrite
+}
+
+// Lets scripts call the API as the user that created it. Only a hash of the
+// secret half of the key is ever kept
+type APIKey struct {
+	Id      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scope   Scope     `json:"scope"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+// Holds Accounts and their APIKeys alongside the todos. Unlike a DataStore it
+// is not used from behind the DAL, so implementations must be safe for
+// concurrent use
+type AccountStore interface {
+	createAccount(ctx context.Context, account Account) error
+	getAccount(ctx context.Context, name User) (Account, error)
+	// Fails with ErrNoAccount if `owner` has not registered
+	createAPIKey(ctx context.Context, owner User, key APIKey) error
+	listAPIKeys(ctx context.Context, owner User) ([]APIKey, error)
+	// Fails with ErrNoAPIKey unless `owner` has a key with the given Id
+	deleteAPIKey(ctx context.Context, owner User, id string) error
+	// Returns the key with the given Id and who owns it
+	getAPIKey(ctx context.Context, id string) (User, APIKey, error)
+}
+
+var ErrAccountExists = errors.New("an account with that name already exists")
+var ErrNoAccount = errors.New("no account with that name exists")
+var ErrNoAPIKey = errors.New("no API key with that id exists")
+
+// How an account is kept by the in memory and JSON stores
+type accountRecord struct {
+	Account
+	APIKeys []APIKey `json:"api_keys,omitempty"`
+}
+
+func findAPIKey(records map[User]accountRecord, id string) (User, APIKey, error) {
+	for owner, record := range records {
+		for _, key := range record.APIKeys {
+			if key.Id == id {
+				return owner, key, nil
+			}
+		}
+	}
+	return AnonymousUser, APIKey{}, ErrNoAPIKey
+}
+
+func removeAPIKey(records map[User]accountRecord, owner User, id string) error {
+	record, exists := records[owner]
+	if !exists {
+		return ErrNoAPIKey
+	}
+	i := slices.IndexFunc(record.APIKeys, func(key APIKey) bool { return key.Id == id })
+	if i < 0 {
+		return ErrNoAPIKey
+	}
+	record.APIKeys = slices.Delete(record.APIKeys, i, i+1)
+	records[owner] = record
+	return nil
+}
+
+type inMemoryAccountStore struct {
+	mu       sync.RWMutex
+	accounts map[User]accountRecord
+}
+
+func newInMemoryAccountStore() *inMemoryAccountStore {
+	return &inMemoryAccountStore{accounts: make(map[User]accountRecord)}
+}
+
+func (s *inMemoryAccountStore) createAccount(ctx context.Context, account Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.accounts[account.Name]; exists {
+		return ErrAccountExists
+	}
+	s.accounts[account.Name] = accountRecord{Account: account}
+	return nil
+}
+
+func (s *inMemoryAccountStore) getAccount(ctx context.Context, name User) (Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, exists := s.accounts[name]
+	if !exists {
+		return Account{}, ErrNoAccount
+	}
+	return record.Account, nil
+}
+
+func (s *inMemoryAccountStore) createAPIKey(ctx context.Context, owner User, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, exists := s.accounts[owner]
+	if !exists {
+		return ErrNoAccount
+	}
+	record.APIKeys = append(slices.Clip(record.APIKeys), key)
+	s.accounts[owner] = record
+	return nil
+}
+
+func (s *inMemoryAccountStore) listAPIKeys(ctx context.Context, owner User) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.accounts[owner].APIKeys), nil
+}
+
+func (s *inMemoryAccountStore) deleteAPIKey(ctx context.Context, owner User, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return removeAPIKey(s.accounts, owner, id)
+}
+
+func (s *inMemoryAccountStore) getAPIKey(ctx context.Context, id string) (User, APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return findAPIKey(s.accounts, id)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Behaviour every AccountStore implementation must share. `newStore` must
+// return an empty store each time it is called
+func testAccountStoreContract(t *testing.T, newStore func(t *testing.T) AccountStore) {
+	ctx := context.Background()
+	t.Run("Create and get account", func(t *testing.T) {
+		store := newStore(t)
+		account := Account{"alice", "hash"}
+
+		if err := store.createAccount(ctx, account); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		got, err := store.getAccount(ctx, "alice")
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if got != account {
+			t.Errorf("want %v, got %v", account, got)
+		}
+	})
+	t.Run("Create existing account", func(t *testing.T) {
+		store := newStore(t)
+		store.createAccount(ctx, Account{"alice", "hash"})
+
+		err := store.createAccount(ctx, Account{"alice", "other hash"})
+
+		if err != ErrAccountExists {
+			t.Errorf("want %v, got %v", ErrAccountExists, err)
+		}
+	})
+	t.Run("Get non-existent account", func(t *testing.T) {
+		store := newStore(t)
+
+		_, err := store.getAccount(ctx, "alice")
+
+		if err != ErrNoAccount {
+			t.Errorf("want %v, got %v", ErrNoAccount, err)
+		}
+	})
+	t.Run("Create, list and get API keys", func(t *testing.T) {
+		store := newStore(t)
+		store.createAccount(ctx, Account{"alice", "hash"})
+		keys := []APIKey{
+			{"key-1", "ci", ScopeRead, "hash 1", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{"key-2", "scripts", ScopeReadWrite, "hash 2", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		}
+		for _, key := range keys {
+			if err := store.createAPIKey(ctx, "alice", key); err != nil {
+				t.Fatalf("Unexpected error thrown! Got: %v", err)
+			}
+		}
+
+		got, err := store.listAPIKeys(ctx, "alice")
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if len(got) != len(keys) || !sameAPIKey(got[0], keys[0]) || !sameAPIKey(got[1], keys[1]) {
+			t.Errorf("want %v, got %v", keys, got)
+		}
+		owner, key, err := store.getAPIKey(ctx, "key-2")
+		if err != nil || owner != "alice" || !sameAPIKey(key, keys[1]) {
+			t.Errorf("want alice %v, got %v %v, err %v", keys[1], owner, key, err)
+		}
+	})
+	t.Run("API key for non-existent account", func(t *testing.T) {
+		store := newStore(t)
+
+		err := store.createAPIKey(ctx, "alice", APIKey{"key-1", "ci", ScopeRead, "hash", time.Now()})
+
+		if err != ErrNoAccount {
+			t.Errorf("want %v, got %v", ErrNoAccount, err)
+		}
+	})
+	t.Run("Delete API key", func(t *testing.T) {
+		store := newStore(t)
+		store.createAccount(ctx, Account{"alice", "hash"})
+		store.createAccount(ctx, Account{"bob", "hash"})
+		store.createAPIKey(ctx, "alice", APIKey{"key-1", "ci", ScopeRead, "hash", time.Now()})
+
+		if err := store.deleteAPIKey(ctx, "bob", "key-1"); err != ErrNoAPIKey {
+			t.Errorf("bob deleted alice's key, want %v, got %v", ErrNoAPIKey, err)
+		}
+		if err := store.deleteAPIKey(ctx, "alice", "key-1"); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+
+		if _, _, err := store.getAPIKey(ctx, "key-1"); err != ErrNoAPIKey {
+			t.Errorf("want %v, got %v", ErrNoAPIKey, err)
+		}
+		if err := store.deleteAPIKey(ctx, "alice", "key-1"); err != ErrNoAPIKey {
+			t.Errorf("want %v, got %v", ErrNoAPIKey, err)
+		}
+	})
+}
+
+func sameAPIKey(a, b APIKey) bool {
+	return a.Id == b.Id && a.Name == b.Name && a.Scope == b.Scope && a.Hash == b.Hash && a.Created.Equal(b.Created)
+}
+
+func TestInMemoryAccountStoreContract(t *testing.T) {
+	testAccountStoreContract(t, func(t *testing.T) AccountStore {
+		return newInMemoryAccountStore()
+	})
+}
+
+func TestJSONAccountStoreContract(t *testing.T) {
+	testAccountStoreContract(t, func(t *testing.T) AccountStore {
+		return newJSONAccountStore(filepath.Join(t.TempDir(), "accounts.json"), 0)
+	})
+}
+
+func TestJSONAccountStoreRecovery(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "accounts.json")
+	store := newJSONAccountStore(fileName, 0)
+	store.createAccount(context.Background(), Account{"alice", "hash"})
+	store.createAccount(context.Background(), Account{"bob", "hash"})
+	os.WriteFile(fileName, []byte(`{"alice": `), 0o644)
+
+	got, err := store.getAccount(context.Background(), "alice")
+
+	if err != nil || got.Name != "alice" {
+		t.Errorf("account not recovered from backup, got %v, err %v", got, err)
+	}
+}
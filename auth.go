@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrBadCredentials = errors.New("incorrect user name or password")
+var ErrInvalidUserName = errors.New("user names are 1 to 64 letters, digits, '.', '_' or '-'")
+var ErrWeakPassword = errors.New("passwords must be between 8 and 72 bytes long")
+var ErrInvalidScope = errors.New(`API key scope must be "read" or "read-write"`)
+
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+const minPasswordLength = 8
+
+// Registers users, checks their passwords and hands out the session tokens
+// used as bearer tokens by the API and as cookies by the website. Users can
+// also create APIKeys, which are used as bearer tokens in the same way.
+//
+// Sessions only live in memory, so restarting logs everyone out. APIKeys are
+// kept by the AccountStore and last until they are revoked
+type Auth struct {
+	accounts AccountStore
+	sessions *sessionStore
+	hashCost int
+}
+
+func NewAuth(accounts AccountStore, sessionTTL time.Duration) *Auth {
+	return &Auth{
+		accounts,
+		newSessionStore(sessionTTL),
+		bcrypt.DefaultCost,
+	}
+}
+
+func (a *Auth) Register(ctx context.Context, name User, password string) error {
+	if !userNamePattern.MatchString(string(name)) {
+		return ErrInvalidUserName
+	}
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.hashCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return ErrWeakPassword
+	}
+	if err != nil {
+		return err
+	}
+	return a.accounts.createAccount(ctx, Account{name, string(hash)})
+}
+
+// Hashed against when the account does not exist, so telling unknown users
+// from wrong passwords by timing the response is no easier than guessing
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// Starts a session for `name`, returning its token and when it expires
+func (a *Auth) Login(ctx context.Context, name User, password string) (string, time.Time, error) {
+	account, err := a.accounts.getAccount(ctx, name)
+	if errors.Is(err, ErrNoAccount) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return "", time.Time{}, ErrBadCredentials
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil {
+		return "", time.Time{}, ErrBadCredentials
+	}
+	return a.sessions.start(name)
+}
+
+func (a *Auth) Logout(token string) {
+	a.sessions.end(token)
+}
+
+// Returns who a session token or APIKey belongs to and what it may be used
+// for, false if it is unknown, revoked or has expired. Sessions can do
+// anything their user can
+func (a *Auth) Authenticate(ctx context.Context, token string) (User, Scope, bool) {
+	id, secret, isKey := parseAPIKey(token)
+	if !isKey {
+		user, ok := a.sessions.lookup(token)
+		return user, ScopeReadWrite, ok
+	}
+	owner, key, err := a.accounts.getAPIKey(ctx, id)
+	if err != nil {
+		if !errors.Is(err, ErrNoAPIKey) {
+			slog.ErrorContext(ctx, "could not look up API key", "err", err)
+		}
+		return AnonymousUser, "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(key.Hash)) != 1 {
+		return AnonymousUser, "", false
+	}
+	return owner, key.Scope, true
+}
+
+const apiKeyPrefix = "todo."
+
+// APIKeys are handed out as todo.<id>.<secret>, the id finds the stored hash
+// of the secret
+func parseAPIKey(token string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(token, apiKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ".")
+}
+
+// Returns the new key along with the token to hand to the user, which
+// cannot be recovered later
+func (a *Auth) CreateAPIKey(ctx context.Context, user User, name string, scope Scope) (APIKey, string, error) {
+	if !scope.valid() {
+		return APIKey{}, "", ErrInvalidScope
+	}
+	secret, err := newToken()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	key := APIKey{
+		Id:      uuid.NewString(),
+		Name:    name,
+		Scope:   scope,
+		Hash:    hashToken(secret),
+		Created: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if err = a.accounts.createAPIKey(ctx, user, key); err != nil {
+		return APIKey{}, "", err
+	}
+	return key, apiKeyPrefix + key.Id + "." + secret, nil
+}
+
+func (a *Auth) ListAPIKeys(ctx context.Context, user User) ([]APIKey, error) {
+	return a.accounts.listAPIKeys(ctx, user)
+}
+
+func (a *Auth) RevokeAPIKey(ctx context.Context, user User, id string) error {
+	return a.accounts.deleteAPIKey(ctx, user, id)
+}
+
+type session struct {
+	user    User
+	expires time.Time
+}
+
+// Sessions are keyed by a hash of their token, so the tokens themselves are
+// never kept
+type sessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]session
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{ttl: ttl, sessions: make(map[string]session)}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *sessionStore) start(user User) (string, time.Time, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expires := now.Add(s.ttl)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, existing := range s.sessions {
+		if now.After(existing.expires) {
+			delete(s.sessions, key)
+		}
+	}
+	s.sessions[hashToken(token)] = session{user, expires}
+	return token, expires, nil
+}
+
+func (s *sessionStore) lookup(token string) (User, bool) {
+	key := hashToken(token)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found, ok := s.sessions[key]
+	if !ok {
+		return AnonymousUser, false
+	}
+	if time.Now().After(found.expires) {
+		delete(s.sessions, key)
+		return AnonymousUser, false
+	}
+	return found.user, true
+}
+
+func (s *sessionStore) end(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, hashToken(token))
+}
+
+type userKey struct{}
+type scopeKey struct{}
+
+func WithUser(ctx context.Context, user User, scope Scope) context.Context {
+	return context.WithValue(context.WithValue(ctx, userKey{}, user), scopeKey{}, scope)
+}
+
+// Returns AnonymousUser and false if nobody has been authenticated
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userKey{}).(User)
+	return user, ok
+}
+
+// Returns an empty Scope if nobody has been authenticated
+func ScopeFromContext(ctx context.Context) Scope {
+	scope, _ := ctx.Value(scopeKey{}).(Scope)
+	return scope
+}
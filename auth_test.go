@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     User
+		password string
+		want     error
+	}{
+		{"alice", "correct horse", nil},
+		{"", "correct horse", ErrInvalidUserName},
+		{"alice/../bob", "correct horse", ErrInvalidUserName},
+		{"alice", "short", ErrWeakPassword},
+		{"alice", strings.Repeat("a", 73), ErrWeakPassword},
+	}
+	for _, test := range tests {
+		auth := newTestAuth()
+
+		err := auth.Register(ctx, test.name, test.password)
+
+		if err != test.want {
+			t.Errorf("%q %q: want %v, got %v", test.name, test.password, test.want, err)
+		}
+	}
+	t.Run("Passwords are not stored", func(t *testing.T) {
+		auth := newTestAuth()
+		auth.Register(ctx, "alice", "correct horse")
+
+		account, _ := auth.accounts.getAccount(ctx, "alice")
+
+		if account.PasswordHash == "" || strings.Contains(account.PasswordHash, "correct horse") {
+			t.Errorf("password not hashed, got %q", account.PasswordHash)
+		}
+	})
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuth()
+	auth.Register(ctx, "alice", "correct horse")
+
+	t.Run("Correct password", func(t *testing.T) {
+		token, _, err := auth.Login(ctx, "alice", "correct horse")
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if user, _, ok := auth.Authenticate(ctx, token); !ok || user != "alice" {
+			t.Errorf("want alice, got %q %v", user, ok)
+		}
+	})
+	t.Run("Wrong password", func(t *testing.T) {
+		_, _, err := auth.Login(ctx, "alice", "battery staple")
+
+		if err != ErrBadCredentials {
+			t.Errorf("want %v, got %v", ErrBadCredentials, err)
+		}
+	})
+	t.Run("Unknown user", func(t *testing.T) {
+		_, _, err := auth.Login(ctx, "bob", "correct horse")
+
+		if err != ErrBadCredentials {
+			t.Errorf("want %v, got %v", ErrBadCredentials, err)
+		}
+	})
+	t.Run("Logged out", func(t *testing.T) {
+		token, _, _ := auth.Login(ctx, "alice", "correct horse")
+
+		auth.Logout(token)
+
+		if _, _, ok := auth.Authenticate(ctx, token); ok {
+			t.Error("session still valid after log out")
+		}
+	})
+	t.Run("Expired session", func(t *testing.T) {
+		auth := newTestAuth()
+		auth.sessions.ttl = time.Millisecond
+		auth.Register(ctx, "alice", "correct horse")
+		token, _, _ := auth.Login(ctx, "alice", "correct horse")
+
+		time.Sleep(5 * time.Millisecond)
+
+		if _, _, ok := auth.Authenticate(ctx, token); ok {
+			t.Error("session still valid after expiry")
+		}
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuth()
+	auth.Register(ctx, "alice", "correct horse")
+
+	t.Run("Key authenticates with its scope", func(t *testing.T) {
+		for _, scope := range []Scope{ScopeRead, ScopeReadWrite} {
+			_, token, err := auth.CreateAPIKey(ctx, "alice", "ci", scope)
+			if err != nil {
+				t.Fatalf("Unexpected error thrown! Got: %v", err)
+			}
+
+			user, got, ok := auth.Authenticate(ctx, token)
+
+			if !ok || user != "alice" || got != scope {
+				t.Errorf("want alice %v, got %q %v %v", scope, user, got, ok)
+			}
+		}
+	})
+	t.Run("Only the hash is stored", func(t *testing.T) {
+		key, token, _ := auth.CreateAPIKey(ctx, "alice", "ci", ScopeRead)
+
+		if key.Hash == "" || strings.Contains(token, key.Hash) {
+			t.Errorf("secret not hashed, got %q for %q", key.Hash, token)
+		}
+	})
+	t.Run("Wrong secret", func(t *testing.T) {
+		key, _, _ := auth.CreateAPIKey(ctx, "alice", "ci", ScopeRead)
+
+		if _, _, ok := auth.Authenticate(ctx, apiKeyPrefix+key.Id+".nope"); ok {
+			t.Error("key accepted with the wrong secret")
+		}
+	})
+	t.Run("Revoked key", func(t *testing.T) {
+		key, token, _ := auth.CreateAPIKey(ctx, "alice", "ci", ScopeRead)
+
+		if err := auth.RevokeAPIKey(ctx, "alice", key.Id); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+
+		if _, _, ok := auth.Authenticate(ctx, token); ok {
+			t.Error("key accepted after being revoked")
+		}
+	})
+	t.Run("Invalid scope", func(t *testing.T) {
+		_, _, err := auth.CreateAPIKey(ctx, "alice", "ci", "admin")
+
+		if err != ErrInvalidScope {
+			t.Errorf("want %v, got %v", ErrInvalidScope, err)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// One step of an item's checklist
+type SubItem struct {
+	Id       `json:"id"`
+	Title    `json:"title"`
+	Complete `json:"complete"`
+}
+
+var ErrNoSubItem = errors.New("no checklist item with that id exists")
+
+// Trims each step's title and gives new steps an Id. Records any problem on
+// `problems`
+func validateChecklist(checklist []SubItem, problems *ValidationError) ([]SubItem, *ValidationError) {
+	seen := make(map[Id]bool)
+	for i, sub := range checklist {
+		sub.Title = Title(strings.TrimSpace(string(sub.Title)))
+		if sub.Title == "" {
+			problems = problems.add("checklist", "items each need a title")
+		}
+		if sub.Id == "" {
+			sub.Id = Id(uuid.NewString())
+		}
+		if seen[sub.Id] {
+			problems = problems.add("checklist", fmt.Sprintf("has %q more than once", sub.Id))
+		}
+		seen[sub.Id] = true
+		checklist[i] = sub
+	}
+	return checklist, problems
+}
+
+// Whether the item has a checklist and every step of it is complete
+func (item ToDoItem) checklistDone() bool {
+	return len(item.Checklist) > 0 && !slices.ContainsFunc(item.Checklist, func(sub SubItem) bool {
+		return !bool(sub.Complete)
+	})
+}
+
+// With AutoCompleteChecklists on, completes `item` as the last open step of
+// its checklist is completed, and reopens it when a finished checklist gains
+// an open step again. `existing` is nil for a new item
+func (d *DataAccessLayer) settleChecklist(item ToDoItem, existing *ToDoItem) ToDoItem {
+	if !d.options.AutoCompleteChecklists {
+		return item
+	}
+	done, wasDone := item.checklistDone(), existing != nil && existing.checklistDone()
+	if done && !wasDone {
+		item.Complete = true
+	} else if wasDone && !done && len(item.Checklist) > 0 {
+		item.Complete = false
+	}
+	return item
+}
+
+func subItemIndex(item *ToDoItem, sub Id) (int, error) {
+	i := slices.IndexFunc(item.Checklist, func(s SubItem) bool { return s.Id == sub })
+	if i < 0 {
+		return i, ErrNoSubItem
+	}
+	return i, nil
+}
+
+// Adds a step titled `title` to the end of item `id`'s checklist. Checks the
+// same as Patch
+func (d DataAccessLayer) AddSubItem(ctx context.Context, user User, id Id, version int, title Title) (ToDoItem, error) {
+	return d.Patch(ctx, user, id, version, func(item *ToDoItem) error {
+		item.Checklist = append(item.Checklist, SubItem{Id: Id(uuid.NewString()), Title: title})
+		return nil
+	})
+}
+
+// Completes step `sub` of item `id`'s checklist if it is open, or reopens it
+// if it is complete. Fails with ErrNoSubItem if the checklist has no such step
+func (d DataAccessLayer) ToggleSubItem(ctx context.Context, user User, id Id, version int, sub Id) (ToDoItem, error) {
+	return d.Patch(ctx, user, id, version, func(item *ToDoItem) error {
+		i, err := subItemIndex(item, sub)
+		if err != nil {
+			return err
+		}
+		item.Checklist[i].Complete = !item.Checklist[i].Complete
+		return nil
+	})
+}
+
+// Moves step `sub` of item `id`'s checklist so it is at `index`, counting
+// from 0. Fails with ErrNoSubItem if the checklist has no such step, or a
+// *ValidationError if `index` is past the end
+func (d DataAccessLayer) MoveSubItem(ctx context.Context, user User, id Id, version int, sub Id, index int) (ToDoItem, error) {
+	return d.Patch(ctx, user, id, version, func(item *ToDoItem) error {
+		i, err := subItemIndex(item, sub)
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= len(item.Checklist) {
+			return new(ValidationError).add("index", fmt.Sprintf("must be from 0 to %d", len(item.Checklist)-1))
+		}
+		moved := item.Checklist[i]
+		item.Checklist = slices.Insert(slices.Delete(item.Checklist, i, i+1), index, moved)
+		return nil
+	})
+}
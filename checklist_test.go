@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestValidateChecklist(t *testing.T) {
+	item := ConstructToDoItem("Finish go academy", "high", false)
+	item.Checklist = []SubItem{{Title: " Read the book "}, {Id: "2", Title: "Write the app"}}
+
+	got, err := item.validate()
+
+	if err != nil || got.Checklist[0].Id == "" || got.Checklist[0].Title != "Read the book" || got.Checklist[1].Id != "2" {
+		t.Errorf("want titles trimmed and new steps given an id, got %v %v", got.Checklist, err)
+	}
+	if item.Checklist[0].Id != "" {
+		t.Errorf("validate changed the caller's checklist, got %v", item.Checklist)
+	}
+	item.Checklist = []SubItem{{Id: "1", Title: "Read"}, {Id: "1", Title: ""}}
+	var invalid *ValidationError
+	if _, err := item.validate(); !errors.As(err, &invalid) || invalid.Fields["checklist"] == "" {
+		t.Errorf("want a problem with the checklist, got %v", err)
+	}
+}
+
+func TestChecklist(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	item, _ := dal.Create(ctx, AnonymousUser, ConstructToDoItem("Finish go academy", "high", false))
+
+	item, err := dal.AddSubItem(ctx, AnonymousUser, item.Id, item.Version, "Read the book")
+	if err != nil {
+		t.Fatalf("Unexpected error thrown! Got: %v", err)
+	}
+	item, _ = dal.AddSubItem(ctx, AnonymousUser, item.Id, item.Version, "Write the app")
+	t.Run("Steps are added in order", func(t *testing.T) {
+		if len(item.Checklist) != 2 || item.Checklist[0].Title != "Read the book" || item.Checklist[1].Title != "Write the app" {
+			t.Errorf("want both steps in order, got %v", item.Checklist)
+		}
+	})
+	t.Run("Move", func(t *testing.T) {
+		moved, err := dal.MoveSubItem(ctx, AnonymousUser, item.Id, 0, item.Checklist[1].Id, 0)
+
+		if err != nil || moved.Checklist[0].Title != "Write the app" || moved.Checklist[1].Title != "Read the book" {
+			t.Errorf("want the steps swapped, got %v %v", moved.Checklist, err)
+		}
+		var invalid *ValidationError
+		if _, err := dal.MoveSubItem(ctx, AnonymousUser, item.Id, 0, item.Checklist[1].Id, 2); !errors.As(err, &invalid) {
+			t.Errorf("want a *ValidationError for an index past the end, got %v", err)
+		}
+		item = moved
+	})
+	t.Run("Completing every step completes the item", func(t *testing.T) {
+		first, _ := dal.ToggleSubItem(ctx, AnonymousUser, item.Id, 0, item.Checklist[0].Id)
+		if first.Complete {
+			t.Errorf("item complete with a step still open, got %v", first)
+		}
+
+		done, err := dal.ToggleSubItem(ctx, AnonymousUser, item.Id, 0, item.Checklist[1].Id)
+
+		if err != nil || !done.Complete || done.CompletedAt == nil {
+			t.Errorf("want the item complete, got %v %v", done, err)
+		}
+		reopened, _ := dal.ToggleSubItem(ctx, AnonymousUser, item.Id, 0, item.Checklist[1].Id)
+		if reopened.Complete {
+			t.Errorf("want the item reopened with its step, got %v", reopened)
+		}
+	})
+	t.Run("Unknown step", func(t *testing.T) {
+		if _, err := dal.ToggleSubItem(ctx, AnonymousUser, item.Id, 0, "nope"); err != ErrNoSubItem {
+			t.Errorf("want %v, got %v", ErrNoSubItem, err)
+		}
+	})
+	t.Run("Stale version", func(t *testing.T) {
+		if _, err := dal.AddSubItem(ctx, AnonymousUser, item.Id, 1, "Too late"); err != ErrConflict {
+			t.Errorf("want %v, got %v", ErrConflict, err)
+		}
+	})
+	t.Run("Adds at the same time are all kept", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dal.AddSubItem(ctx, AnonymousUser, item.Id, 0, "Again")
+			}()
+		}
+		wg.Wait()
+
+		if got, _ := dal.Get(ctx, AnonymousUser, item.Id); len(got.Checklist) != 12 {
+			t.Errorf("want 12 steps, got %d", len(got.Checklist))
+		}
+	})
+}
+
+func TestChecklistWithoutAutoComplete(t *testing.T) {
+	ctx := context.Background()
+	db := newEmptyInMemoryDataStore()
+	dal := NewDataAccessLayerWithOptions(&db, DALOptions{AutoCompleteChecklists: false})
+	item := ConstructToDoItem("Finish go academy", "high", false)
+	item.Checklist = []SubItem{{Title: "Read the book", Complete: true}}
+
+	created, err := dal.Create(ctx, AnonymousUser, item)
+
+	if err != nil || created.Complete {
+		t.Errorf("want the item left open, got %v %v", created, err)
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func Input(prompt string) string {
@@ -25,22 +30,91 @@ func FInput(r io.Reader) string {
 	return input
 }
 
+// Asks again until a title is given
 func getTitle() Title {
-	return Title(
-		Input("Enter a title for this to do item: "),
-	)
+	for {
+		title := Title(strings.TrimSpace(
+			Input("Enter a title for this to do item: "),
+		))
+		if title != "" {
+			return title
+		}
+		fmt.Println("A title is required")
+	}
 }
 
+// Asks again until one of the allowed priorities is given, an empty answer
+// gets the default
 func getPriority() Priority {
-	return Priority(
-		Input("Enter a priority for this to do item: "),
-	)
+	for {
+		priority, ok := Priority(
+			Input("Enter a priority for this to do item (Low, Medium or High): "),
+		).normalise()
+		if ok {
+			return priority
+		}
+		fmt.Println(`Priority must be "Low", "Medium" or "High"`)
+	}
+}
+
+// Asks again until the answer is empty, for no due date, or a date with an
+// optional time, read in the local timezone
+func getDue() *time.Time {
+	for {
+		answer := strings.TrimSpace(
+			Input("Enter when this to do item is due (YYYY-MM-DD HH:MM), or nothing: "),
+		)
+		if answer == "" {
+			return nil
+		}
+		for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+			if due, err := time.ParseInLocation(layout, answer, time.Local); err == nil {
+				return &due
+			}
+		}
+		fmt.Println("Due dates look like 2024-01-31 or 2024-01-31 17:00")
+	}
+}
+
+// Asks again until every tag is allowed, an empty answer removes them all
+func getTags(current []Tag) []Tag {
+	if len(current) > 0 {
+		fmt.Printf("Currently tagged %s\n", formatTags(current))
+	}
+	for {
+		tags, ok := normaliseTags(parseTags(
+			Input("Enter tags separated by commas, or nothing: "),
+		))
+		if ok {
+			return tags
+		}
+		fmt.Printf("Tags must each be 1 to %d characters\n", maxTagLength)
+	}
+}
+
+// Asks again until the answer is empty, for never, or a rule the DAL takes
+func getRecurrence() Recurrence {
+	for {
+		recurrence, err := Recurrence(
+			Input("Enter how often this to do item repeats (daily, weekly, monthly or an RRULE), or nothing: "),
+		).normalise(nil)
+		if err == nil {
+			return recurrence
+		}
+		fmt.Println("Repeats " + err.Error())
+	}
 }
 
 func cliPromptForToDoItem() ToDoItem {
 	title := getTitle()
 	priority := getPriority()
-	return ConstructToDoItem(title, priority, false)
+	item := ConstructToDoItem(title, priority, false)
+	item.Due = getDue()
+	// Repeats are counted from the due date
+	if item.Due != nil {
+		item.Recurrence = getRecurrence()
+	}
+	return item
 }
 
 func formatToDoItem(item ToDoItem) string {
@@ -50,7 +124,26 @@ func formatToDoItem(item ToDoItem) string {
 	} else {
 		status = "incomplete"
 	}
-	return fmt.Sprintf("| %s | %s | %s |\n", item.Title, item.Priority, status)
+	formatted := fmt.Sprintf("| %s | %s | %s | %s |", item.Title, item.Priority, status, formatDue(item, time.Now()))
+	if len(item.Tags) > 0 {
+		formatted += fmt.Sprintf(" %s |", formatTags(item.Tags))
+	}
+	if len(item.Checklist) > 0 {
+		done := 0
+		for _, sub := range item.Checklist {
+			if sub.Complete {
+				done++
+			}
+		}
+		formatted += fmt.Sprintf(" %d/%d steps done |", done, len(item.Checklist))
+	}
+	if len(item.BlockedBy) > 0 {
+		formatted += fmt.Sprintf(" blocked by %d |", len(item.BlockedBy))
+	}
+	if item.Recurrence != "" {
+		formatted += fmt.Sprintf(" repeats %s |", item.Recurrence)
+	}
+	return formatted + "\n"
 }
 
 func printToDoItem(item ToDoItem) {
@@ -77,10 +170,55 @@ func choseFromList(commandList []string) int {
 	}
 }
 
-func cliRead(db *DataAccessLayer) {
-	items := db.Read()
-	if len(items) == 0 {
-		fmt.Println("No items to show")
+// How many items cliRead shows before asking whether to carry on
+const cliPageSize = 10
+
+// Asks how to sort the items, an empty answer sorts oldest first
+func getSort() SortKey {
+	for {
+		sort := SortKey(strings.ToLower(strings.TrimSpace(
+			Input("Sort by created, priority or title: "),
+		)))
+		switch sort {
+		case "":
+			return SortCreated
+		case SortCreated, SortPriority, SortTitle:
+			return sort
+		}
+		fmt.Println(`Sort must be "created", "priority" or "title"`)
+	}
+}
+
+func cliRead(ctx context.Context, db *DataAccessLayer, user User, list ListId) {
+	q := Query{List: list, Sort: getSort(), Limit: cliPageSize}
+	// Priorities read best highest first
+	q.Descending = q.Sort == SortPriority
+	for {
+		page, err := db.Query(ctx, user, q)
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			return
+		}
+		if len(page.Items) == 0 && q.After == "" {
+			fmt.Println("No items to show")
+		}
+		for _, item := range page.Items {
+			printToDoItem(item)
+		}
+		if page.Next == "" || strings.ToLower(strings.TrimSpace(Input("Show more? (y/N): "))) != "y" {
+			return
+		}
+		q.After = page.Next
+	}
+}
+
+func cliSearch(ctx context.Context, db *DataAccessLayer, user User, list ListId) {
+	text := Input("Search for: ")
+	items, err := db.Search(ctx, user, list, text)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	} else if len(items) == 0 {
+		fmt.Println("Nothing matches")
 	} else {
 		for _, item := range items {
 			printToDoItem(item)
@@ -88,18 +226,72 @@ func cliRead(db *DataAccessLayer) {
 	}
 }
 
-func cliAdd(db *DataAccessLayer) {
-	err := db.Create(
-		cliPromptForToDoItem(),
+// Lists the incomplete items that are not waiting on anything
+func cliNext(ctx context.Context, db *DataAccessLayer, user User, list ListId) {
+	page, err := db.Query(ctx, user, Query{List: list, Actionable: true, Sort: SortPriority, Descending: true})
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	} else if len(page.Items) == 0 {
+		fmt.Println("Nothing to do next")
+	} else {
+		for _, item := range page.Items {
+			printToDoItem(item)
+		}
+	}
+}
+
+// Asks which of `items` `item` is blocked by, keeping its current blockers
+// if nothing is chosen
+func getBlockedBy(items []ToDoItem, item ToDoItem) []Id {
+	for {
+		for i, other := range items {
+			if other.Id != item.Id {
+				fmt.Printf("%d : ", i)
+				printToDoItem(other)
+			}
+		}
+		answer := strings.TrimSpace(Input("Blocked by (numbers separated by spaces, \"none\" to clear, blank to keep): "))
+		switch answer {
+		case "":
+			return item.BlockedBy
+		case "none":
+			return nil
+		}
+		var blockedBy []Id
+		valid := true
+		for _, field := range strings.Fields(answer) {
+			choice, err := strconv.Atoi(field)
+			if err != nil || choice < 0 || choice >= len(items) || items[choice].Id == item.Id {
+				valid = false
+				break
+			}
+			blockedBy = append(blockedBy, items[choice].Id)
+		}
+		if valid {
+			return blockedBy
+		}
+		fmt.Println("Choose from the numbers shown")
+	}
+}
+
+func cliAdd(ctx context.Context, db *DataAccessLayer, user User, list ListId) {
+	item := cliPromptForToDoItem()
+	item.List = list
+	_, err := db.Create(
+		ctx,
+		user,
+		item,
 	)
 	if err != nil {
 		fmt.Printf("ERROR: %v\n", err)
 	}
 }
 
-func cliDelete(db *DataAccessLayer) {
-	items := db.Read()
-	if len(items) == 0 {
+func cliDelete(ctx context.Context, db *DataAccessLayer, user User, list ListId) {
+	items, err := db.Read(ctx, user, list)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	} else if len(items) == 0 {
 		fmt.Println("No items in database")
 	} else {
 		for i, item := range items {
@@ -109,14 +301,25 @@ func cliDelete(db *DataAccessLayer) {
 		fmt.Print("Choose item to delete: ")
 		var choice int
 		fmt.Scanf("%d", &choice)
-		itemToDelete := items[choice]
-		db.Delete(itemToDelete)
+		if choice < 0 || choice >= len(items) {
+			fmt.Printf("Choose a number between 0 and %d\n", len(items)-1)
+			return
+		}
+		itemToDelete, err := db.Get(ctx, user, items[choice].Id)
+		if err == nil {
+			err = db.Delete(ctx, user, itemToDelete)
+		}
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+		}
 	}
 }
 
-func cliUpdate(db *DataAccessLayer) {
-	items := db.Read()
-	if len(items) == 0 {
+func cliUpdate(ctx context.Context, db *DataAccessLayer, user User, list ListId) {
+	items, err := db.Read(ctx, user, list)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	} else if len(items) == 0 {
 		fmt.Println("No items in database")
 	} else {
 		for i, item := range items {
@@ -126,10 +329,24 @@ func cliUpdate(db *DataAccessLayer) {
 		fmt.Print("Choose item to update: ")
 		var choice int
 		fmt.Scanf("%d", &choice)
-		itemToUpdate := items[choice]
+		if choice < 0 || choice >= len(items) {
+			fmt.Printf("Choose a number between 0 and %d\n", len(items)-1)
+			return
+		}
+		itemToUpdate, err := db.Get(ctx, user, items[choice].Id)
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			return
+		}
 		actions := []string{
 			"update title",
 			"update priority",
+			"update due date",
+			"edit tags",
+			"edit checklist",
+			"edit blockers",
+			"update repeats",
+			"stop repeating",
 			"mark complete",
 			"mark incomplete",
 		}
@@ -139,6 +356,28 @@ func cliUpdate(db *DataAccessLayer) {
 			itemToUpdate.Title = getTitle()
 		case "update priority":
 			itemToUpdate.Priority = getPriority()
+		case "update due date":
+			itemToUpdate.Due = getDue()
+		case "edit tags":
+			itemToUpdate.Tags = getTags(itemToUpdate.Tags)
+		case "edit checklist":
+			// Each change to the checklist is written on its own
+			cliEditChecklist(ctx, db, user, itemToUpdate)
+			return
+		case "edit blockers":
+			itemToUpdate.BlockedBy = getBlockedBy(items, itemToUpdate)
+		case "update repeats":
+			itemToUpdate.Recurrence = getRecurrence()
+		case "stop repeating":
+			// Stops every open item in the series, not just this one
+			if itemToUpdate.Series == "" {
+				fmt.Println("To Do item does not repeat!")
+				return
+			}
+			if _, err := db.StopSeries(ctx, user, itemToUpdate.Series); err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+			}
+			return
 		case "mark complete":
 			if itemToUpdate.Complete {
 				fmt.Println("To Do item is already complete!")
@@ -152,33 +391,273 @@ func cliUpdate(db *DataAccessLayer) {
 				itemToUpdate.Complete = false
 			}
 		}
-		db.Update(itemToUpdate)
+		_, err = db.Update(ctx, user, itemToUpdate)
+		if errors.Is(err, ErrBlocked) &&
+			strings.ToLower(strings.TrimSpace(Input("It is blocked by items that are not complete, complete it anyway? (y/N): "))) == "y" {
+			_, err = db.Update(WithForce(ctx), user, itemToUpdate)
+		}
+		if errors.Is(err, ErrConflict) {
+			fmt.Println("Someone else changed this item while you were editing it, choose it again to see their changes")
+		} else if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+		}
+	}
+}
+
+func cliEditChecklist(ctx context.Context, db *DataAccessLayer, user User, item ToDoItem) {
+	for i, sub := range item.Checklist {
+		status := " "
+		if sub.Complete {
+			status = "x"
+		}
+		fmt.Printf("%d : [%s] %s\n", i, status, sub.Title)
+	}
+	actions := []string{"add step"}
+	if len(item.Checklist) > 0 {
+		actions = append(actions, "toggle step", "move step")
+	}
+	chooseStep := func(prompt string) (Id, bool) {
+		fmt.Print(prompt)
+		var choice int
+		fmt.Scanf("%d", &choice)
+		if choice < 0 || choice >= len(item.Checklist) {
+			fmt.Printf("Choose a number between 0 and %d\n", len(item.Checklist)-1)
+			return "", false
+		}
+		return item.Checklist[choice].Id, true
+	}
+	var err error
+	switch actions[choseFromList(actions)] {
+	case "add step":
+		_, err = db.AddSubItem(ctx, user, item.Id, item.Version, Title(Input("Enter a title for this step: ")))
+	case "toggle step":
+		if sub, ok := chooseStep("Choose step to toggle: "); ok {
+			_, err = db.ToggleSubItem(ctx, user, item.Id, item.Version, sub)
+		}
+	case "move step":
+		if sub, ok := chooseStep("Choose step to move: "); ok {
+			fmt.Print("Move it to: ")
+			var index int
+			fmt.Scanf("%d", &index)
+			_, err = db.MoveSubItem(ctx, user, item.Id, item.Version, sub, index)
+		}
+	}
+	if errors.Is(err, ErrConflict) {
+		fmt.Println("Someone else changed this item while you were editing it, choose it again to see their changes")
+	} else if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	}
+}
+
+func formatList(list List, user User) string {
+	return fmt.Sprintf("| %s | %s | %d members |\n", list.Name, list.Members[user], len(list.Members))
+}
+
+// Returns the List chosen to work in, or the personal list. Returns false if
+// the lists could not be read
+func cliSwitchList(ctx context.Context, db *DataAccessLayer, user User) (List, bool) {
+	lists, err := db.Lists(ctx, user)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return List{}, false
+	}
+	fmt.Println("0 : personal")
+	for i, list := range lists {
+		fmt.Printf("%d : ", i+1)
+		fmt.Print(formatList(list, user))
+	}
+	fmt.Print("Choose list to switch to: ")
+	var choice int
+	fmt.Scanf("%d", &choice)
+	if choice < 1 || choice > len(lists) {
+		return List{}, true
+	}
+	return lists[choice-1], true
+}
+
+func cliCreateList(ctx context.Context, db *DataAccessLayer, user User) (List, bool) {
+	if user == AnonymousUser {
+		fmt.Println("Log in to create a list")
+		return List{}, false
+	}
+	list, err := db.CreateList(ctx, user, Input("Enter a name for this list: "))
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return List{}, false
+	}
+	return list, true
+}
+
+func cliShareList(ctx context.Context, db *DataAccessLayer, user User, list ListId) {
+	if list == "" {
+		fmt.Println("Your personal list cannot be shared, switch to another list first")
+		return
+	}
+	member := User(Input("Enter the user name to share with: "))
+	roles := []string{string(RoleViewer), string(RoleEditor), string(RoleOwner)}
+	role := Role(roles[choseFromList(roles)])
+	if _, err := db.ShareList(ctx, user, list, member, role); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
 	}
 }
 
-func RunCli(dal DataAccessLayer) {
+func cliLogIn(ctx context.Context, auth *Auth) (User, bool) {
+	name := User(Input("Enter your user name: "))
+	password := Input("Enter your password: ")
+	token, _, err := auth.Login(ctx, name, password)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return AnonymousUser, false
+	}
+	// The CLI keeps hold of the user rather than the session
+	auth.Logout(token)
+	fmt.Printf("Logged in as %s\n", name)
+	return name, true
+}
+
+// Reminds the user of anything overdue in their personal list
+func cliRemindOverdue(ctx context.Context, db *DataAccessLayer, user User) {
+	overdue, err := db.ReadDue(ctx, user, "", DueOverdue, time.Now())
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	if len(overdue) == 0 {
+		return
+	}
+	fmt.Printf("You have %d overdue items:\n", len(overdue))
+	for _, item := range overdue {
+		printToDoItem(item)
+	}
+}
+
+func formatAPIKey(key APIKey) string {
+	return fmt.Sprintf("| %s | %s | %s | %s |\n", key.Id, key.Name, key.Scope, key.Created.Format(time.DateTime))
+}
+
+func cliCreateAPIKey(ctx context.Context, auth *Auth, user User) {
+	if user == AnonymousUser {
+		fmt.Println("Log in to create an API key")
+		return
+	}
+	name := Input("Enter a name for this API key: ")
+	scopes := []string{string(ScopeRead), string(ScopeReadWrite)}
+	scope := Scope(scopes[choseFromList(scopes)])
+	_, token, err := auth.CreateAPIKey(ctx, user, name, scope)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	fmt.Println("Your new API key, it will not be shown again:")
+	fmt.Println(token)
+}
+
+func cliListAPIKeys(ctx context.Context, auth *Auth, user User) {
+	keys, err := auth.ListAPIKeys(ctx, user)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	} else if len(keys) == 0 {
+		fmt.Println("No API keys to show")
+	} else {
+		for _, key := range keys {
+			fmt.Print(formatAPIKey(key))
+		}
+	}
+}
+
+func cliRevokeAPIKey(ctx context.Context, auth *Auth, user User) {
+	keys, err := auth.ListAPIKeys(ctx, user)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	} else if len(keys) == 0 {
+		fmt.Println("No API keys to revoke")
+	} else {
+		for i, key := range keys {
+			fmt.Printf("%d : ", i)
+			fmt.Print(formatAPIKey(key))
+		}
+		fmt.Print("Choose API key to revoke: ")
+		var choice int
+		fmt.Scanf("%d", &choice)
+		if choice < 0 || choice >= len(keys) {
+			fmt.Printf("Choose a number between 0 and %d\n", len(keys)-1)
+			return
+		}
+		if err = auth.RevokeAPIKey(ctx, user, keys[choice].Id); err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+		}
+	}
+}
+
+// Returns once the user chooses to exit
+func RunCli(dal DataAccessLayer, auth *Auth) {
 	fmt.Println("It's a todo app!")
 	commandList := []string{
 		"exit",
 		"read",
+		"search",
+		"next",
 		"add",
 		"update",
 		"delete",
+		"log in",
+		"log out",
+		"create api key",
+		"list api keys",
+		"revoke api key",
+		"switch list",
+		"create list",
+		"share list",
 	}
+	user := AnonymousUser
+	var list List
 	for {
 		fmt.Println("\n=================================================")
+		if list.Id != "" {
+			fmt.Printf("Working in list %q\n", list.Name)
+		}
 		selection := choseFromList(commandList)
+		ctx := WithTraceID(context.Background(), NewTraceID())
 		switch commandList[selection] {
 		case "exit":
-			os.Exit(0)
+			return
 		case "read":
-			cliRead(&dal)
+			cliRead(ctx, &dal, user, list.Id)
+		case "search":
+			cliSearch(ctx, &dal, user, list.Id)
+		case "next":
+			cliNext(ctx, &dal, user, list.Id)
 		case "add":
-			cliAdd(&dal)
+			cliAdd(ctx, &dal, user, list.Id)
 		case "delete":
-			cliDelete(&dal)
+			cliDelete(ctx, &dal, user, list.Id)
 		case "update":
-			cliUpdate(&dal)
+			cliUpdate(ctx, &dal, user, list.Id)
+		case "log in":
+			if loggedIn, ok := cliLogIn(ctx, auth); ok {
+				user = loggedIn
+				list = List{}
+				cliRemindOverdue(ctx, &dal, user)
+			}
+		case "log out":
+			user = AnonymousUser
+			list = List{}
+		case "create api key":
+			cliCreateAPIKey(ctx, auth, user)
+		case "list api keys":
+			cliListAPIKeys(ctx, auth, user)
+		case "revoke api key":
+			cliRevokeAPIKey(ctx, auth, user)
+		case "switch list":
+			if chosen, ok := cliSwitchList(ctx, &dal, user); ok {
+				list = chosen
+			}
+		case "create list":
+			if created, ok := cliCreateList(ctx, &dal, user); ok {
+				list = created
+			}
+		case "share list":
+			cliShareList(ctx, &dal, user, list.Id)
 		}
 	}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestFInput(t *testing.T) {
@@ -15,3 +16,34 @@ func TestFInput(t *testing.T) {
 		t.Errorf("want %q, got %q", want, got)
 	}
 }
+
+func TestFormatToDoItem(t *testing.T) {
+	item := ConstructToDoItem("Keep sanity", "high", false)
+	if got, want := formatToDoItem(item), "| Keep sanity | High | incomplete | no due date |\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	due := time.Date(2000, time.January, 31, 17, 0, 0, 0, time.UTC)
+	item.Due = &due
+	if got, want := formatToDoItem(item), "| Keep sanity | High | incomplete | due 2000-01-31 17:00 UTC (overdue) |\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	item.Tags = []Tag{"home", "urgent"}
+	if got, want := formatToDoItem(item), "| Keep sanity | High | incomplete | due 2000-01-31 17:00 UTC (overdue) | #home #urgent |\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	item.Tags = nil
+	item.Checklist = []SubItem{{"1", "Wake up", true}, {"2", "Stay calm", false}}
+	if got, want := formatToDoItem(item), "| Keep sanity | High | incomplete | due 2000-01-31 17:00 UTC (overdue) | 1/2 steps done |\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	item.Checklist = nil
+	item.BlockedBy = []Id{"1", "2"}
+	if got, want := formatToDoItem(item), "| Keep sanity | High | incomplete | due 2000-01-31 17:00 UTC (overdue) | blocked by 2 |\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	item.BlockedBy = nil
+	item.Recurrence = "FREQ=DAILY"
+	if got, want := formatToDoItem(item), "| Keep sanity | High | incomplete | due 2000-01-31 17:00 UTC (overdue) | repeats FREQ=DAILY |\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
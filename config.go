@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Store             string
+	JSONFile          string
+	JSONLockTimeout   time.Duration
+	JSONFlushInterval time.Duration
+	JSONAccountsFile  string
+	PostgresDSN       string
+	APIAddr           string
+	WebsiteAddr       string
+	WebsiteTemplate   string
+	API               bool
+	Website           bool
+	CLI               bool
+	SessionTTL        time.Duration
+	// Passed on to the DataAccessLayer as DALOptions
+	AutoCompleteChecklists bool
+}
+
+var dataStoreNames = []string{"memory", "json", "postgres"}
+
+// Every setting is a flag, the same name is used as a key in the config file
+// and, upper cased with a TODO_ prefix, as an environment variable
+func bindConfigFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.Store, "store", "json", "datastore to use, one of "+strings.Join(dataStoreNames, ", "))
+	fs.StringVar(&c.JSONFile, "json-file", "data.json", "file used by the json datastore")
+	fs.DurationVar(&c.JSONLockTimeout, "json-lock-timeout", 5*time.Second, "how long to wait for another process to release the json file, 0 fails fast")
+	fs.DurationVar(&c.JSONFlushInterval, "json-flush-interval", 0, "how often buffered writes are written to the json file, 0 writes every change straight away")
+	fs.StringVar(&c.JSONAccountsFile, "json-accounts-file", "accounts.json", "file user accounts are kept in by the json datastore")
+	fs.StringVar(&c.PostgresDSN, "postgres-dsn", "", "connection string used by the postgres datastore")
+	fs.StringVar(&c.APIAddr, "api-addr", ":8080", "address the REST API listens on")
+	fs.StringVar(&c.WebsiteAddr, "website-addr", ":6060", "address the website listens on")
+	fs.StringVar(&c.WebsiteTemplate, "website-template", "submission_form.html", "template served by the website")
+	fs.BoolVar(&c.API, "api", true, "start the REST API")
+	fs.BoolVar(&c.Website, "website", true, "start the website")
+	fs.BoolVar(&c.CLI, "cli", true, "start the CLI")
+	fs.DurationVar(&c.SessionTTL, "session-ttl", 24*time.Hour, "how long a log in lasts")
+	fs.BoolVar(&c.AutoCompleteChecklists, "auto-complete-checklists", true, "complete an item when every step of its checklist is complete")
+}
+
+func envName(flagName string) string {
+	return "TODO_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Builds a Config from, in increasing order of precedence, the defaults, the
+// config file named by -config or TODO_CONFIG, environment variables and flags
+func loadConfig(args []string, getenv func(string) string) (Config, error) {
+	var flagged Config
+	flags := flag.NewFlagSet("todo", flag.ContinueOnError)
+	bindConfigFlags(flags, &flagged)
+	configFile := flags.String("config", getenv("TODO_CONFIG"), "optional JSON config file, keyed by flag name")
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	var c Config
+	layered := flag.NewFlagSet("todo", flag.ContinueOnError)
+	layered.SetOutput(io.Discard)
+	bindConfigFlags(layered, &c)
+
+	if *configFile != "" {
+		if err := applyConfigFile(layered, *configFile); err != nil {
+			return Config{}, err
+		}
+	}
+	var err error
+	layered.VisitAll(func(f *flag.Flag) {
+		if value := getenv(envName(f.Name)); value != "" {
+			if setErr := layered.Set(f.Name, value); setErr != nil {
+				err = errors.Join(err, fmt.Errorf("%s: %w", envName(f.Name), setErr))
+			}
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			layered.Set(f.Name, f.Value.String())
+		}
+	})
+	return c, c.validate()
+}
+
+func applyConfigFile(fs *flag.FlagSet, fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	var settings map[string]any
+	if err = json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("config file %s: %w", fileName, err)
+	}
+	for name, value := range settings {
+		if fs.Lookup(name) == nil {
+			err = errors.Join(err, fmt.Errorf("config file %s: unknown setting %q", fileName, name))
+			continue
+		}
+		if setErr := fs.Set(name, fmt.Sprint(value)); setErr != nil {
+			err = errors.Join(err, fmt.Errorf("config file %s: %s: %w", fileName, name, setErr))
+		}
+	}
+	return err
+}
+
+// Reports every problem at once so they can all be fixed before a restart
+func (c Config) validate() error {
+	var err error
+	switch c.Store {
+	case "memory":
+	case "json":
+		if c.JSONFile == "" {
+			err = errors.Join(err, errors.New("json-file is required by the json datastore"))
+		}
+		if c.JSONAccountsFile == "" {
+			err = errors.Join(err, errors.New("json-accounts-file is required by the json datastore"))
+		} else if c.JSONAccountsFile == c.JSONFile {
+			err = errors.Join(err, errors.New("json-accounts-file and json-file must differ"))
+		}
+		if c.JSONLockTimeout < 0 {
+			err = errors.Join(err, errors.New("json-lock-timeout cannot be negative"))
+		}
+		if c.JSONFlushInterval < 0 {
+			err = errors.Join(err, errors.New("json-flush-interval cannot be negative"))
+		}
+	case "postgres":
+		if c.PostgresDSN == "" {
+			err = errors.Join(err, errors.New("postgres-dsn is required by the postgres datastore"))
+		}
+	default:
+		err = errors.Join(err, fmt.Errorf("unknown store %q, want one of %s", c.Store, strings.Join(dataStoreNames, ", ")))
+	}
+	if c.API {
+		if _, _, addrErr := net.SplitHostPort(c.APIAddr); addrErr != nil {
+			err = errors.Join(err, fmt.Errorf("api-addr: %w", addrErr))
+		}
+	}
+	if c.Website {
+		if _, _, addrErr := net.SplitHostPort(c.WebsiteAddr); addrErr != nil {
+			err = errors.Join(err, fmt.Errorf("website-addr: %w", addrErr))
+		}
+		if _, statErr := os.Stat(c.WebsiteTemplate); statErr != nil {
+			err = errors.Join(err, fmt.Errorf("website-template: %w", statErr))
+		}
+	}
+	if c.API && c.Website && c.APIAddr == c.WebsiteAddr {
+		err = errors.Join(err, errors.New("api-addr and website-addr must differ"))
+	}
+	if c.SessionTTL <= 0 {
+		err = errors.Join(err, errors.New("session-ttl must be positive"))
+	}
+	if !c.API && !c.Website && !c.CLI {
+		err = errors.Join(err, errors.New("at least one of api, website or cli must be started"))
+	}
+	return err
+}
+
+func newDataStore(ctx context.Context, c Config) (DataStore, error) {
+	switch c.Store {
+	case "memory":
+		db := newEmptyInMemoryDataStore()
+		return &db, nil
+	case "json":
+		return newJSONDataStore(c.JSONFile, c.JSONLockTimeout, c.JSONFlushInterval)
+	case "postgres":
+		db, err := newPostgresDataStore(ctx, c.PostgresDSN)
+		return db, err
+	default:
+		return nil, fmt.Errorf("unknown store %q", c.Store)
+	}
+}
+
+// Accounts are kept by the same kind of store as the todos in `db`, which
+// must have been opened by newDataStore with the same Config
+func newAccountStore(c Config, db DataStore) (AccountStore, error) {
+	switch c.Store {
+	case "memory":
+		return newInMemoryAccountStore(), nil
+	case "json":
+		return newJSONAccountStore(c.JSONAccountsFile, c.JSONLockTimeout), nil
+	case "postgres":
+		return db.(postgresDataStore), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", c.Store)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeEnv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		got, err := loadConfig(nil, fakeEnv(nil))
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		want := Config{"json", "data.json", 5 * time.Second, 0, "accounts.json", "", ":8080", ":6060", "submission_form.html", true, true, true, 24 * time.Hour, true}
+		if got != want {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	})
+	t.Run("Flags beat environment beats config file", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(configFile, []byte(`{"store": "memory", "api-addr": ":1", "website-addr": ":2", "cli": false}`), 0o644)
+		env := fakeEnv(map[string]string{
+			"TODO_CONFIG":       configFile,
+			"TODO_API_ADDR":     ":3",
+			"TODO_WEBSITE_ADDR": ":4",
+		})
+
+		got, err := loadConfig([]string{"-website-addr", ":5"}, env)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if got.Store != "memory" || got.CLI {
+			t.Errorf("config file not applied, got %v", got)
+		}
+		if got.APIAddr != ":3" {
+			t.Errorf("environment not applied, want %q got %q", ":3", got.APIAddr)
+		}
+		if got.WebsiteAddr != ":5" {
+			t.Errorf("flag not applied, want %q got %q", ":5", got.WebsiteAddr)
+		}
+	})
+	t.Run("Unknown config file setting", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(configFile, []byte(`{"colour": "red"}`), 0o644)
+
+		_, err := loadConfig([]string{"-config", configFile}, fakeEnv(nil))
+
+		if err == nil || !strings.Contains(err.Error(), "colour") {
+			t.Errorf("want unknown setting error, got %v", err)
+		}
+	})
+	t.Run("Bad environment value", func(t *testing.T) {
+		_, err := loadConfig(nil, fakeEnv(map[string]string{"TODO_API": "maybe"}))
+
+		if err == nil || !strings.Contains(err.Error(), "TODO_API") {
+			t.Errorf("want TODO_API error, got %v", err)
+		}
+	})
+}
+
+func TestValidateConfig(t *testing.T) {
+	t.Run("Every problem is reported", func(t *testing.T) {
+		_, err := loadConfig([]string{
+			"-store", "sqlite",
+			"-api-addr", "8080",
+			"-website-template", filepath.Join(t.TempDir(), "missing.html"),
+		}, fakeEnv(nil))
+
+		if err == nil {
+			t.Fatal("Error not thrown")
+		}
+		for _, want := range []string{"sqlite", "api-addr", "website-template"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%q missing from %q", want, err)
+			}
+		}
+	})
+	t.Run("Postgres needs a DSN", func(t *testing.T) {
+		_, err := loadConfig([]string{"-store", "postgres"}, fakeEnv(nil))
+
+		if err == nil || !strings.Contains(err.Error(), "postgres-dsn") {
+			t.Errorf("want postgres-dsn error, got %v", err)
+		}
+	})
+	t.Run("Something must be started", func(t *testing.T) {
+		_, err := loadConfig([]string{"-api=false", "-website=false", "-cli=false"}, fakeEnv(nil))
+
+		if err == nil {
+			t.Error("Error not thrown")
+		}
+	})
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readAll(t testing.TB, store DataStore) []ToDoItem {
+	t.Helper()
+	items, err := store.read(context.Background())
+	if err != nil {
+		t.Fatalf("could not read store! -> %v", err)
+	}
+	return items
+}
+
+// Behaviour every DataStore implementation must share. `newStore` must return
+// an empty store each time it is called
+func testDataStoreContract(t *testing.T, newStore func(t *testing.T) DataStore) {
+	ctx := context.Background()
+	t.Run("Add value to store", func(t *testing.T) {
+		store := newStore(t)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+
+		err := store.create(ctx, item)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if got := readAll(t, store); !equalSlicesNoOrder([]ToDoItem{item}, got) {
+			t.Errorf("want %v, got %v", []ToDoItem{item}, got)
+		}
+	})
+	t.Run("Add existing value to store", func(t *testing.T) {
+		store := newStore(t)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+		store.create(ctx, item)
+
+		err := store.create(ctx, item)
+
+		if err != ErrCannotCreate {
+			t.Errorf("want %v, got %v", ErrCannotCreate, err)
+		}
+	})
+	t.Run("Update value in store", func(t *testing.T) {
+		store := newStore(t)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+		store.create(ctx, item)
+		item.Complete = true
+		item.Version++
+
+		err := store.update(ctx, item)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if got := readAll(t, store); !equalSlicesNoOrder([]ToDoItem{item}, got) {
+			t.Errorf("want %v, got %v", []ToDoItem{item}, got)
+		}
+	})
+	t.Run("Update non-existent item in store", func(t *testing.T) {
+		store := newStore(t)
+
+		err := store.update(ctx, ConstructToDoItem("Keep sanity", "high", false))
+
+		if err != ErrCannotUpdate {
+			t.Errorf("want %v, got %v", ErrCannotUpdate, err)
+		}
+	})
+	t.Run("Deleting item", func(t *testing.T) {
+		store := newStore(t)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+		store.create(ctx, item)
+
+		err := store.delete(ctx, item)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if got := readAll(t, store); len(got) != 0 {
+			t.Errorf("item not deleted, got %v", got)
+		}
+	})
+	t.Run("Deleting non-existent item", func(t *testing.T) {
+		store := newStore(t)
+
+		err := store.delete(ctx, ConstructToDoItem("Keep sanity", "high", false))
+
+		if err != ErrCannotDelete {
+			t.Errorf("want %v, got %v", ErrCannotDelete, err)
+		}
+	})
+	t.Run("Reading datastore", func(t *testing.T) {
+		store := newStore(t)
+		items := populatedToDoList()
+		for _, item := range items {
+			store.create(ctx, item)
+		}
+
+		got, err := store.read(ctx)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if !equalSlicesNoOrder(items, got) {
+			t.Errorf("want %v, got %v", items, got)
+		}
+	})
+	t.Run("Getting item", func(t *testing.T) {
+		store := newStore(t)
+		items := populatedToDoList()
+		for _, item := range items {
+			store.create(ctx, item)
+		}
+
+		got, err := store.get(ctx, items[2].Id)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if !equalItems(got, items[2]) {
+			t.Errorf("want %v, got %v", items[2], got)
+		}
+	})
+	t.Run("Getting non-existent item", func(t *testing.T) {
+		store := newStore(t)
+
+		_, err := store.get(ctx, "Keep sanity")
+
+		if err != ErrCannotQuery {
+			t.Errorf("want %v, got %v", ErrCannotQuery, err)
+		}
+	})
+	t.Run("Owner is kept", func(t *testing.T) {
+		store := newStore(t)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+		item.Owner = "alice"
+		item.List = "groceries"
+		store.create(ctx, item)
+
+		got, err := store.get(ctx, item.Id)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if !equalItems(got, item) {
+			t.Errorf("want %v, got %v", item, got)
+		}
+	})
+	t.Run("Due date keeps its timezone", func(t *testing.T) {
+		store := newStore(t)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+		due := time.Date(2024, time.January, 31, 17, 0, 0, 0, time.FixedZone("", 5*60*60+30*60))
+		item.Due = &due
+		store.create(ctx, item)
+
+		got, err := store.get(ctx, item.Id)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if got.Due == nil || !got.Due.Equal(due) || got.Due.Format(time.RFC3339) != due.Format(time.RFC3339) {
+			t.Errorf("want %v, got %v", due, got.Due)
+		}
+	})
+	t.Run("Tags are kept and queried", func(t *testing.T) {
+		store := newStore(t)
+		both := ConstructToDoItem("Keep sanity", "high", false)
+		both.Tags = []Tag{"home", "urgent"}
+		home := ConstructToDoItem("Lose sanity", "high", false)
+		home.Tags = []Tag{"home"}
+		store.create(ctx, both)
+		store.create(ctx, home)
+		store.create(ctx, ConstructToDoItem("Find sanity", "high", false))
+
+		if got, err := store.get(ctx, both.Id); err != nil || !equalItems(got, both) {
+			t.Errorf("want %v, got %v %v", both, got, err)
+		}
+		q, _ := Query{Tags: []Tag{"urgent", "home"}, AllTags: true}.validate()
+		if got, err := store.query(ctx, q); err != nil || len(got.Items) != 1 || got.Items[0].Id != both.Id {
+			t.Errorf("all: want [%v], got %v %v", both, got.Items, err)
+		}
+		q.AllTags = false
+		if got, err := store.query(ctx, q); err != nil || len(got.Items) != 2 {
+			t.Errorf("any: want 2 items, got %v %v", got.Items, err)
+		}
+	})
+	t.Run("Checklist is kept in order", func(t *testing.T) {
+		store := newStore(t)
+		item := ConstructToDoItem("Finish go academy", "high", false)
+		item.Checklist = []SubItem{{"b", "Write the app", false}, {"a", "Read the book", true}}
+		store.create(ctx, item)
+		item.Checklist = append(item.Checklist, SubItem{"c", "Ship it", false})
+		item.Version++
+		store.update(ctx, item)
+
+		got, err := store.get(ctx, item.Id)
+
+		if err != nil || !equalItems(got, item) {
+			t.Errorf("want %v, got %v %v", item, got, err)
+		}
+	})
+	t.Run("Blockers are kept", func(t *testing.T) {
+		store := newStore(t)
+		item := ConstructToDoItem("Ship it", "high", false)
+		item.BlockedBy = []Id{"b", "a"}
+		store.create(ctx, item)
+
+		got, err := store.get(ctx, item.Id)
+
+		if err != nil || !equalItems(got, item) {
+			t.Errorf("want %v, got %v %v", item, got, err)
+		}
+	})
+	t.Run("Series are kept and queried", func(t *testing.T) {
+		store := newStore(t)
+		due := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+		item := ConstructToDoItem("Feed cats", "high", false)
+		item.Due, item.Recurrence, item.Series, item.Occurrence = &due, "FREQ=DAILY", "s", 2
+		store.create(ctx, item)
+		store.create(ctx, ConstructToDoItem("Walk dog", "low", false))
+
+		got, err := store.get(ctx, item.Id)
+		page, _ := store.query(ctx, Query{Series: "s"})
+
+		if err != nil || !equalItems(got, item) {
+			t.Errorf("want %v, got %v %v", item, got, err)
+		}
+		if len(page.Items) != 1 || page.Items[0].Id != item.Id {
+			t.Errorf("want only the item in the series, got %v", page.Items)
+		}
+	})
+	t.Run("Stamps are kept", func(t *testing.T) {
+		store := newStore(t)
+		item := stamp(ConstructToDoItem("Keep sanity", "high", true), nil, "alice", stampTime())
+		store.create(ctx, item)
+
+		got, err := store.get(ctx, item.Id)
+
+		if err != nil || !equalItems(got, item) {
+			t.Errorf("want %v, got %v %v", item, got, err)
+		}
+	})
+	t.Run("Queries", func(t *testing.T) {
+		store := newStore(t)
+		created := time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC)
+		var items []ToDoItem
+		for i, title := range []Title{"banana", "Apple", "cherry", "apple pie"} {
+			item := stamp(ConstructToDoItem(title, []Priority{"high", "low", "medium", "high"}[i], i%2 == 1), nil, AnonymousUser, created.Add(time.Duration(i)*time.Minute))
+			store.create(ctx, item)
+			items = append(items, item)
+		}
+		someoneElses := ConstructToDoItem("apple of someone else's eye", "high", false)
+		someoneElses.Owner = "alice"
+		store.create(ctx, someoneElses)
+		ids := func(page Page) []Id {
+			var got []Id
+			for _, item := range page.Items {
+				got = append(got, item.Id)
+			}
+			return got
+		}
+		tests := []struct {
+			name  string
+			query Query
+			want  []Id
+		}{
+			{"Everything, oldest first", Query{}, []Id{items[0].Id, items[1].Id, items[2].Id, items[3].Id}},
+			{"Title ignoring case", Query{TitleContains: "APPLE", Sort: SortTitle}, []Id{items[1].Id, items[3].Id}},
+			{"Complete", Query{Complete: func() *Complete { c := Complete(true); return &c }()}, []Id{items[1].Id, items[3].Id}},
+			{"Priority", Query{Priority: "High", Descending: true}, []Id{items[3].Id, items[0].Id}},
+		}
+		for _, test := range tests {
+			q, _ := test.query.validate()
+
+			got, err := store.query(ctx, q)
+
+			if err != nil || !reflect.DeepEqual(ids(got), test.want) {
+				t.Errorf("%s: want %v, got %v %v", test.name, test.want, ids(got), err)
+			}
+		}
+
+		q, _ := Query{Sort: SortPriority, Descending: true, Limit: 3}.validate()
+		first, err := store.query(ctx, q)
+		if err != nil || len(first.Items) != 3 || first.Next == "" {
+			t.Fatalf("want a full first page, got %v %v", first, err)
+		}
+		q.After = first.Next
+		q, _ = q.validate()
+		second, err := store.query(ctx, q)
+		if err != nil || len(second.Items) != 1 || second.Next != "" {
+			t.Fatalf("want a last page of one, got %v %v", second, err)
+		}
+		got := append(ids(first), ids(second)...)
+		want := ids(Query{Sort: SortPriority, Descending: true}.apply(items))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	})
+	t.Run("Search follows changes", func(t *testing.T) {
+		store := newStore(t)
+		cats := ConstructToDoItem("Feed cats", "high", false)
+		dog := ConstructToDoItem("Walk dog", "high", false)
+		store.create(ctx, cats)
+		store.create(ctx, dog)
+		dog.Title, dog.Version = "Walk cat", dog.Version+1
+		store.update(ctx, dog)
+		store.delete(ctx, cats)
+
+		got, err := store.search(ctx, "CAT")
+
+		if err != nil || len(got) != 1 || got[0].Id != dog.Id {
+			t.Errorf("want [%v], got %v %v", dog, got, err)
+		}
+		if got, _ := store.search(ctx, "feed"); len(got) != 0 {
+			t.Errorf("want nothing for a deleted item, got %v", got)
+		}
+	})
+	t.Run("Lists", func(t *testing.T) {
+		store := newStore(t)
+		list := List{"groceries", "Groceries", map[User]Role{"alice": RoleOwner}}
+
+		if err := store.createList(ctx, list); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if err := store.createList(ctx, list); err != ErrListExists {
+			t.Errorf("want %v, got %v", ErrListExists, err)
+		}
+		list.Members["bob"] = RoleViewer
+		if err := store.updateList(ctx, list); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		list.Members["carol"] = RoleEditor
+		got, err := store.getList(ctx, list.Id)
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		want := List{"groceries", "Groceries", map[User]Role{"alice": RoleOwner, "bob": RoleViewer}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, got %v", want, got)
+		}
+		if all, _ := store.readLists(ctx); !reflect.DeepEqual(all, []List{want}) {
+			t.Errorf("want %v, got %v", []List{want}, all)
+		}
+		if err = store.deleteList(ctx, list.Id); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if _, err = store.getList(ctx, list.Id); err != ErrNoList {
+			t.Errorf("want %v, got %v", ErrNoList, err)
+		}
+		if err = store.updateList(ctx, list); err != ErrNoList {
+			t.Errorf("want %v, got %v", ErrNoList, err)
+		}
+		if err = store.deleteList(ctx, list.Id); err != ErrNoList {
+			t.Errorf("want %v, got %v", ErrNoList, err)
+		}
+	})
+}
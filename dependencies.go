@@ -0,0 +1,228 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrDependencyCycle = errors.New("item would end up blocked by itself")
+var ErrBlocked = errors.New("item is blocked by items that are not complete")
+
+// A Dependency says Blocked cannot be completed until Blocker is
+type Dependency struct {
+	Blocker Id `json:"blocker"`
+	Blocked Id `json:"blocked"`
+}
+
+// The items an item is blocked by and blocks, directly or through others,
+// along with the item itself. Only items the reader can see are included
+type DependencyGraph struct {
+	Items        []ToDoItem   `json:"items"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+type forceKey struct{}
+
+// Lets writes made with the returned context complete items whose blockers
+// are still open
+func WithForce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceKey{}, true)
+}
+
+func forced(ctx context.Context) bool {
+	force, _ := ctx.Value(forceKey{}).(bool)
+	return force
+}
+
+// Drops repeats, keeping the first of each. Records it on `problems` if `item`
+// is blocked by itself
+func validateBlockedBy(item ToDoItem, problems *ValidationError) ([]Id, *ValidationError) {
+	var blockedBy []Id
+	for _, id := range item.BlockedBy {
+		if id == item.Id {
+			problems = problems.add("blocked_by", "cannot include the item itself")
+		}
+		if !slices.Contains(blockedBy, id) {
+			blockedBy = append(blockedBy, id)
+		}
+	}
+	return blockedBy, problems
+}
+
+// Whether `item` goes from open to complete. `existing` is nil for a new item
+func completing(item ToDoItem, existing *ToDoItem) bool {
+	return bool(item.Complete && (existing == nil || !existing.Complete))
+}
+
+// Gets `item` ready to be written over `existing`, which is nil for a new
+// item, keeping it in its series. Its blockers must be items `user` can see,
+// and must not be blocked by `item` themselves. An item with open blockers
+// cannot be completed unless the context is forced, completing the last step
+// of its checklist leaves it open instead
+func (d *DataAccessLayer) settle(ctx context.Context, user User, item ToDoItem, existing *ToDoItem) (ToDoItem, error) {
+	item = settleSeries(item, existing)
+	if err := d.checkBlockers(ctx, user, item, existing); err != nil {
+		return item, err
+	}
+	settled := d.settleChecklist(item, existing)
+	if !completing(settled, existing) || forced(ctx) {
+		return settled, nil
+	}
+	open, err := d.openBlockers(ctx, settled)
+	if err != nil || len(open) == 0 {
+		return settled, err
+	}
+	if completing(item, existing) {
+		return item, ErrBlocked
+	}
+	settled.Complete = false
+	return settled, nil
+}
+
+// Fails with a *ValidationError if `user` cannot see one of the blockers
+// added to the item since `existing`, or ErrDependencyCycle if one of its
+// blockers is blocked by the item, directly or through others. Blockers it
+// already had are not checked again, as they may since have been deleted
+func (d *DataAccessLayer) checkBlockers(ctx context.Context, user User, item ToDoItem, existing *ToDoItem) error {
+	for _, id := range item.BlockedBy {
+		if existing != nil && slices.Contains(existing.BlockedBy, id) {
+			continue
+		}
+		blocker, err := d.db.get(ctx, id)
+		if err == nil {
+			err = d.authorise(ctx, user, blocker, RoleViewer, ErrCannotQuery)
+		}
+		if errors.Is(err, ErrCannotQuery) {
+			return new(ValidationError).add("blocked_by", fmt.Sprintf("has %q which is not an item", id))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	seen := map[Id]bool{}
+	next := slices.Clone(item.BlockedBy)
+	for len(next) > 0 {
+		id := next[len(next)-1]
+		next = next[:len(next)-1]
+		if id == item.Id {
+			return ErrDependencyCycle
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		blocker, err := d.db.get(ctx, id)
+		if errors.Is(err, ErrCannotQuery) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		next = append(next, blocker.BlockedBy...)
+	}
+	return nil
+}
+
+// The Ids of the item's blockers that are not complete. Blockers that have
+// been deleted no longer block
+func (d *DataAccessLayer) openBlockers(ctx context.Context, item ToDoItem) ([]Id, error) {
+	var open []Id
+	for _, id := range item.BlockedBy {
+		blocker, err := d.db.get(ctx, id)
+		if errors.Is(err, ErrCannotQuery) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !blocker.Complete {
+			open = append(open, id)
+		}
+	}
+	return open, nil
+}
+
+// Cuts the incomplete items of `page`, which has every item a Query picks,
+// down to those with no open blockers, then pages them
+func (d *DataAccessLayer) actionable(ctx context.Context, q Query, page Page) (Page, error) {
+	var items []ToDoItem
+	for _, item := range page.Items {
+		open, err := d.openBlockers(ctx, item)
+		if err != nil {
+			return Page{}, err
+		}
+		if len(open) == 0 {
+			items = append(items, item)
+		}
+	}
+	return q.page(items), nil
+}
+
+// Returns item `id` with everything it is blocked by and everything it
+// blocks, directly or through others. Fails with ErrCannotQuery if `user`
+// cannot see it
+func (d DataAccessLayer) Dependencies(ctx context.Context, user User, id Id) (DependencyGraph, error) {
+	var graph DependencyGraph
+	err := d.transact(ctx, true, func(ctx context.Context, db DataStore) error {
+		item, err := db.get(ctx, id)
+		if err == nil {
+			err = d.authorise(ctx, user, item, RoleViewer, ErrCannotQuery)
+		}
+		if err != nil {
+			return err
+		}
+		all, err := db.read(ctx)
+		if err != nil {
+			return err
+		}
+		items := make(map[Id]ToDoItem, len(all))
+		blocks := map[Id][]Id{}
+		for _, other := range all {
+			items[other.Id] = other
+			for _, blocker := range other.BlockedBy {
+				blocks[blocker] = append(blocks[blocker], other.Id)
+			}
+		}
+		visible := map[Id]bool{id: true}
+		for _, follow := range []func(ToDoItem) []Id{
+			func(item ToDoItem) []Id { return item.BlockedBy },
+			func(item ToDoItem) []Id { return blocks[item.Id] },
+		} {
+			next := []Id{id}
+			for len(next) > 0 {
+				current := items[next[0]]
+				next = next[1:]
+				for _, linked := range follow(current) {
+					other, exists := items[linked]
+					if !exists || visible[linked] || d.authorise(ctx, user, other, RoleViewer, ErrCannotQuery) != nil {
+						continue
+					}
+					visible[linked] = true
+					next = append(next, linked)
+				}
+			}
+		}
+		slices.SortFunc(all, func(a, b ToDoItem) int {
+			return cmp.Or(cmp.Compare(sortKey(a, SortCreated), sortKey(b, SortCreated)), cmp.Compare(a.Id, b.Id))
+		})
+		for _, other := range all {
+			if !visible[other.Id] {
+				continue
+			}
+			graph.Items = append(graph.Items, other)
+			for _, blocker := range other.BlockedBy {
+				if visible[blocker] {
+					graph.Dependencies = append(graph.Dependencies, Dependency{blocker, other.Id})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return DependencyGraph{}, err
+	}
+	return graph, nil
+}
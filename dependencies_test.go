@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateBlockedBy(t *testing.T) {
+	item := ConstructToDoItem("Ship it", "high", false)
+	item.BlockedBy = []Id{"a", "b", "a"}
+
+	got, err := item.validate()
+
+	if err != nil || len(got.BlockedBy) != 2 || got.BlockedBy[0] != "a" || got.BlockedBy[1] != "b" {
+		t.Errorf("want repeats dropped, got %v %v", got.BlockedBy, err)
+	}
+	item.BlockedBy = []Id{item.Id}
+	var invalid *ValidationError
+	if _, err := item.validate(); !errors.As(err, &invalid) || invalid.Fields["blocked_by"] == "" {
+		t.Errorf("want a problem with blocked_by, got %v", err)
+	}
+}
+
+// Creates an item blocked by `blockedBy`
+func createBlocked(t *testing.T, dal DataAccessLayer, title Title, blockedBy ...Id) ToDoItem {
+	t.Helper()
+	item := ConstructToDoItem(title, "medium", false)
+	item.BlockedBy = blockedBy
+	created, err := dal.Create(context.Background(), AnonymousUser, item)
+	if err != nil {
+		t.Fatalf("Unexpected error thrown! Got: %v", err)
+	}
+	return created
+}
+
+func TestDependencies(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	read := createBlocked(t, dal, "Read the book")
+	write := createBlocked(t, dal, "Write the app", read.Id)
+	ship := createBlocked(t, dal, "Ship it", write.Id)
+	other := createBlocked(t, dal, "Walk dog")
+
+	t.Run("Unknown blocker", func(t *testing.T) {
+		item := ConstructToDoItem("Rest", "low", false)
+		item.BlockedBy = []Id{"nope"}
+		var invalid *ValidationError
+		if _, err := dal.Create(ctx, AnonymousUser, item); !errors.As(err, &invalid) {
+			t.Errorf("want a *ValidationError, got %v", err)
+		}
+	})
+	t.Run("Other users' items cannot block", func(t *testing.T) {
+		item := ConstructToDoItem("Rest", "low", false)
+		item.BlockedBy = []Id{read.Id}
+		var invalid *ValidationError
+		if _, err := dal.Create(ctx, "bob", item); !errors.As(err, &invalid) {
+			t.Errorf("want a *ValidationError, got %v", err)
+		}
+	})
+	t.Run("Cycles are refused", func(t *testing.T) {
+		read.BlockedBy = []Id{ship.Id}
+		if _, err := dal.Update(ctx, AnonymousUser, read); err != ErrDependencyCycle {
+			t.Errorf("want %v, got %v", ErrDependencyCycle, err)
+		}
+		_, err := dal.Patch(ctx, AnonymousUser, write.Id, 0, func(item *ToDoItem) error {
+			item.BlockedBy = append(item.BlockedBy, ship.Id)
+			return nil
+		})
+		if err != ErrDependencyCycle {
+			t.Errorf("want %v, got %v", ErrDependencyCycle, err)
+		}
+		read.BlockedBy = nil
+	})
+	t.Run("Graph", func(t *testing.T) {
+		graph, err := dal.Dependencies(ctx, AnonymousUser, write.Id)
+
+		if err != nil || len(graph.Items) != 3 || len(graph.Dependencies) != 2 {
+			t.Fatalf("want the three linked items and both dependencies, got %v %v", graph, err)
+		}
+		if graph.Dependencies[0] != (Dependency{read.Id, write.Id}) || graph.Dependencies[1] != (Dependency{write.Id, ship.Id}) {
+			t.Errorf("want the dependencies in the order items were created, got %v", graph.Dependencies)
+		}
+		if _, err := dal.Dependencies(ctx, "bob", write.Id); err != ErrCannotQuery {
+			t.Errorf("want %v, got %v", ErrCannotQuery, err)
+		}
+	})
+	t.Run("Next actionable", func(t *testing.T) {
+		page, err := dal.Query(ctx, AnonymousUser, Query{Actionable: true})
+
+		if err != nil || len(page.Items) != 2 || page.Items[0].Id != read.Id || page.Items[1].Id != other.Id {
+			t.Errorf("want only the unblocked items, got %v %v", page.Items, err)
+		}
+		page, _ = dal.Query(ctx, AnonymousUser, Query{Actionable: true, Limit: 1})
+		if len(page.Items) != 1 || page.Next == "" {
+			t.Errorf("want the first page and a cursor, got %v", page)
+		}
+		complete := Complete(true)
+		if _, err := dal.Query(ctx, AnonymousUser, Query{Actionable: true, Complete: &complete}); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("want %v, got %v", ErrInvalidQuery, err)
+		}
+	})
+	t.Run("Blocked items cannot be completed", func(t *testing.T) {
+		write.Complete = true
+		if _, err := dal.Update(ctx, AnonymousUser, write); err != ErrBlocked {
+			t.Errorf("want %v, got %v", ErrBlocked, err)
+		}
+
+		forced, err := dal.Update(WithForce(ctx), AnonymousUser, write)
+
+		if err != nil || !forced.Complete {
+			t.Errorf("want the item completed when forced, got %v %v", forced, err)
+		}
+		read.Complete = true
+		if _, err := dal.Update(ctx, AnonymousUser, read); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		ship.Complete = true
+		if _, err := dal.Update(ctx, AnonymousUser, ship); err != nil {
+			t.Errorf("want the item completed once its blockers are, got %v", err)
+		}
+	})
+	t.Run("Completing a blocked item's checklist leaves it open", func(t *testing.T) {
+		item := ConstructToDoItem("Tidy up", "low", false)
+		item.BlockedBy = []Id{other.Id}
+		item.Checklist = []SubItem{{Title: "Hoover"}}
+		item, _ = dal.Create(ctx, AnonymousUser, item)
+
+		toggled, err := dal.ToggleSubItem(ctx, AnonymousUser, item.Id, 0, item.Checklist[0].Id)
+
+		if err != nil || toggled.Complete || !toggled.Checklist[0].Complete {
+			t.Errorf("want the step complete and the item open, got %v %v", toggled, err)
+		}
+	})
+}
+
+func TestDeletedBlockers(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	read := createBlocked(t, dal, "Read the book")
+	write := createBlocked(t, dal, "Write the app", read.Id)
+	if err := dal.Delete(ctx, AnonymousUser, read); err != nil {
+		t.Fatalf("Unexpected error thrown! Got: %v", err)
+	}
+
+	patched, err := dal.Patch(ctx, AnonymousUser, write.Id, 0, func(item *ToDoItem) error {
+		item.Complete = true
+		return nil
+	})
+
+	if err != nil || !patched.Complete {
+		t.Errorf("want the item completed once its blocker is deleted, got %v %v", patched, err)
+	}
+	patched.Complete = false
+	if reopened, err := dal.Update(ctx, AnonymousUser, patched); err != nil || reopened.Complete {
+		t.Errorf("want the item still updatable, got %v %v", reopened, err)
+	}
+}
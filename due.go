@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Picks items by when they are due. The empty DueFilter picks everything
+type DueFilter string
+
+const (
+	DueAny      DueFilter = ""
+	DueOverdue  DueFilter = "overdue"
+	DueToday    DueFilter = "today"
+	DueThisWeek DueFilter = "this-week"
+)
+
+var ErrInvalidDueFilter = errors.New(`due must be "overdue", "today" or "this-week"`)
+
+func (f DueFilter) valid() bool {
+	return slices.Contains([]DueFilter{DueAny, DueOverdue, DueToday, DueThisWeek}, f)
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// Weeks start on Monday
+func startOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return startOfDay(t).AddDate(0, 0, -daysSinceMonday)
+}
+
+// Whether `item` is picked by the filter at `now`. Today and this week are
+// the day and week `now` falls in, in `now`'s location. Complete items are
+// never overdue
+func (f DueFilter) matches(item ToDoItem, now time.Time) bool {
+	if f == DueAny {
+		return true
+	}
+	if item.Due == nil {
+		return false
+	}
+	due := *item.Due
+	switch f {
+	case DueOverdue:
+		return !bool(item.Complete) && due.Before(now)
+	case DueToday, DueThisWeek:
+		start, end := f.window(now)
+		return !due.Before(start) && due.Before(end)
+	default:
+		return false
+	}
+}
+
+// When today or this week starts and ends, for the day or week `now` falls in
+func (f DueFilter) window(now time.Time) (time.Time, time.Time) {
+	if f == DueThisWeek {
+		start := startOfWeek(now)
+		return start, start.AddDate(0, 0, 7)
+	}
+	start := startOfDay(now)
+	return start, start.AddDate(0, 0, 1)
+}
+
+func (item ToDoItem) overdue(now time.Time) bool {
+	return DueOverdue.matches(item, now)
+}
+
+// As Read, but only returns the items `filter` picks at `now`
+func (d DataAccessLayer) ReadDue(ctx context.Context, user User, list ListId, filter DueFilter, now time.Time) ([]ToDoItem, error) {
+	page, err := d.Query(ctx, user, Query{List: list, Due: filter, Now: now})
+	return page.Items, err
+}
+
+const dueLayout = "2006-01-02 15:04 MST"
+
+func formatDue(item ToDoItem, now time.Time) string {
+	if item.Due == nil {
+		return "no due date"
+	}
+	formatted := "due " + item.Due.Format(dueLayout)
+	if item.overdue(now) {
+		formatted += " (overdue)"
+	}
+	return formatted
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func dueAt(t time.Time) *time.Time {
+	return &t
+}
+
+func TestDueFilterMatches(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	// A Wednesday
+	now := time.Date(2024, time.January, 31, 12, 0, 0, 0, london)
+	tests := []struct {
+		name     string
+		due      *time.Time
+		complete Complete
+		want     map[DueFilter]bool
+	}{
+		{"no due date", nil, false, map[DueFilter]bool{DueAny: true}},
+		{"earlier today", dueAt(now.Add(-time.Hour)), false, map[DueFilter]bool{DueAny: true, DueOverdue: true, DueToday: true, DueThisWeek: true}},
+		{"earlier today but complete", dueAt(now.Add(-time.Hour)), true, map[DueFilter]bool{DueAny: true, DueToday: true, DueThisWeek: true}},
+		{"later today", dueAt(now.Add(time.Hour)), false, map[DueFilter]bool{DueAny: true, DueToday: true, DueThisWeek: true}},
+		{"Monday", dueAt(time.Date(2024, time.January, 29, 0, 0, 0, 0, london)), false, map[DueFilter]bool{DueAny: true, DueOverdue: true, DueThisWeek: true}},
+		{"Sunday night", dueAt(time.Date(2024, time.February, 4, 23, 59, 0, 0, london)), false, map[DueFilter]bool{DueAny: true, DueThisWeek: true}},
+		{"next Monday", dueAt(time.Date(2024, time.February, 5, 0, 0, 0, 0, london)), false, map[DueFilter]bool{DueAny: true}},
+		{"tomorrow in Tokyo is today in London", dueAt(time.Date(2024, time.February, 1, 8, 0, 0, 0, time.FixedZone("JST", 9*60*60))), false, map[DueFilter]bool{DueAny: true, DueToday: true, DueThisWeek: true}},
+	}
+	for _, test := range tests {
+		item := ToDoItem{Title: "Keep sanity", Due: test.due, Complete: test.complete}
+		for _, filter := range []DueFilter{DueAny, DueOverdue, DueToday, DueThisWeek} {
+			if got := filter.matches(item, now); got != test.want[filter] {
+				t.Errorf("%s, %q: want %v, got %v", test.name, filter, test.want[filter], got)
+			}
+		}
+	}
+}
+
+func TestReadDue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	dal := NewEmptyDAL()
+	overdue := ConstructToDoItem("Keep sanity", "high", false)
+	overdue.Due = dueAt(now.Add(-48 * time.Hour).Truncate(time.Second))
+	later := ConstructToDoItem("Lose sanity", "high", false)
+	later.Due = dueAt(now.Add(48 * time.Hour).Truncate(time.Second))
+	dal.Create(ctx, AnonymousUser, overdue)
+	dal.Create(ctx, AnonymousUser, later)
+
+	t.Run("Overdue", func(t *testing.T) {
+		got, err := dal.ReadDue(ctx, AnonymousUser, "", DueOverdue, now)
+
+		if err != nil || len(got) != 1 || got[0].Id != overdue.Id {
+			t.Errorf("want [%v], got %v %v", overdue, got, err)
+		}
+	})
+	t.Run("Invalid filter", func(t *testing.T) {
+		if _, err := dal.ReadDue(ctx, AnonymousUser, "", "someday", now); err != ErrInvalidDueFilter {
+			t.Errorf("want %v, got %v", ErrInvalidDueFilter, err)
+		}
+	})
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Without flock the lock is the existence of `fileName`, so every lock is
+// exclusive and a crash can leave a stale lock file behind that has to be
+// removed by hand
+func tryLockFile(fileName string, exclusive bool) (*os.File, error) {
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, errLockHeld
+	}
+	return f, err
+}
+
+func unlockFile(f *os.File) error {
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func syncDir(dir string) error {
+	return nil
+}
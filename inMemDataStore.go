@@ -1,48 +1,135 @@
 package main
 
+import "context"
+
 type inMemoryDataStore struct {
-	data map[Id]ToDoItem
+	data  map[Id]ToDoItem
+	lists map[ListId]List
+	index *searchIndex
 }
 
 func newEmptyInMemoryDataStore() inMemoryDataStore {
 	return inMemoryDataStore{
 		make(map[Id]ToDoItem),
+		make(map[ListId]List),
+		newSearchIndex(nil),
 	}
 }
 
-func (d inMemoryDataStore) read() []ToDoItem {
+func (d inMemoryDataStore) read(ctx context.Context) ([]ToDoItem, error) {
 	var dataSlice []ToDoItem
 	for _, item := range d.data {
-		dataSlice = append(dataSlice, item)
+		dataSlice = append(dataSlice, item.clone())
+	}
+	return dataSlice, nil
+}
+
+func (d inMemoryDataStore) query(ctx context.Context, q Query) (Page, error) {
+	items, err := d.read(ctx)
+	return q.apply(items), err
+}
+
+// Stores made with only their data have no index, so one is made for the
+// search
+func (d inMemoryDataStore) search(ctx context.Context, text string) ([]ToDoItem, error) {
+	index := d.index
+	if index == nil {
+		index = newSearchIndex(d.data)
+	}
+	return itemsWithIds(d.data, index.search(text)), nil
+}
+
+func (d inMemoryDataStore) get(ctx context.Context, id Id) (ToDoItem, error) {
+	item, keyExists := d.data[id]
+	if !keyExists {
+		return ToDoItem{}, ErrCannotQuery
 	}
-	return dataSlice
+	return item.clone(), nil
 }
 
-func (d *inMemoryDataStore) delete(item ToDoItem) error {
+func (d *inMemoryDataStore) delete(ctx context.Context, item ToDoItem) error {
 	_, keyExists := d.data[item.Id]
 	if !keyExists {
 		return ErrCannotDelete
 	}
 	delete(d.data, item.Id)
+	if d.index != nil {
+		d.index.remove(item.Id)
+	}
 	return nil
 }
 
-func (d *inMemoryDataStore) update(item ToDoItem) error {
+func (d *inMemoryDataStore) update(ctx context.Context, item ToDoItem) error {
 	dataKey := item.Id
 	_, keyExists := d.data[dataKey]
 	if !keyExists {
 		return ErrCannotUpdate
 	}
-	d.data[dataKey] = item
+	d.data[dataKey] = item.clone()
+	if d.index != nil {
+		d.index.add(item)
+	}
 	return nil
 }
 
-func (d *inMemoryDataStore) create(item ToDoItem) error {
+func (d *inMemoryDataStore) create(ctx context.Context, item ToDoItem) error {
 	dataKey := item.Id
 	_, keyExists := d.data[dataKey]
 	if keyExists {
 		return ErrCannotCreate
 	}
-	d.data[dataKey] = item
+	d.data[dataKey] = item.clone()
+	if d.index != nil {
+		d.index.add(item)
+	}
+	return nil
+}
+
+// Lists are copied in and out so callers can never share a Members map with
+// the store
+func (d *inMemoryDataStore) createList(ctx context.Context, list List) error {
+	if _, exists := d.lists[list.Id]; exists {
+		return ErrListExists
+	}
+	if d.lists == nil {
+		d.lists = make(map[ListId]List)
+	}
+	d.lists[list.Id] = list.clone()
+	return nil
+}
+
+func (d inMemoryDataStore) readLists(ctx context.Context) ([]List, error) {
+	var lists []List
+	for _, list := range d.lists {
+		lists = append(lists, list.clone())
+	}
+	return lists, nil
+}
+
+func (d inMemoryDataStore) getList(ctx context.Context, id ListId) (List, error) {
+	list, exists := d.lists[id]
+	if !exists {
+		return List{}, ErrNoList
+	}
+	return list.clone(), nil
+}
+
+func (d *inMemoryDataStore) updateList(ctx context.Context, list List) error {
+	if _, exists := d.lists[list.Id]; !exists {
+		return ErrNoList
+	}
+	d.lists[list.Id] = list.clone()
+	return nil
+}
+
+func (d *inMemoryDataStore) deleteList(ctx context.Context, id ListId) error {
+	if _, exists := d.lists[id]; !exists {
+		return ErrNoList
+	}
+	delete(d.lists, id)
+	return nil
+}
+
+func (d *inMemoryDataStore) close() error {
 	return nil
 }
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestCreate(t *testing.T) {
@@ -19,11 +21,11 @@ func TestCreate(t *testing.T) {
 			t.Fatalf("setup failed! -> %v", err)
 		}
 		want := inMemoryDataStore{
-			data,
+			data: data,
 		}
 
-		store := inMemoryDataStore{make(map[Id]ToDoItem)}
-		store.create(item)
+		store := inMemoryDataStore{data: make(map[Id]ToDoItem)}
+		store.create(context.Background(), item)
 
 		if !reflect.DeepEqual(want.data, store.data) {
 			t.Errorf("want %v, got %v", want, store)
@@ -42,12 +44,12 @@ func TestCreate(t *testing.T) {
 			t.Fatalf("setup failed! -> %v", err)
 		}
 		want := inMemoryDataStore{
-			data,
+			data: data,
 		}
 
-		store := inMemoryDataStore{make(map[Id]ToDoItem)}
-		store.create(item)
-		err = store.create(item)
+		store := inMemoryDataStore{data: make(map[Id]ToDoItem)}
+		store.create(context.Background(), item)
+		err = store.create(context.Background(), item)
 
 		if err != ErrCannotCreate {
 			t.Fatal("Error not thrown")
@@ -75,12 +77,12 @@ func TestUpdate(t *testing.T) {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
 		want := inMemoryDataStore{
-			data,
+			data: data,
 		}
 
-		store := inMemoryDataStore{make(map[Id]ToDoItem)}
-		store.create(initialItem)
-		err := store.update(updateItem)
+		store := inMemoryDataStore{data: make(map[Id]ToDoItem)}
+		store.create(context.Background(), initialItem)
+		err := store.update(context.Background(), updateItem)
 
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
@@ -102,11 +104,11 @@ func TestUpdate(t *testing.T) {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
 		want := inMemoryDataStore{
-			data,
+			data: data,
 		}
 
-		store := inMemoryDataStore{make(map[Id]ToDoItem)}
-		err := store.update(item)
+		store := inMemoryDataStore{data: make(map[Id]ToDoItem)}
+		err := store.update(context.Background(), item)
 
 		if err != ErrCannotUpdate {
 			t.Fatal("Error not thrown")
@@ -130,12 +132,12 @@ func TestDelete(t *testing.T) {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
 		want := inMemoryDataStore{
-			data,
+			data: data,
 		}
 
-		store := inMemoryDataStore{make(map[Id]ToDoItem)}
-		store.create(item)
-		err := store.delete(item)
+		store := inMemoryDataStore{data: make(map[Id]ToDoItem)}
+		store.create(context.Background(), item)
+		err := store.delete(context.Background(), item)
 
 		if err != nil {
 			t.Errorf("Unexpected error thrown! Got: %v", err)
@@ -156,11 +158,11 @@ func TestDelete(t *testing.T) {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
 		want := inMemoryDataStore{
-			data,
+			data: data,
 		}
 
-		store := inMemoryDataStore{make(map[Id]ToDoItem)}
-		err := store.delete(item)
+		store := inMemoryDataStore{data: make(map[Id]ToDoItem)}
+		err := store.delete(context.Background(), item)
 
 		if err != ErrCannotDelete {
 			t.Fatal("Error not thrown")
@@ -180,10 +182,10 @@ func TestRead(t *testing.T) {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
 		store := inMemoryDataStore{
-			data,
+			data: data,
 		}
 
-		got := store.read()
+		got := readAll(t, &store)
 
 		if !equalSlicesNoOrder(items, got) {
 			t.Errorf("want %v, got %v", items, got)
@@ -191,6 +193,44 @@ func TestRead(t *testing.T) {
 	})
 }
 
+func TestGet(t *testing.T) {
+	t.Run("Getting item", func(t *testing.T) {
+		items := populatedToDoList()
+		dataErr, data := toDoMapper(items)
+		if dataErr != nil {
+			t.Fatalf("setup failed! -> %v", dataErr)
+		}
+		store := inMemoryDataStore{
+			data: data,
+		}
+
+		got, err := store.get(context.Background(), items[1].Id)
+
+		if err != nil {
+			t.Errorf("Unexpected error thrown! Got: %v", err)
+		}
+		if !equalItems(got, items[1]) {
+			t.Errorf("want %v, got %v", items[1], got)
+		}
+	})
+	t.Run("Getting non-existent item", func(t *testing.T) {
+		store := inMemoryDataStore{data: make(map[Id]ToDoItem)}
+
+		_, err := store.get(context.Background(), "Keep sanity")
+
+		if err != ErrCannotQuery {
+			t.Fatal("Error not thrown")
+		}
+	})
+}
+
+func TestInMemoryDataStoreContract(t *testing.T) {
+	testDataStoreContract(t, func(t *testing.T) DataStore {
+		db := newEmptyInMemoryDataStore()
+		return &db
+	})
+}
+
 func populatedToDoList() []ToDoItem {
 	titles := []string{
 		"keep sanity",
@@ -211,6 +251,24 @@ func populatedToDoList() []ToDoItem {
 	return items
 }
 
+// Items hold their times by pointer, so compare what they point at
+func equalItems(a, b ToDoItem) bool {
+	sameTime := func(x, y *time.Time) bool {
+		return x == y || (x != nil && y != nil && x.Equal(*y))
+	}
+	if !sameTime(a.Due, b.Due) || !sameTime(a.CreatedAt, b.CreatedAt) ||
+		!sameTime(a.UpdatedAt, b.UpdatedAt) || !sameTime(a.CompletedAt, b.CompletedAt) {
+		return false
+	}
+	a.Due, a.CreatedAt, a.UpdatedAt, a.CompletedAt = nil, nil, nil, nil
+	b.Due, b.CreatedAt, b.UpdatedAt, b.CompletedAt = nil, nil, nil, nil
+	// Stores may give back an empty set of tags as nil
+	if len(a.Tags) == 0 && len(b.Tags) == 0 {
+		a.Tags, b.Tags = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
 func equalData(a, b map[Id]ToDoItem) bool {
 	if len(a) != len(b) {
 		return false
@@ -219,7 +277,7 @@ func equalData(a, b map[Id]ToDoItem) bool {
 	for _, item := range a {
 		go func(i ToDoItem, c chan bool) {
 			for _, bItem := range b {
-				if bItem == i {
+				if equalItems(bItem, i) {
 					c <- true
 					return
 				}
@@ -230,7 +288,7 @@ func equalData(a, b map[Id]ToDoItem) bool {
 	for _, item := range b {
 		go func(i ToDoItem, c chan bool) {
 			for _, aItem := range a {
-				if aItem == i {
+				if equalItems(aItem, i) {
 					c <- true
 					return
 				}
@@ -254,12 +312,12 @@ func TestEqualData(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		a := inMemoryDataStore{data}
+		a := inMemoryDataStore{data: data}
 		dataErr, data = toDoMapper(items)
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		b := inMemoryDataStore{data}
+		b := inMemoryDataStore{data: data}
 		if !equalData(a.data, b.data) {
 			t.Errorf("Data was not considered equal! %v != %v", a.data, b.data)
 		}
@@ -270,12 +328,12 @@ func TestEqualData(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		a := inMemoryDataStore{data}
+		a := inMemoryDataStore{data: data}
 		dataErr, data = toDoMapper(items[:2])
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		b := inMemoryDataStore{data}
+		b := inMemoryDataStore{data: data}
 		if equalData(a.data, b.data) {
 			t.Errorf("Data was considered equal! %v == %v", a.data, b.data)
 		}
@@ -286,12 +344,12 @@ func TestEqualData(t *testing.T) {
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		a := inMemoryDataStore{data}
+		a := inMemoryDataStore{data: data}
 		dataErr, data = toDoMapper(append([]ToDoItem{items[1]}, items[:1]...))
 		if dataErr != nil {
 			t.Fatalf("setup failed! -> %v", dataErr)
 		}
-		b := inMemoryDataStore{data}
+		b := inMemoryDataStore{data: data}
 
 		if equalData(a.data, b.data) {
 			t.Errorf("Data was considered equal! %v == %v", a.data, b.data)
@@ -307,7 +365,7 @@ func equalSlicesNoOrder(a, b []ToDoItem) bool {
 	for _, item := range a {
 		go func(i ToDoItem, c chan bool) {
 			for _, bItem := range b {
-				if bItem == i {
+				if equalItems(bItem, i) {
 					c <- true
 					return
 				}
@@ -318,7 +376,7 @@ func equalSlicesNoOrder(a, b []ToDoItem) bool {
 	for _, item := range b {
 		go func(i ToDoItem, c chan bool) {
 			for _, aItem := range a {
-				if aItem == i {
+				if equalItems(aItem, i) {
 					c <- true
 					return
 				}
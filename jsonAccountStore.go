@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Keeps Accounts and their APIKeys in their own JSON file, next to the todos.
+// Accounts are only touched on registration, log in and when an APIKey is
+// used, so unlike jsonDataStore nothing is cached and every call reads the
+// file. The file is locked and written in the same way as the data file
+type jsonAccountStore struct {
+	mu          sync.Mutex
+	fileName    string
+	lockTimeout time.Duration
+}
+
+func newJSONAccountStore(fileName string, lockTimeout time.Duration) *jsonAccountStore {
+	return &jsonAccountStore{fileName: fileName, lockTimeout: lockTimeout}
+}
+
+func readAccountsFile(fileName string) (map[User]accountRecord, error) {
+	jsonData, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make(map[User]accountRecord)
+	if len(jsonData) == 0 {
+		return accounts, nil
+	}
+	err = json.Unmarshal(jsonData, &accounts)
+	return accounts, err
+}
+
+// Call with the file lock held
+func (s *jsonAccountStore) load() (map[User]accountRecord, error) {
+	accounts, err := readAccountsFile(s.fileName)
+	if err == nil {
+		return accounts, nil
+	}
+	accounts, backupErr := readAccountsFile(s.fileName + ".bak")
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && errors.Is(backupErr, fs.ErrNotExist):
+		return make(map[User]accountRecord), nil
+	case backupErr != nil:
+		return nil, &StorageError{"load accounts", errors.Join(err, backupErr)}
+	default:
+		return accounts, nil
+	}
+}
+
+// Calls `look` with the accounts as they are on disk
+func (s *jsonAccountStore) view(ctx context.Context, look func(accounts map[User]accountRecord) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockFile(ctx, s.fileName+".lock", false, s.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	accounts, err := s.load()
+	if err != nil {
+		return err
+	}
+	return look(accounts)
+}
+
+// Calls `change` with the accounts as they are on disk and, unless it fails,
+// writes back whatever it leaves behind
+func (s *jsonAccountStore) modify(ctx context.Context, change func(accounts map[User]accountRecord) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockFile(ctx, s.fileName+".lock", true, s.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	accounts, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err = change(accounts); err != nil {
+		return err
+	}
+	jsonNibbles, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return &StorageError{"place accounts", err}
+	}
+	err = replaceFile(s.fileName, jsonNibbles, func(fileName string) bool {
+		_, err := readAccountsFile(fileName)
+		return err == nil
+	})
+	if err != nil {
+		return &StorageError{"place accounts", err}
+	}
+	return nil
+}
+
+func (s *jsonAccountStore) createAccount(ctx context.Context, account Account) error {
+	return s.modify(ctx, func(accounts map[User]accountRecord) error {
+		if _, exists := accounts[account.Name]; exists {
+			return ErrAccountExists
+		}
+		accounts[account.Name] = accountRecord{Account: account}
+		return nil
+	})
+}
+
+func (s *jsonAccountStore) getAccount(ctx context.Context, name User) (Account, error) {
+	var account Account
+	err := s.view(ctx, func(accounts map[User]accountRecord) error {
+		record, exists := accounts[name]
+		if !exists {
+			return ErrNoAccount
+		}
+		account = record.Account
+		return nil
+	})
+	return account, err
+}
+
+func (s *jsonAccountStore) createAPIKey(ctx context.Context, owner User, key APIKey) error {
+	return s.modify(ctx, func(accounts map[User]accountRecord) error {
+		record, exists := accounts[owner]
+		if !exists {
+			return ErrNoAccount
+		}
+		record.APIKeys = append(record.APIKeys, key)
+		accounts[owner] = record
+		return nil
+	})
+}
+
+func (s *jsonAccountStore) listAPIKeys(ctx context.Context, owner User) ([]APIKey, error) {
+	var keys []APIKey
+	err := s.view(ctx, func(accounts map[User]accountRecord) error {
+		keys = slices.Clone(accounts[owner].APIKeys)
+		return nil
+	})
+	return keys, err
+}
+
+func (s *jsonAccountStore) deleteAPIKey(ctx context.Context, owner User, id string) error {
+	return s.modify(ctx, func(accounts map[User]accountRecord) error {
+		return removeAPIKey(accounts, owner, id)
+	})
+}
+
+func (s *jsonAccountStore) getAPIKey(ctx context.Context, id string) (User, APIKey, error) {
+	var owner User
+	var key APIKey
+	err := s.view(ctx, func(accounts map[User]accountRecord) error {
+		var err error
+		owner, key, err = findAPIKey(accounts, id)
+		return err
+	})
+	return owner, key, err
+}
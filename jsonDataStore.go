@@ -1,107 +1,570 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
 )
 
+var ErrDataStoreLocked = errors.New("datastore is locked by another process")
+var errLockHeld = errors.New("lock is held")
+
+const lockRetryInterval = 10 * time.Millisecond
+
+// Identifies a version of the data file without reading it
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(fileName string) fileStamp {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{info.ModTime(), info.Size()}
+}
+
+// The in memory map is the source of truth, the data file is only lifted again
+// when its modification time or size shows something else has changed it.
+//
+// With a zero `flushInterval` every write is placed before it returns. Otherwise
+// writes are collected in `pending` and placed every `flushInterval`, and on
+// close. Pending writes are replayed on top of any external change so neither
+// is lost.
+//
+// Every touch of the file holds an advisory lock on `fileName`.lock, so several
+// processes can safely share one data file. Lifts share the lock, places hold
+// it exclusively. A process that cannot get the lock within `lockTimeout` gives
+// up with ErrDataStoreLocked, a zero timeout fails fast
 type jsonDataStore struct {
-	data     map[Id]ToDoItem
-	fileName string
+	mu            sync.RWMutex
+	data          map[Id]ToDoItem
+	lists         map[ListId]List
+	pending       map[Id]*ToDoItem // nil marks a deletion
+	pendingLists  map[ListId]*List // nil marks a deletion
+	index         *searchIndex     // of data, rebuilt whenever it is lifted
+	seen          fileStamp
+	stale         bool
+	fileName      string
+	lockTimeout   time.Duration
+	flushInterval time.Duration
+	stopFlushing  chan struct{}
+	flusherDone   chan struct{}
 }
 
-func newJSONDataStore() jsonDataStore {
-	ds := jsonDataStore{
-		make(map[Id]ToDoItem),
-		"data.json",
+// Fails if the data file exists but neither it nor its backup can be read
+func newJSONDataStore(fileName string, lockTimeout time.Duration, flushInterval time.Duration) (*jsonDataStore, error) {
+	ds := &jsonDataStore{
+		data:          make(map[Id]ToDoItem),
+		lists:         make(map[ListId]List),
+		pending:       make(map[Id]*ToDoItem),
+		pendingLists:  make(map[ListId]*List),
+		index:         newSearchIndex(nil),
+		stale:         true,
+		fileName:      fileName,
+		lockTimeout:   lockTimeout,
+		flushInterval: flushInterval,
+		stopFlushing:  make(chan struct{}),
+		flusherDone:   make(chan struct{}),
+	}
+	ds.mu.Lock()
+	err := ds.refresh(context.Background())
+	ds.mu.Unlock()
+	if err != nil {
+		return ds, err
+	}
+	if flushInterval > 0 {
+		go ds.flushEvery(flushInterval)
+	} else {
+		close(ds.flusherDone)
 	}
-	ds.lift()
-	return ds
+	return ds, nil
 }
 
-func (d *jsonDataStore) lift() {
-	f, err := os.Open(d.fileName)
-	if err == nil {
-		defer f.Close()
-		jsonData, err := io.ReadAll(f)
-		if err != nil {
-			fmt.Printf("ERROR! %q\n", err)
+func (d *jsonDataStore) backupName() string {
+	return d.fileName + ".bak"
+}
+
+func (d *jsonDataStore) lock(ctx context.Context, exclusive bool) (func(), error) {
+	return lockFile(ctx, d.fileName+".lock", exclusive, d.lockTimeout)
+}
+
+// Retries until the advisory lock on `lockName` is taken or `timeout` passes.
+// Release the lock with the returned func
+func lockFile(ctx context.Context, lockName string, exclusive bool, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := tryLockFile(lockName, exclusive)
+		if err == nil {
+			return func() { unlockFile(f) }, nil
 		}
-		todos := make(map[Id]ToDoItem)
-		err = json.Unmarshal(jsonData, &todos)
-		if err != nil {
-			fmt.Printf("x: %q\n", err)
-			fmt.Printf("ERROR! %q\n", err)
+		if !errors.Is(err, errLockHeld) {
+			return nil, &StorageError{"lock", err}
 		}
-		if err != nil {
-			fmt.Printf("ERROR! %q\n", err)
+		if time.Now().After(deadline) {
+			return nil, &StorageError{"lock", ErrDataStoreLocked}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
 		}
-		d.data = todos
-	} else {
-		os.Create(d.fileName)
 	}
 }
 
-func (d *jsonDataStore) place() {
-	f, err := os.Create(d.fileName)
-	if err == nil {
-		defer f.Close()
-		jsonNibbles, err := json.MarshalIndent(d.data, "", "  ")
-		if err == nil {
-			_, err = f.Write(jsonNibbles)
-			if err != nil {
-				fmt.Printf("ERROR: %q\n", err)
-			}
+// The layout of the data file. Files written before there were lists hold
+// just the todos map, which is still read. Older files are brought up to
+// date by jsonMigrations
+type dataFile struct {
+	SchemaVersion int             `json:"schema_version"`
+	Todos         map[Id]ToDoItem `json:"todos"`
+	Lists         map[ListId]List `json:"lists"`
+}
+
+var errNewerSchema = errors.New("data file was written by a newer version of this app")
+
+func readDataFile(fileName string) (dataFile, error) {
+	contents := dataFile{0, make(map[Id]ToDoItem), make(map[ListId]List)}
+	jsonData, err := os.ReadFile(fileName)
+	if err != nil {
+		return contents, err
+	}
+	if len(jsonData) == 0 {
+		return contents, nil
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(jsonData, &fields); err != nil {
+		return contents, err
+	}
+	if _, current := fields["todos"]; !current && len(fields) > 0 {
+		err = json.Unmarshal(jsonData, &contents.Todos)
+		return contents, err
+	}
+	if err = json.Unmarshal(jsonData, &contents); err != nil {
+		return contents, err
+	}
+	if contents.Todos == nil {
+		contents.Todos = make(map[Id]ToDoItem)
+	}
+	if contents.Lists == nil {
+		contents.Lists = make(map[ListId]List)
+	}
+	if contents.SchemaVersion > currentSchemaVersion {
+		return contents, fmt.Errorf("%w: schema version %d, this app reads up to %d", errNewerSchema, contents.SchemaVersion, currentSchemaVersion)
+	}
+	return contents, nil
+}
+
+func readToDoFile(fileName string) (map[Id]ToDoItem, error) {
+	contents, err := readDataFile(fileName)
+	return contents.Todos, err
+}
+
+// Loads the data file, falling back to the backup kept by `place` if the data
+// file is missing or corrupt. A store with neither file starts empty.
+// Pending writes are replayed on top of whatever was loaded
+//
+// Call with `mu` and the file lock held
+func (d *jsonDataStore) lift(ctx context.Context) error {
+	stamp := statFile(d.fileName)
+	contents, err := readDataFile(d.fileName)
+	if err != nil {
+		var backupErr error
+		contents, backupErr = readDataFile(d.backupName())
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && errors.Is(backupErr, fs.ErrNotExist):
+			// Nothing to migrate, the first write makes a current file
+			contents.SchemaVersion = currentSchemaVersion
+		case backupErr != nil:
+			return &StorageError{"lift", errors.Join(err, backupErr)}
+		default:
+			slog.WarnContext(ctx, "recovered data file from backup", "file", d.fileName, "err", err, "items", len(contents.Todos))
+		}
+	}
+	if contents.SchemaVersion < currentSchemaVersion {
+		logAutomaticMigration(ctx, d.fileName, migrateDataFile(&contents, MigrationOptions{}))
+	}
+	replay(contents.Todos, d.pending)
+	replay(contents.Lists, d.pendingLists)
+	d.data = contents.Todos
+	d.lists = contents.Lists
+	d.index = newSearchIndex(d.data)
+	d.seen = stamp
+	d.stale = false
+	slog.DebugContext(ctx, "lifted data file", "file", d.fileName, "items", len(d.data), "lists", len(d.lists), "pending", d.pendingCount())
+	return nil
+}
+
+// Writes to a temporary file which is synced and then renamed over the data
+// file, so a crash part way through leaves the old contents in place rather
+// than a truncated file. The old contents, if they were intact, become the
+// backup
+//
+// Call with `mu` and the exclusive file lock held
+func (d *jsonDataStore) place(ctx context.Context) error {
+	if err := d.writeFile(); err != nil {
+		return &StorageError{"place", err}
+	}
+	d.seen = statFile(d.fileName)
+	clear(d.pending)
+	clear(d.pendingLists)
+	slog.DebugContext(ctx, "placed data file", "file", d.fileName, "items", len(d.data), "lists", len(d.lists))
+	return nil
+}
+
+func (d *jsonDataStore) pendingCount() int {
+	return len(d.pending) + len(d.pendingLists)
+}
+
+// Applies pending writes to what was lifted. A nil entry marks a deletion
+func replay[K comparable, V any](lifted map[K]V, pending map[K]*V) {
+	for key, value := range pending {
+		if value == nil {
+			delete(lifted, key)
 		} else {
-			fmt.Printf("ERROR: %q\n", err)
+			lifted[key] = *value
 		}
-	} else {
-		fmt.Printf("ERROR! %q\n", err)
 	}
 }
 
-func (d jsonDataStore) read() []ToDoItem {
-	d.lift()
-	var dataSlice []ToDoItem
-	for _, item := range d.data {
-		dataSlice = append(dataSlice, item)
+func (d *jsonDataStore) writeFile() error {
+	jsonNibbles, err := json.MarshalIndent(dataFile{currentSchemaVersion, d.data, d.lists}, "", "  ")
+	if err != nil {
+		return err
 	}
-	return dataSlice
+	return replaceFile(d.fileName, jsonNibbles, func(fileName string) bool {
+		_, err := readDataFile(fileName)
+		return err == nil
+	})
 }
 
-func (d *jsonDataStore) delete(item ToDoItem) error {
-	d.lift()
-	defer d.place()
-	_, keyExists := d.data[item.Id]
-	if !keyExists {
-		return ErrCannotDelete
+// Writes `data` to a temporary file which is synced and then renamed over
+// `fileName`. The old contents become `fileName`.bak, as long as `intact`
+// says they are worth keeping
+func replaceFile(fileName string, data []byte, intact func(fileName string) bool) error {
+	dir := filepath.Dir(fileName)
+	tmp, err := os.CreateTemp(dir, filepath.Base(fileName)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if intact(fileName) {
+		if err = os.Rename(fileName, fileName+".bak"); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(tmp.Name(), fileName); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// Call with `mu` held
+func (d *jsonDataStore) changedOnDisk() bool {
+	return d.stale || statFile(d.fileName) != d.seen
+}
+
+// Lifts the data file if it has changed on disk. Call with `mu` held for writing
+func (d *jsonDataStore) refresh(ctx context.Context) error {
+	if !d.changedOnDisk() {
+		return nil
+	}
+	unlock, err := d.lock(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err = d.lift(ctx); err != nil {
+		slog.ErrorContext(ctx, "could not lift data file", "file", d.fileName, "err", err)
+		return err
 	}
-	delete(d.data, item.Id)
 	return nil
 }
 
-func (d *jsonDataStore) update(item ToDoItem) error {
-	d.lift()
-	defer d.place()
-	dataKey := item.Id
-	_, keyExists := d.data[dataKey]
-	if !keyExists {
-		return ErrCannotUpdate
+// Places pending writes, first lifting the data file if it has changed on disk
+// so external changes are kept. Call with `mu` held for writing
+func (d *jsonDataStore) flush(ctx context.Context) error {
+	if d.pendingCount() == 0 {
+		return nil
+	}
+	unlock, err := d.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if d.changedOnDisk() {
+		if err = d.lift(ctx); err != nil {
+			slog.ErrorContext(ctx, "refusing to write over unreadable data file", "file", d.fileName, "err", err)
+			return err
+		}
+	}
+	if err = d.place(ctx); err != nil {
+		slog.ErrorContext(ctx, "could not place data file", "file", d.fileName, "err", err)
+		return err
 	}
-	d.data[dataKey] = item
 	return nil
 }
 
-func (d *jsonDataStore) create(item ToDoItem) error {
-	d.lift()
-	defer d.place()
-	dataKey := item.Id
-	_, keyExists := d.data[dataKey]
-	if keyExists {
-		return ErrCannotCreate
+func (d *jsonDataStore) flushEvery(interval time.Duration) {
+	defer close(d.flusherDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stopFlushing:
+			return
+		case <-ticker.C:
+			d.mu.Lock()
+			d.flush(context.Background())
+			d.mu.Unlock()
+		}
+	}
+}
+
+// Holds `mu` for reading over an up to date copy of the data, release it with
+// the returned func
+func (d *jsonDataStore) current(ctx context.Context) (func(), error) {
+	d.mu.RLock()
+	if !d.changedOnDisk() {
+		return d.mu.RUnlock, nil
+	}
+	d.mu.RUnlock()
+	d.mu.Lock()
+	err := d.refresh(ctx)
+	d.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	return d.mu.RUnlock, nil
+}
+
+// Runs `change` over an up to date copy of the data, then places whatever
+// it leaves pending
+func (d *jsonDataStore) modify(ctx context.Context, change func() error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.refresh(ctx); err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	if d.flushInterval > 0 {
+		return nil
+	}
+	if err := d.flush(ctx); err != nil {
+		// The data file still holds the old contents, so drop the write
+		// rather than let memory and disk disagree
+		clear(d.pending)
+		clear(d.pendingLists)
+		d.stale = true
+		return err
 	}
-	d.data[dataKey] = item
 	return nil
 }
+
+// Applies `change` to the item stored under `id`. `change` returns the new
+// item, or nil to delete it
+func (d *jsonDataStore) write(ctx context.Context, id Id, change func(existing ToDoItem, exists bool) (*ToDoItem, error)) error {
+	return d.modify(ctx, func() error {
+		existing, exists := d.data[id]
+		next, err := change(existing, exists)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			delete(d.data, id)
+			d.index.remove(id)
+		} else {
+			d.data[id] = *next
+			d.index.add(*next)
+		}
+		d.pending[id] = next
+		return nil
+	})
+}
+
+// As write, but for the List stored under `id`
+func (d *jsonDataStore) writeList(ctx context.Context, id ListId, change func(existing List, exists bool) (*List, error)) error {
+	return d.modify(ctx, func() error {
+		existing, exists := d.lists[id]
+		next, err := change(existing, exists)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			delete(d.lists, id)
+		} else {
+			d.lists[id] = next.clone()
+		}
+		d.pendingLists[id] = next
+		return nil
+	})
+}
+
+// Stops the background flusher and places any pending writes
+func (d *jsonDataStore) close() error {
+	select {
+	case <-d.stopFlushing:
+	default:
+		close(d.stopFlushing)
+	}
+	<-d.flusherDone
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.flush(context.Background())
+}
+
+func (d *jsonDataStore) read(ctx context.Context) ([]ToDoItem, error) {
+	release, err := d.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	var dataSlice []ToDoItem
+	for _, item := range d.data {
+		dataSlice = append(dataSlice, item.clone())
+	}
+	return dataSlice, nil
+}
+
+func (d *jsonDataStore) query(ctx context.Context, q Query) (Page, error) {
+	release, err := d.current(ctx)
+	if err != nil {
+		return Page{}, err
+	}
+	defer release()
+	page := q.apply(slices.Collect(maps.Values(d.data)))
+	for i, item := range page.Items {
+		page.Items[i] = item.clone()
+	}
+	return page, nil
+}
+
+func (d *jsonDataStore) search(ctx context.Context, text string) ([]ToDoItem, error) {
+	release, err := d.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return itemsWithIds(d.data, d.index.search(text)), nil
+}
+
+func (d *jsonDataStore) get(ctx context.Context, id Id) (ToDoItem, error) {
+	release, err := d.current(ctx)
+	if err != nil {
+		return ToDoItem{}, err
+	}
+	defer release()
+	item, keyExists := d.data[id]
+	if !keyExists {
+		return ToDoItem{}, ErrCannotQuery
+	}
+	return item.clone(), nil
+}
+
+func (d *jsonDataStore) delete(ctx context.Context, item ToDoItem) error {
+	return d.write(ctx, item.Id, func(existing ToDoItem, exists bool) (*ToDoItem, error) {
+		if !exists {
+			return nil, ErrCannotDelete
+		}
+		return nil, nil
+	})
+}
+
+func (d *jsonDataStore) update(ctx context.Context, item ToDoItem) error {
+	return d.write(ctx, item.Id, func(existing ToDoItem, exists bool) (*ToDoItem, error) {
+		if !exists {
+			return nil, ErrCannotUpdate
+		}
+		item = item.clone()
+		return &item, nil
+	})
+}
+
+func (d *jsonDataStore) create(ctx context.Context, item ToDoItem) error {
+	return d.write(ctx, item.Id, func(existing ToDoItem, exists bool) (*ToDoItem, error) {
+		if exists {
+			return nil, ErrCannotCreate
+		}
+		item = item.clone()
+		return &item, nil
+	})
+}
+
+func (d *jsonDataStore) createList(ctx context.Context, list List) error {
+	return d.writeList(ctx, list.Id, func(existing List, exists bool) (*List, error) {
+		if exists {
+			return nil, ErrListExists
+		}
+		list = list.clone()
+		return &list, nil
+	})
+}
+
+func (d *jsonDataStore) readLists(ctx context.Context) ([]List, error) {
+	release, err := d.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	var lists []List
+	for _, list := range d.lists {
+		lists = append(lists, list.clone())
+	}
+	return lists, nil
+}
+
+func (d *jsonDataStore) getList(ctx context.Context, id ListId) (List, error) {
+	release, err := d.current(ctx)
+	if err != nil {
+		return List{}, err
+	}
+	defer release()
+	list, exists := d.lists[id]
+	if !exists {
+		return List{}, ErrNoList
+	}
+	return list.clone(), nil
+}
+
+func (d *jsonDataStore) updateList(ctx context.Context, list List) error {
+	return d.writeList(ctx, list.Id, func(existing List, exists bool) (*List, error) {
+		if !exists {
+			return nil, ErrNoList
+		}
+		list = list.clone()
+		return &list, nil
+	})
+}
+
+func (d *jsonDataStore) deleteList(ctx context.Context, id ListId) error {
+	return d.writeList(ctx, id, func(existing List, exists bool) (*List, error) {
+		if !exists {
+			return nil, ErrNoList
+		}
+		return nil, nil
+	})
+}
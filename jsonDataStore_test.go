@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestJSONDataStore(t *testing.T) *jsonDataStore {
+	t.Helper()
+	db, err := newJSONDataStore(filepath.Join(t.TempDir(), "data.json"), 0, 0)
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	return db
+}
+
+func reopenJSONDataStore(t *testing.T, db *jsonDataStore, flushInterval time.Duration) *jsonDataStore {
+	t.Helper()
+	reopened, err := newJSONDataStore(db.fileName, 0, flushInterval)
+	if err != nil {
+		t.Fatalf("could not reopen store! -> %v", err)
+	}
+	t.Cleanup(func() { reopened.close() })
+	return reopened
+}
+
+func TestJSONDataStoreContract(t *testing.T) {
+	testDataStoreContract(t, func(t *testing.T) DataStore {
+		return newTestJSONDataStore(t)
+	})
+	t.Run("write-behind", func(t *testing.T) {
+		testDataStoreContract(t, func(t *testing.T) DataStore {
+			return reopenJSONDataStore(t, newTestJSONDataStore(t), time.Hour)
+		})
+	})
+}
+
+func TestJSONDataStorePlace(t *testing.T) {
+	t.Run("No temporary files are left behind", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		db.create(context.Background(), ConstructToDoItem("Keep sanity", "high", false))
+		db.create(context.Background(), ConstructToDoItem("Lose sanity", "high", false))
+
+		matches, _ := filepath.Glob(db.fileName + ".tmp-*")
+
+		if len(matches) != 0 {
+			t.Errorf("temporary files left behind: %v", matches)
+		}
+	})
+	t.Run("Failed writes leave the file alone", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+		db.create(context.Background(), item)
+		before, _ := os.ReadFile(db.fileName)
+
+		db.create(context.Background(), item)
+
+		after, _ := os.ReadFile(db.fileName)
+		if string(before) != string(after) {
+			t.Errorf("file changed by failed write")
+		}
+	})
+}
+
+func TestJSONDataStoreRecovery(t *testing.T) {
+	t.Run("Corrupt data file falls back to backup", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		kept := ConstructToDoItem("Keep sanity", "high", false)
+		db.create(context.Background(), kept)
+		db.create(context.Background(), ConstructToDoItem("Lose sanity", "high", false))
+		os.WriteFile(db.fileName, []byte(`{"half a`), 0o644)
+
+		reopened := reopenJSONDataStore(t, db, 0)
+
+		if got := readAll(t, reopened); !equalSlicesNoOrder([]ToDoItem{kept}, got) {
+			t.Errorf("want %v, got %v", []ToDoItem{kept}, got)
+		}
+	})
+	t.Run("Missing data file falls back to backup", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		kept := ConstructToDoItem("Keep sanity", "high", false)
+		db.create(context.Background(), kept)
+		db.create(context.Background(), ConstructToDoItem("Lose sanity", "high", false))
+		os.Remove(db.fileName)
+
+		reopened := reopenJSONDataStore(t, db, 0)
+
+		if got := readAll(t, reopened); !equalSlicesNoOrder([]ToDoItem{kept}, got) {
+			t.Errorf("want %v, got %v", []ToDoItem{kept}, got)
+		}
+	})
+	t.Run("Unreadable data file is not written over", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		os.WriteFile(db.fileName, []byte(`{"half a`), 0o644)
+
+		err := db.create(context.Background(), ConstructToDoItem("Keep sanity", "high", false))
+
+		if err == nil {
+			t.Error("Error not thrown")
+		}
+		if got, _ := os.ReadFile(db.fileName); string(got) != `{"half a` {
+			t.Errorf("unreadable file was written over, got %q", got)
+		}
+	})
+}
+
+func TestJSONDataStoreFormat(t *testing.T) {
+	t.Run("Files from before lists are read", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		item := ConstructToDoItem("Keep sanity", "High", false)
+		os.WriteFile(db.fileName, []byte(`{"`+string(item.Id)+`":{"id":"`+string(item.Id)+`","title":"Keep sanity","priority":"High","complete":false}}`), 0o644)
+
+		reopened := reopenJSONDataStore(t, db, 0)
+
+		if got := readAll(t, reopened); !equalSlicesNoOrder([]ToDoItem{item}, got) {
+			t.Errorf("want %v, got %v", []ToDoItem{item}, got)
+		}
+	})
+	t.Run("Lists are kept in the data file", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		list := List{"groceries", "Groceries", map[User]Role{"alice": RoleOwner}}
+		db.createList(context.Background(), list)
+
+		got, err := reopenJSONDataStore(t, db, 0).getList(context.Background(), list.Id)
+
+		if err != nil || got.Name != list.Name || got.Members["alice"] != RoleOwner {
+			t.Errorf("want %v, got %v %v", list, got, err)
+		}
+	})
+}
+
+func TestJSONDataStoreErrors(t *testing.T) {
+	t.Run("Malformed data file fails to open", func(t *testing.T) {
+		fileName := filepath.Join(t.TempDir(), "data.json")
+		os.WriteFile(fileName, []byte(`{"half a`), 0o644)
+
+		_, err := newJSONDataStore(fileName, 0, 0)
+
+		if !errors.As(err, new(*StorageError)) {
+			t.Errorf("want a StorageError, got %v", err)
+		}
+	})
+	t.Run("Malformed data file fails reads", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		os.WriteFile(db.fileName, []byte(`{"half a`), 0o644)
+
+		_, err := db.read(context.Background())
+
+		if !errors.As(err, new(*StorageError)) {
+			t.Errorf("want a StorageError, got %v", err)
+		}
+	})
+	t.Run("Failed write is returned", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		db.fileName = filepath.Join(t.TempDir(), "missing", "data.json")
+
+		err := db.create(context.Background(), ConstructToDoItem("Keep sanity", "high", false))
+
+		if !errors.As(err, new(*StorageError)) {
+			t.Errorf("want a StorageError, got %v", err)
+		}
+		os.MkdirAll(filepath.Dir(db.fileName), 0o755)
+		if got := readAll(t, db); len(got) != 0 {
+			t.Errorf("failed write kept in memory, got %v", got)
+		}
+	})
+}
+
+func TestJSONDataStoreCaching(t *testing.T) {
+	t.Run("External changes are picked up", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		other := reopenJSONDataStore(t, db, 0)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+		db.read(context.Background())
+
+		other.create(context.Background(), item)
+
+		if got := readAll(t, db); !equalSlicesNoOrder([]ToDoItem{item}, got) {
+			t.Errorf("want %v, got %v", []ToDoItem{item}, got)
+		}
+	})
+	t.Run("Writes are buffered until close", func(t *testing.T) {
+		db := reopenJSONDataStore(t, newTestJSONDataStore(t), time.Hour)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+
+		db.create(context.Background(), item)
+
+		if got, _ := readToDoFile(db.fileName); len(got) != 0 {
+			t.Errorf("write was not buffered, file holds %v", got)
+		}
+		if err := db.close(); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if got, _ := readToDoFile(db.fileName); !equalItems(got[item.Id], item) {
+			t.Errorf("write not flushed on close, file holds %v", got)
+		}
+	})
+	t.Run("Writes are flushed every interval", func(t *testing.T) {
+		db := reopenJSONDataStore(t, newTestJSONDataStore(t), 10*time.Millisecond)
+		item := ConstructToDoItem("Keep sanity", "high", false)
+
+		db.create(context.Background(), item)
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			if got, _ := readToDoFile(db.fileName); equalItems(got[item.Id], item) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("write never flushed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	t.Run("Buffered writes are kept alongside external changes", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		buffered := reopenJSONDataStore(t, db, time.Hour)
+		ours := ConstructToDoItem("Keep sanity", "high", false)
+		theirs := ConstructToDoItem("Lose sanity", "high", false)
+
+		buffered.create(context.Background(), ours)
+		db.create(context.Background(), theirs)
+		buffered.close()
+
+		got, _ := readToDoFile(db.fileName)
+		if !equalItems(got[ours.Id], ours) || !equalItems(got[theirs.Id], theirs) {
+			t.Errorf("want both %v and %v, file holds %v", ours, theirs, got)
+		}
+	})
+}
+
+// Compares serving reads from memory with lifting the whole file for every
+// operation, as the store used to
+func BenchmarkJSONDataStore(b *testing.B) {
+	ctx := context.Background()
+	setup := func(b *testing.B, flushInterval time.Duration) *jsonDataStore {
+		db, err := newJSONDataStore(filepath.Join(b.TempDir(), "data.json"), 0, flushInterval)
+		if err != nil {
+			b.Fatalf("setup failed! -> %v", err)
+		}
+		b.Cleanup(func() { db.close() })
+		for i := 0; i < 2000; i++ {
+			db.create(ctx, ConstructToDoItem("Keep sanity", "high", false))
+		}
+		db.close()
+		return db
+	}
+	b.Run("read cached", func(b *testing.B) {
+		db := setup(b, 0)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			db.read(ctx)
+		}
+	})
+	b.Run("read lifting every time", func(b *testing.B) {
+		db := setup(b, 0)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			db.stale = true
+			db.read(ctx)
+		}
+	})
+	b.Run("create write-through", func(b *testing.B) {
+		db := setup(b, 0)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			db.create(ctx, ConstructToDoItem("Keep sanity", "high", false))
+		}
+	})
+	b.Run("create write-behind", func(b *testing.B) {
+		db := setup(b, time.Hour)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			db.create(ctx, ConstructToDoItem("Keep sanity", "high", false))
+		}
+	})
+}
+
+func TestJSONDataStoreLocking(t *testing.T) {
+	t.Run("Fails fast while another process holds the lock", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		held, err := tryLockFile(db.fileName+".lock", true)
+		if err != nil {
+			t.Fatalf("setup failed! -> %v", err)
+		}
+		defer unlockFile(held)
+
+		err = db.create(context.Background(), ConstructToDoItem("Keep sanity", "high", false))
+
+		if !errors.Is(err, ErrDataStoreLocked) {
+			t.Errorf("want %v, got %v", ErrDataStoreLocked, err)
+		}
+	})
+	t.Run("Waits for another process to release the lock", func(t *testing.T) {
+		db := newTestJSONDataStore(t)
+		db.lockTimeout = time.Second
+		held, err := tryLockFile(db.fileName+".lock", true)
+		if err != nil {
+			t.Fatalf("setup failed! -> %v", err)
+		}
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			unlockFile(held)
+		}()
+
+		err = db.create(context.Background(), ConstructToDoItem("Keep sanity", "high", false))
+
+		if err != nil {
+			t.Errorf("Unexpected error thrown! Got: %v", err)
+		}
+	})
+}
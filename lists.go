@@ -0,0 +1,163 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+type ListId string
+
+// What a member of a List may do. Viewers can read its items, editors can
+// also change them and owners can also share and delete the List
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleOwner  Role = "owner"
+)
+
+var roleRanks = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+func (r Role) valid() bool {
+	return roleRanks[r] > 0
+}
+
+func (r Role) atLeast(min Role) bool {
+	return roleRanks[r] >= roleRanks[min]
+}
+
+// A named group of items shared between its Members. Every user also has a
+// personal list, the empty ListId, which only they can see
+type List struct {
+	Id      ListId        `json:"id"`
+	Name    string        `json:"name"`
+	Members map[User]Role `json:"members"`
+}
+
+var ErrNoList = errors.New("no list with that id exists")
+var ErrListExists = errors.New("cannot create list as it already exists in datastore")
+var ErrInvalidRole = errors.New(`role must be "viewer", "editor" or "owner"`)
+var ErrLastOwner = errors.New("a list must keep at least one owner")
+var ErrMissingListName = errors.New("list name is required")
+
+func (l List) clone() List {
+	l.Members = maps.Clone(l.Members)
+	return l
+}
+
+// Creates a List named `name` owned by `user`
+func (d DataAccessLayer) CreateList(ctx context.Context, user User, name string) (List, error) {
+	if name == "" {
+		return List{}, ErrMissingListName
+	}
+	list := List{ListId(uuid.NewString()), name, map[User]Role{user: RoleOwner}}
+	err := d.transact(ctx, false, func(ctx context.Context, db DataStore) error {
+		return db.createList(ctx, list)
+	})
+	return list, err
+}
+
+// Returns every List `user` is a member of, ordered by name
+func (d DataAccessLayer) Lists(ctx context.Context, user User) ([]List, error) {
+	var lists []List
+	err := d.transact(ctx, true, func(ctx context.Context, db DataStore) error {
+		all, err := db.readLists(ctx)
+		for _, list := range all {
+			if _, member := list.Members[user]; member {
+				lists = append(lists, list)
+			}
+		}
+		return err
+	})
+	slices.SortFunc(lists, func(a, b List) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Id, b.Id))
+	})
+	return lists, err
+}
+
+// Fails with ErrNoList unless `user` is a member of the List
+func (d DataAccessLayer) GetList(ctx context.Context, user User, id ListId) (List, error) {
+	var list List
+	err := d.transact(ctx, true, func(ctx context.Context, db DataStore) error {
+		var err error
+		list, err = d.listWithRole(ctx, user, id, RoleViewer)
+		return err
+	})
+	return list, err
+}
+
+// Gives `member` `role` on the List, replacing any role they already had.
+// Only owners can share a List
+func (d DataAccessLayer) ShareList(ctx context.Context, user User, id ListId, member User, role Role) (List, error) {
+	if !role.valid() {
+		return List{}, ErrInvalidRole
+	}
+	return d.changeMembers(ctx, user, id, RoleOwner, func(members map[User]Role) error {
+		members[member] = role
+		return nil
+	})
+}
+
+// Takes `member` off the List. Owners can remove anyone, everyone else can
+// only remove themselves
+func (d DataAccessLayer) UnshareList(ctx context.Context, user User, id ListId, member User) (List, error) {
+	min := RoleOwner
+	if member == user {
+		min = RoleViewer
+	}
+	return d.changeMembers(ctx, user, id, min, func(members map[User]Role) error {
+		if _, ok := members[member]; !ok {
+			return ErrNoList
+		}
+		delete(members, member)
+		return nil
+	})
+}
+
+func (d DataAccessLayer) changeMembers(ctx context.Context, user User, id ListId, min Role, change func(members map[User]Role) error) (List, error) {
+	var changed List
+	err := d.transact(ctx, false, func(ctx context.Context, db DataStore) error {
+		list, err := d.listWithRole(ctx, user, id, min)
+		if err != nil {
+			return err
+		}
+		list = list.clone()
+		if err = change(list.Members); err != nil {
+			return err
+		}
+		if !slices.Contains(slices.Collect(maps.Values(list.Members)), RoleOwner) {
+			return ErrLastOwner
+		}
+		changed = list
+		return db.updateList(ctx, list)
+	})
+	return changed, err
+}
+
+// Deletes the List along with every item in it. Only owners can delete a List
+func (d DataAccessLayer) DeleteList(ctx context.Context, user User, id ListId) error {
+	return d.transact(ctx, false, func(ctx context.Context, db DataStore) error {
+		if _, err := d.listWithRole(ctx, user, id, RoleOwner); err != nil {
+			return err
+		}
+		items, err := db.read(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if item.List != id {
+				continue
+			}
+			if err = db.delete(ctx, item); err != nil {
+				return err
+			}
+		}
+		return db.deleteList(ctx, id)
+	})
+}
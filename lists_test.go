@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newSharedList(t *testing.T, dal DataAccessLayer, members map[User]Role) List {
+	t.Helper()
+	ctx := context.Background()
+	list, err := dal.CreateList(ctx, "alice", "Groceries")
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	for member, role := range members {
+		if list, err = dal.ShareList(ctx, "alice", list.Id, member, role); err != nil {
+			t.Fatalf("setup failed! -> %v", err)
+		}
+	}
+	return list
+}
+
+func TestListRoles(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	list := newSharedList(t, dal, map[User]Role{"bob": RoleViewer, "carol": RoleEditor})
+	item := ConstructToDoItem("Buy milk", "high", false)
+	item.List = list.Id
+	item, err := dal.Create(ctx, "alice", item)
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+
+	t.Run("Members can read", func(t *testing.T) {
+		for _, user := range []User{"alice", "bob", "carol"} {
+			items, err := dal.Read(ctx, user, list.Id)
+			if err != nil || len(items) != 1 || !equalItems(items[0], item) {
+				t.Errorf("%s: want %v, got %v %v", user, []ToDoItem{item}, items, err)
+			}
+			if got, err := dal.Get(ctx, user, item.Id); !equalItems(got, item) {
+				t.Errorf("%s: want %v, got %v %v", user, item, got, err)
+			}
+		}
+	})
+	t.Run("Shared items are not in the personal list", func(t *testing.T) {
+		if items, _ := dal.Read(ctx, "alice", ""); len(items) != 0 {
+			t.Errorf("want no items, got %v", items)
+		}
+	})
+	t.Run("Non-members cannot see the list", func(t *testing.T) {
+		if _, err := dal.Read(ctx, "dave", list.Id); err != ErrNoList {
+			t.Errorf("want %v, got %v", ErrNoList, err)
+		}
+		if _, err := dal.Get(ctx, "dave", item.Id); err != ErrCannotQuery {
+			t.Errorf("want %v, got %v", ErrCannotQuery, err)
+		}
+		if _, err := dal.Update(ctx, "dave", item); err != ErrCannotUpdate {
+			t.Errorf("want %v, got %v", ErrCannotUpdate, err)
+		}
+		if _, err := dal.GetList(ctx, "dave", list.Id); err != ErrNoList {
+			t.Errorf("want %v, got %v", ErrNoList, err)
+		}
+	})
+	t.Run("Viewers cannot write", func(t *testing.T) {
+		added := ConstructToDoItem("Buy bread", "high", false)
+		added.List = list.Id
+		if _, err := dal.Create(ctx, "bob", added); err != ErrForbidden {
+			t.Errorf("want %v, got %v", ErrForbidden, err)
+		}
+		if _, err := dal.Update(ctx, "bob", item); err != ErrForbidden {
+			t.Errorf("want %v, got %v", ErrForbidden, err)
+		}
+		if err := dal.Delete(ctx, "bob", item); err != ErrForbidden {
+			t.Errorf("want %v, got %v", ErrForbidden, err)
+		}
+	})
+	t.Run("Editors can write but not share", func(t *testing.T) {
+		updated := item
+		updated.Complete = true
+		updated.List = ""
+		if _, err := dal.Update(ctx, "carol", updated); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if got, _ := dal.Get(ctx, "alice", item.Id); !bool(got.Complete) || got.List != list.Id || got.Owner != "alice" {
+			t.Errorf("want the item completed and left in place, got %v", got)
+		}
+		if _, err := dal.ShareList(ctx, "carol", list.Id, "dave", RoleViewer); err != ErrForbidden {
+			t.Errorf("want %v, got %v", ErrForbidden, err)
+		}
+		if err := dal.DeleteList(ctx, "carol", list.Id); err != ErrForbidden {
+			t.Errorf("want %v, got %v", ErrForbidden, err)
+		}
+	})
+	t.Run("Lists only shows the user's lists", func(t *testing.T) {
+		if lists, _ := dal.Lists(ctx, "bob"); len(lists) != 1 || lists[0].Id != list.Id {
+			t.Errorf("want [%v], got %v", list, lists)
+		}
+		if lists, _ := dal.Lists(ctx, "dave"); len(lists) != 0 {
+			t.Errorf("want no lists, got %v", lists)
+		}
+	})
+}
+
+func TestListMembership(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Invalid role", func(t *testing.T) {
+		dal := NewEmptyDAL()
+		list := newSharedList(t, dal, nil)
+
+		if _, err := dal.ShareList(ctx, "alice", list.Id, "bob", "admin"); err != ErrInvalidRole {
+			t.Errorf("want %v, got %v", ErrInvalidRole, err)
+		}
+	})
+	t.Run("Missing name", func(t *testing.T) {
+		if _, err := NewEmptyDAL().CreateList(ctx, "alice", ""); err != ErrMissingListName {
+			t.Errorf("want %v, got %v", ErrMissingListName, err)
+		}
+	})
+	t.Run("The last owner cannot leave", func(t *testing.T) {
+		dal := NewEmptyDAL()
+		list := newSharedList(t, dal, map[User]Role{"bob": RoleEditor})
+
+		if _, err := dal.UnshareList(ctx, "alice", list.Id, "alice"); err != ErrLastOwner {
+			t.Errorf("want %v, got %v", ErrLastOwner, err)
+		}
+		if _, err := dal.ShareList(ctx, "alice", list.Id, "alice", RoleViewer); err != ErrLastOwner {
+			t.Errorf("want %v, got %v", ErrLastOwner, err)
+		}
+	})
+	t.Run("Members can leave", func(t *testing.T) {
+		dal := NewEmptyDAL()
+		list := newSharedList(t, dal, map[User]Role{"bob": RoleViewer, "carol": RoleViewer})
+
+		if _, err := dal.UnshareList(ctx, "bob", list.Id, "carol"); err != ErrForbidden {
+			t.Errorf("want %v, got %v", ErrForbidden, err)
+		}
+		if _, err := dal.UnshareList(ctx, "bob", list.Id, "bob"); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if _, err := dal.Read(ctx, "bob", list.Id); err != ErrNoList {
+			t.Errorf("want %v, got %v", ErrNoList, err)
+		}
+	})
+	t.Run("Deleting a list deletes its items", func(t *testing.T) {
+		dal := NewEmptyDAL()
+		list := newSharedList(t, dal, nil)
+		shared := ConstructToDoItem("Buy milk", "high", false)
+		shared.List = list.Id
+		personal := ConstructToDoItem("Keep sanity", "high", false)
+		dal.Create(ctx, "alice", shared)
+		dal.Create(ctx, "alice", personal)
+
+		if err := dal.DeleteList(ctx, "alice", list.Id); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if _, err := dal.Get(ctx, "alice", shared.Id); err != ErrCannotQuery {
+			t.Errorf("want %v, got %v", ErrCannotQuery, err)
+		}
+		if _, err := dal.Get(ctx, "alice", personal.Id); err != nil {
+			t.Errorf("personal item deleted with the list, got %v", err)
+		}
+		if _, err := dal.GetList(ctx, "alice", list.Id); !errors.Is(err, ErrNoList) {
+			t.Errorf("want %v, got %v", ErrNoList, err)
+		}
+	})
+}
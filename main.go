@@ -1,14 +1,84 @@
 package main
 
-// import (
-// 	"fmt"
-// )
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const shutdownTimeout = 10 * time.Second
 
 func main() {
-	// db := inMemoryDataStore{make(map[Id]ToDoItem)}
-	db := newJSONDataStore()
-	dal := NewDataAccessLayer(&db)
-	go StartAPI(dal)
-	go ServeWebsite(dal)
-	RunCli(dal)
+	slog.SetDefault(slog.New(newTraceHandler(slog.NewTextHandler(os.Stderr, nil))))
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(context.Background(), os.Args[2:], os.Stdout, os.Stderr))
+	}
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	db, err := newDataStore(context.Background(), cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open %s datastore: %v\n", cfg.Store, err)
+		os.Exit(1)
+	}
+	accounts, err := newAccountStore(cfg, db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open %s account store: %v\n", cfg.Store, err)
+		os.Exit(1)
+	}
+	auth := NewAuth(accounts, cfg.SessionTTL)
+	dal := NewDataAccessLayerWithOptions(db, DALOptions{AutoCompleteChecklists: cfg.AutoCompleteChecklists})
+
+	// Closing the DAL flushes anything the DataStore is still holding on to
+	shutdown := func(code int) {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := dal.Close(ctx); err != nil {
+			slog.Error("could not close datastore", "err", err)
+			code = 1
+		}
+		os.Exit(code)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		slog.Info("shutting down", "signal", <-signals)
+		shutdown(0)
+	}()
+
+	stopped := make(chan error)
+	if cfg.API {
+		go func() {
+			stopped <- fmt.Errorf("api: %w", StartAPI(dal, auth, cfg.APIAddr))
+		}()
+	}
+	if cfg.Website {
+		go func() {
+			stopped <- fmt.Errorf("website: %w", ServeWebsite(dal, auth, cfg.WebsiteAddr, cfg.WebsiteTemplate))
+		}()
+	}
+	if cfg.CLI {
+		go func() {
+			for err := range stopped {
+				slog.Error("server stopped", "err", err)
+			}
+		}()
+		RunCli(dal, auth)
+		shutdown(0)
+	} else {
+		slog.Error("server stopped", "err", <-stopped)
+		shutdown(1)
+	}
 }
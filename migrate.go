@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Each entry upgrades a data file from the version it is indexed by to the
+// next, and is applied automatically whenever an older file is lifted. Never
+// edit an entry once it has been released, append a new one instead
+var jsonMigrations = []func(contents *dataFile, opts MigrationOptions, report *MigrationReport){
+	normaliseRecords,
+}
+
+// The version written into the schema_version header of every data file.
+// Files without one are version 0
+var currentSchemaVersion = len(jsonMigrations)
+
+// How records that break the rules in validation.go are fixed. The zero value
+// fixes only what can be fixed without guessing, which is what lift uses
+type MigrationOptions struct {
+	// Free text priorities, matched ignoring case and surrounding space, and
+	// the Priority each becomes
+	Priorities map[string]Priority
+	// Given to priorities that are not allowed and not in Priorities. Empty
+	// leaves them as they are
+	FallbackPriority Priority
+	// Gives items whose Id is not a UUID a new one
+	RegenerateIds bool
+}
+
+// Something wrong with a record, and what was done about it
+type MigrationProblem struct {
+	Id      Id
+	Field   string
+	Value   string
+	Problem string
+	// What the field was changed to, empty if it was left as it is
+	FixedTo string
+}
+
+type MigrationReport struct {
+	From     int
+	To       int
+	Records  int
+	Problems []MigrationProblem
+}
+
+// The problems that were left as they are
+func (r MigrationReport) unfixed() int {
+	count := 0
+	for _, problem := range r.Problems {
+		if problem.FixedTo == "" {
+			count++
+		}
+	}
+	return count
+}
+
+// Brings `contents` up to currentSchemaVersion, reporting every record that
+// had to change or still breaks the rules
+func migrateDataFile(contents *dataFile, opts MigrationOptions) MigrationReport {
+	report := MigrationReport{From: contents.SchemaVersion, To: currentSchemaVersion, Records: len(contents.Todos)}
+	for ; contents.SchemaVersion < currentSchemaVersion; contents.SchemaVersion++ {
+		jsonMigrations[contents.SchemaVersion](contents, opts, &report)
+	}
+	return report
+}
+
+// Version 1 checks every record against the rules in validation.go. Items
+// that refer to an id that is regenerated are pointed at the new one
+func normaliseRecords(contents *dataFile, opts MigrationOptions, report *MigrationReport) {
+	migrated := make(map[Id]ToDoItem, len(contents.Todos))
+	regenerated := map[Id]Id{}
+	for _, key := range slices.Sorted(maps.Keys(contents.Todos)) {
+		item := contents.Todos[key]
+		problem := func(field, value, what, fixedTo string) {
+			report.Problems = append(report.Problems, MigrationProblem{item.Id, field, value, what, fixedTo})
+		}
+		if item.Id != key {
+			problem("id", string(item.Id), "does not match the key it is stored under", string(key))
+			item.Id = key
+		}
+		if err := uuid.Validate(string(item.Id)); err != nil {
+			fixedTo := ""
+			if opts.RegenerateIds {
+				fixedTo = uuid.NewString()
+			}
+			problem("id", string(item.Id), "is not a UUID", fixedTo)
+			if fixedTo != "" {
+				regenerated[item.Id] = Id(fixedTo)
+				item.Id = Id(fixedTo)
+			}
+		}
+		if title := Title(strings.TrimSpace(string(item.Title))); title == "" {
+			problem("title", string(item.Title), "is required", "")
+		} else if title != item.Title {
+			problem("title", string(item.Title), "has surrounding space", string(title))
+			item.Title = title
+		}
+		if priority := opts.mapPriority(item.Priority); priority != item.Priority {
+			problem("priority", string(item.Priority), "is not Low, Medium or High", string(priority))
+			item.Priority = priority
+		} else if _, ok := priority.normalise(); !ok {
+			problem("priority", string(item.Priority), "is not Low, Medium or High", "")
+		}
+		migrated[item.Id] = item
+	}
+	for id, item := range migrated {
+		for i, blocker := range item.BlockedBy {
+			if renamed, ok := regenerated[blocker]; ok {
+				item.BlockedBy[i] = renamed
+			}
+		}
+		if renamed, ok := regenerated[item.Series]; ok {
+			item.Series = renamed
+		}
+		migrated[id] = item
+	}
+	contents.Todos = migrated
+}
+
+// Returns the allowed Priority `p` should become, or `p` itself if there is
+// no telling
+func (opts MigrationOptions) mapPriority(p Priority) Priority {
+	if normalised, ok := p.normalise(); ok {
+		return normalised
+	}
+	for text, mapped := range opts.Priorities {
+		if strings.EqualFold(strings.TrimSpace(text), strings.TrimSpace(string(p))) {
+			return mapped
+		}
+	}
+	if opts.FallbackPriority != "" {
+		return opts.FallbackPriority
+	}
+	return p
+}
+
+// Migrates the data file `fileName` in place, holding its lock throughout.
+// The file it replaces is kept as the backup. Nothing is written if
+// `dryRun` is set
+func MigrateJSONFile(ctx context.Context, fileName string, opts MigrationOptions, dryRun bool, lockTimeout time.Duration) (MigrationReport, error) {
+	unlock, err := lockFile(ctx, fileName+".lock", true, lockTimeout)
+	if err != nil {
+		return MigrationReport{}, err
+	}
+	defer unlock()
+	contents, err := readDataFile(fileName)
+	if err != nil {
+		return MigrationReport{}, &StorageError{"read data file", err}
+	}
+	report := migrateDataFile(&contents, opts)
+	if report.From == report.To {
+		// Already up to date, but the records can still be checked
+		normaliseRecords(&contents, opts, &report)
+	}
+	if dryRun {
+		return report, nil
+	}
+	jsonNibbles, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return report, &StorageError{"place data file", err}
+	}
+	err = replaceFile(fileName, jsonNibbles, func(fileName string) bool {
+		_, err := readDataFile(fileName)
+		return err == nil
+	})
+	if err != nil {
+		return report, &StorageError{"place data file", err}
+	}
+	return report, nil
+}
+
+func formatMigrationProblem(problem MigrationProblem) string {
+	fixedTo := "left as it is"
+	if problem.FixedTo != "" {
+		fixedTo = fmt.Sprintf("fixed to %q", problem.FixedTo)
+	}
+	return fmt.Sprintf("| %s | %s %q %s | %s |\n", problem.Id, problem.Field, problem.Value, problem.Problem, fixedTo)
+}
+
+// Runs `todo migrate`, returning the exit code
+func runMigrate(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	opts := MigrationOptions{Priorities: make(map[string]Priority)}
+	flags := flag.NewFlagSet("todo migrate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	fileName := flags.String("json-file", "data.json", "data file to migrate")
+	lockTimeout := flags.Duration("json-lock-timeout", 5*time.Second, "how long to wait for another process to release the json file, 0 fails fast")
+	dryRun := flags.Bool("dry-run", false, "report problems without writing anything")
+	flags.BoolVar(&opts.RegenerateIds, "regenerate-ids", false, "give items whose id is not a UUID a new one")
+	flags.Func("map-priority", `map a free text priority onto Low, Medium or High, as "text=Priority", can be repeated`, func(value string) error {
+		text, priority, found := strings.Cut(value, "=")
+		normalised, ok := Priority(priority).normalise()
+		if !found || priority == "" || !ok {
+			return fmt.Errorf(`want "text=Low", "text=Medium" or "text=High", got %q`, value)
+		}
+		opts.Priorities[text] = normalised
+		return nil
+	})
+	flags.Func("fallback-priority", "priority given to anything not otherwise mapped, unset leaves it alone", func(value string) error {
+		normalised, ok := Priority(value).normalise()
+		if value == "" || !ok {
+			return fmt.Errorf(`want "Low", "Medium" or "High", got %q`, value)
+		}
+		opts.FallbackPriority = normalised
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	report, err := MigrateJSONFile(ctx, *fileName, opts, *dryRun, *lockTimeout)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not migrate %s: %v\n", *fileName, err)
+		return 1
+	}
+	for _, problem := range report.Problems {
+		fmt.Fprint(stdout, formatMigrationProblem(problem))
+	}
+	fmt.Fprintf(stdout, "%d records, %d problems, %d left as they are\n", report.Records, len(report.Problems), report.unfixed())
+	if *dryRun {
+		fmt.Fprintf(stdout, "dry run, %s was not changed\n", *fileName)
+	} else {
+		fmt.Fprintf(stdout, "wrote %s at schema version %d (was %d)\n", *fileName, report.To, report.From)
+	}
+	return 0
+}
+
+// Lifting migrates older files in memory, they are written back at the
+// current version by the next write
+func logAutomaticMigration(ctx context.Context, fileName string, report MigrationReport) {
+	for _, problem := range report.Problems {
+		slog.DebugContext(ctx, "migrated record", "file", fileName, "id", problem.Id, "field", problem.Field, "value", problem.Value, "problem", problem.Problem, "fixed_to", problem.FixedTo)
+	}
+	slog.InfoContext(ctx, "migrated data file", "file", fileName, "from", report.From, "to", report.To, "problems", len(report.Problems))
+	if unfixed := report.unfixed(); unfixed > 0 {
+		slog.WarnContext(ctx, "data file has records that break the rules, run the migrate command to fix them", "file", fileName, "problems", unfixed)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const legacyDataFile = `{
+  "123": {"id": "123", "title": "hi", "priority": "high", "complete": false},
+  "85876480-6e07-4d38-946e-e83ae99840e3": {"id": "85876480-6e07-4d38-946e-e83ae99840e3", "title": "yep", "priority": "pretty high", "complete": false},
+  "98765432": {"id": "98765432", "title": " ", "priority": "real low", "complete": true}
+}`
+
+func writeLegacyDataFile(t *testing.T) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(fileName, []byte(legacyDataFile), 0o644); err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	return fileName
+}
+
+func TestMigrateDataFile(t *testing.T) {
+	t.Run("Only what is certain is fixed by default", func(t *testing.T) {
+		contents, _ := readDataFile(writeLegacyDataFile(t))
+
+		report := migrateDataFile(&contents, MigrationOptions{})
+
+		if report.From != 0 || report.To != currentSchemaVersion || contents.SchemaVersion != currentSchemaVersion {
+			t.Errorf("want version 0 to %d, got %d to %d", currentSchemaVersion, report.From, report.To)
+		}
+		if got := contents.Todos["123"].Priority; got != PriorityHigh {
+			t.Errorf("want %v, got %v", PriorityHigh, got)
+		}
+		if got := contents.Todos["98765432"].Priority; got != "real low" {
+			t.Errorf("unmapped priority changed, got %v", got)
+		}
+		// both short ids, the empty title and both unmapped priorities
+		if got := report.unfixed(); got != 5 {
+			t.Errorf("want 5 problems left, got %d: %v", got, report.Problems)
+		}
+	})
+	t.Run("Priorities are mapped and ids regenerated", func(t *testing.T) {
+		contents, _ := readDataFile(writeLegacyDataFile(t))
+		opts := MigrationOptions{
+			Priorities:       map[string]Priority{"Real Low": PriorityLow},
+			FallbackPriority: PriorityMedium,
+			RegenerateIds:    true,
+		}
+
+		report := migrateDataFile(&contents, opts)
+
+		priorities := map[Title]Priority{}
+		for id, item := range contents.Todos {
+			if uuid.Validate(string(id)) != nil || item.Id != id {
+				t.Errorf("id not regenerated, got %v under %v", item.Id, id)
+			}
+			priorities[item.Title] = item.Priority
+		}
+		want := map[Title]Priority{"hi": PriorityHigh, "yep": PriorityMedium, " ": PriorityLow}
+		if len(priorities) != len(want) {
+			t.Fatalf("want %v, got %v", want, priorities)
+		}
+		for title, priority := range want {
+			if priorities[title] != priority {
+				t.Errorf("%q: want %v, got %v", title, priority, priorities[title])
+			}
+		}
+		// only the empty title cannot be fixed
+		if got := report.unfixed(); got != 1 {
+			t.Errorf("want 1 problem left, got %d: %v", got, report.Problems)
+		}
+	})
+	t.Run("References follow regenerated ids", func(t *testing.T) {
+		contents := dataFile{Todos: map[Id]ToDoItem{
+			"123": {Id: "123", Title: "Read the book", Priority: PriorityHigh, Series: "123", Occurrence: 1},
+			"456": {Id: "456", Title: "Write the app", Priority: PriorityHigh, BlockedBy: []Id{"123", "789"}},
+		}}
+
+		migrateDataFile(&contents, MigrationOptions{RegenerateIds: true})
+
+		byTitle := map[Title]ToDoItem{}
+		for _, item := range contents.Todos {
+			byTitle[item.Title] = item
+		}
+		read, write := byTitle["Read the book"], byTitle["Write the app"]
+		if read.Series != read.Id {
+			t.Errorf("want the series to follow its id %v, got %v", read.Id, read.Series)
+		}
+		if len(write.BlockedBy) != 2 || write.BlockedBy[0] != read.Id || write.BlockedBy[1] != "789" {
+			t.Errorf("want blocked by %v and the unknown id kept, got %v", read.Id, write.BlockedBy)
+		}
+	})
+}
+
+func TestMigrationOnLift(t *testing.T) {
+	t.Run("Older files are migrated and written back at the current version", func(t *testing.T) {
+		fileName := writeLegacyDataFile(t)
+		db, err := newJSONDataStore(fileName, 0, 0)
+		if err != nil {
+			t.Fatalf("setup failed! -> %v", err)
+		}
+
+		got, _ := db.get(context.Background(), "123")
+		if got.Priority != PriorityHigh {
+			t.Errorf("want %v, got %v", PriorityHigh, got.Priority)
+		}
+		db.create(context.Background(), ConstructToDoItem("Keep sanity", "high", false))
+		contents, _ := readDataFile(fileName)
+		if contents.SchemaVersion != currentSchemaVersion || len(contents.Todos) != 4 {
+			t.Errorf("want version %d with 4 items, got version %d with %v", currentSchemaVersion, contents.SchemaVersion, contents.Todos)
+		}
+	})
+	t.Run("New files are not migrated", func(t *testing.T) {
+		var logs bytes.Buffer
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+		if _, err := newJSONDataStore(filepath.Join(t.TempDir(), "data.json"), 0, 0); err != nil {
+			t.Fatalf("setup failed! -> %v", err)
+		}
+
+		if strings.Contains(logs.String(), "migrated") {
+			t.Errorf("want nothing migrated, got %s", logs.String())
+		}
+	})
+	t.Run("Newer files are refused", func(t *testing.T) {
+		fileName := filepath.Join(t.TempDir(), "data.json")
+		os.WriteFile(fileName, []byte(`{"schema_version": 99, "todos": {}}`), 0o644)
+
+		_, err := newJSONDataStore(fileName, 0, 0)
+
+		if !errors.Is(err, errNewerSchema) {
+			t.Errorf("want %v, got %v", errNewerSchema, err)
+		}
+	})
+}
+
+func TestRunMigrate(t *testing.T) {
+	t.Run("Dry run changes nothing", func(t *testing.T) {
+		fileName := writeLegacyDataFile(t)
+		var stdout, stderr bytes.Buffer
+
+		code := runMigrate(context.Background(), []string{"-json-file", fileName, "-dry-run"}, &stdout, &stderr)
+
+		if code != 0 {
+			t.Fatalf("want exit code 0, got %d: %s", code, stderr.String())
+		}
+		if got, _ := os.ReadFile(fileName); string(got) != legacyDataFile {
+			t.Errorf("dry run changed the file, got %s", got)
+		}
+		if !strings.Contains(stdout.String(), `priority "real low" is not Low, Medium or High`) {
+			t.Errorf("problem not reported, got %s", stdout.String())
+		}
+	})
+	t.Run("Migrates in place", func(t *testing.T) {
+		fileName := writeLegacyDataFile(t)
+		var stdout, stderr bytes.Buffer
+
+		code := runMigrate(context.Background(), []string{"-json-file", fileName, "-map-priority", "real low=low", "-fallback-priority", "Medium"}, &stdout, &stderr)
+
+		if code != 0 {
+			t.Fatalf("want exit code 0, got %d: %s", code, stderr.String())
+		}
+		contents, err := readDataFile(fileName)
+		if err != nil || contents.SchemaVersion != currentSchemaVersion || contents.Todos["98765432"].Priority != PriorityLow {
+			t.Errorf("file not migrated, got %v %v", contents, err)
+		}
+		if backup, _ := os.ReadFile(fileName + ".bak"); string(backup) != legacyDataFile {
+			t.Errorf("original not kept as the backup, got %s", backup)
+		}
+	})
+	t.Run("Bad mapping", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+
+		code := runMigrate(context.Background(), []string{"-map-priority", "real low=lowest"}, &stdout, &stderr)
+
+		if code != 2 {
+			t.Errorf("want exit code 2, got %d", code)
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Patches are applied to an item's JSON, so they name fields the way the API
+// does. Whatever they do to the fields the DAL looks after is undone by Patch
+var ErrInvalidPatch = errors.New("patch cannot be applied to the item")
+var ErrPatchTestFailed = errors.New("patch test failed")
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// Turns a patch document of the given media type into a change for
+// DataAccessLayer.Patch. Fails with ErrInvalidPatch if the document is not a
+// patch of that type
+func parsePatch(mediaType string, document []byte) (func(item *ToDoItem) error, error) {
+	switch mediaType {
+	case mergePatchType:
+		var patch any
+		if err := json.Unmarshal(document, &patch); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		return func(item *ToDoItem) error {
+			return patchJSON(item, func(doc any) (any, error) {
+				return mergePatch(doc, patch), nil
+			})
+		}, nil
+	case jsonPatchType:
+		var operations []patchOperation
+		if err := json.Unmarshal(document, &operations); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		for _, operation := range operations {
+			if err := operation.check(); err != nil {
+				return nil, err
+			}
+		}
+		return func(item *ToDoItem) error {
+			return patchJSON(item, func(doc any) (any, error) {
+				return applyOperations(doc, operations)
+			})
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported media type %q", ErrInvalidPatch, mediaType)
+	}
+}
+
+// Runs `patch` over the item as JSON, then reads it back
+func patchJSON(item *ToDoItem, patch func(doc any) (any, error)) error {
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err = json.Unmarshal(encoded, &doc); err != nil {
+		return err
+	}
+	if doc, err = patch(doc); err != nil {
+		return err
+	}
+	if _, isObject := doc.(map[string]any); !isObject {
+		return fmt.Errorf("%w: a ToDo must be an object", ErrInvalidPatch)
+	}
+	if encoded, err = json.Marshal(doc); err != nil {
+		return err
+	}
+	var patched ToDoItem
+	if err = json.Unmarshal(encoded, &patched); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	*item = patched
+	return nil
+}
+
+// RFC 7386. Members set to null are removed, objects are merged and anything
+// else replaces what was there
+func mergePatch(target any, patch any) any {
+	patchObject, isObject := patch.(map[string]any)
+	if !isObject {
+		return patch
+	}
+	targetObject, isObject := target.(map[string]any)
+	if !isObject {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// One operation of an RFC 6902 JSON Patch
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (o patchOperation) check() error {
+	switch o.Op {
+	case "add", "replace", "test":
+		if o.Value == nil {
+			return fmt.Errorf("%w: %s needs a value", ErrInvalidPatch, o.Op)
+		}
+	case "move", "copy":
+		if _, err := parsePointer(o.From); err != nil {
+			return err
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, o.Op)
+	}
+	_, err := parsePointer(o.Path)
+	return err
+}
+
+func (o patchOperation) value() any {
+	var value any
+	json.Unmarshal(o.Value, &value)
+	return value
+}
+
+// Operations are applied in order, and the patch fails as a whole if any of
+// them does
+func applyOperations(doc any, operations []patchOperation) (any, error) {
+	var err error
+	for _, o := range operations {
+		path, _ := parsePointer(o.Path)
+		from, _ := parsePointer(o.From)
+		switch o.Op {
+		case "add":
+			doc, err = addAt(doc, path, o.value())
+		case "remove":
+			doc, err = removeAt(doc, path)
+		case "replace":
+			if len(path) == 0 {
+				doc = o.value()
+			} else if doc, err = removeAt(doc, path); err == nil {
+				doc, err = addAt(doc, path, o.value())
+			}
+		case "move":
+			if strings.HasPrefix(o.Path, o.From+"/") {
+				return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, o.From)
+			}
+			var value any
+			if value, err = valueAt(doc, from); err == nil {
+				if doc, err = removeAt(doc, from); err == nil {
+					doc, err = addAt(doc, path, value)
+				}
+			}
+		case "copy":
+			var value any
+			if value, err = valueAt(doc, from); err == nil {
+				doc, err = addAt(doc, path, deepCopy(value))
+			}
+		case "test":
+			var value any
+			if value, err = valueAt(doc, path); err == nil && !reflect.DeepEqual(value, o.value()) {
+				err = fmt.Errorf("%w: %s is not %s", ErrPatchTestFailed, o.Path, o.Value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// Splits an RFC 6901 JSON Pointer into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: %q is not a JSON pointer", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func arrayIndex(array []any, token string, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return len(array), nil
+	}
+	i, err := strconv.Atoi(token)
+	end := len(array)
+	if !allowEnd {
+		end--
+	}
+	if err != nil || i < 0 || i > end || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("%w: no index %q", ErrInvalidPatch, token)
+	}
+	return i, nil
+}
+
+func valueAt(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]any:
+			value, exists := container[token]
+			if !exists {
+				return nil, fmt.Errorf("%w: no member %q", ErrInvalidPatch, token)
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(container, token, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, fmt.Errorf("%w: %q is inside a value", ErrInvalidPatch, token)
+		}
+	}
+	return doc, nil
+}
+
+// Calls `change` with the container the last token of `path` is in and
+// returns `doc` with the changed container in its place. Maps are changed in
+// place but arrays may be replaced, so every container on the way is put back
+func changeAt(doc any, path []string, change func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+	child, err := valueAt(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = changeAt(child, path[1:], change); err != nil {
+		return nil, err
+	}
+	switch container := doc.(type) {
+	case map[string]any:
+		container[path[0]] = child
+	case []any:
+		i, _ := arrayIndex(container, path[0], false)
+		container[i] = child
+	}
+	return doc, nil
+}
+
+func addAt(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return changeAt(doc, path, func(container any, token string) (any, error) {
+		switch container := container.(type) {
+		case map[string]any:
+			container[token] = value
+			return container, nil
+		case []any:
+			i, err := arrayIndex(container, token, true)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:i], append([]any{value}, container[i:]...)...), nil
+		default:
+			return nil, fmt.Errorf("%w: %q is inside a value", ErrInvalidPatch, token)
+		}
+	})
+}
+
+func removeAt(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole ToDo", ErrInvalidPatch)
+	}
+	return changeAt(doc, path, func(container any, token string) (any, error) {
+		switch container := container.(type) {
+		case map[string]any:
+			if _, exists := container[token]; !exists {
+				return nil, fmt.Errorf("%w: no member %q", ErrInvalidPatch, token)
+			}
+			delete(container, token)
+			return container, nil
+		case []any:
+			i, err := arrayIndex(container, token, false)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:i], container[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: %q is inside a value", ErrInvalidPatch, token)
+		}
+	})
+}
+
+// Copied values must not share maps or arrays with where they came from
+func deepCopy(value any) any {
+	encoded, _ := json.Marshal(value)
+	var copied any
+	json.Unmarshal(encoded, &copied)
+	return copied
+}
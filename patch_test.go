@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, document string) any {
+	t.Helper()
+	var value any
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	return value
+}
+
+func TestMergePatch(t *testing.T) {
+	// From RFC 7386 appendix A
+	tests := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, test := range tests {
+		got := mergePatch(decodeJSON(t, test.target), decodeJSON(t, test.patch))
+
+		if want := decodeJSON(t, test.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s with %s: want %v, got %v", test.target, test.patch, want, got)
+		}
+	}
+}
+
+func TestApplyOperations(t *testing.T) {
+	// Mostly from RFC 6902 appendix A
+	tests := []struct {
+		name, doc, patch, want string
+		err                    error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"add element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"append element", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","qux"]}`, nil},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"remove element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"move element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"copy", `{"foo":{"a":1}}`, `[{"op":"copy","from":"/foo","path":"/bar"},{"op":"add","path":"/bar/b","value":2}]`, `{"foo":{"a":1},"bar":{"a":1,"b":2}}`, nil},
+		{"escaped pointer", `{"a/b":1,"m~n":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/m~0n"}]`, `{}`, nil},
+		{"test passes", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, ErrPatchTestFailed},
+		{"missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, ``, ErrInvalidPatch},
+		{"add to nonexistent target", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, ErrInvalidPatch},
+		{"index out of range", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`, ``, ErrInvalidPatch},
+		{"leading zero index", `{"foo":["bar","baz"]}`, `[{"op":"remove","path":"/foo/01"}]`, ``, ErrInvalidPatch},
+		{"move into itself", `{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, ``, ErrInvalidPatch},
+	}
+	for _, test := range tests {
+		var operations []patchOperation
+		json.Unmarshal([]byte(test.patch), &operations)
+
+		got, err := applyOperations(decodeJSON(t, test.doc), operations)
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: want %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if test.err == nil && !reflect.DeepEqual(got, decodeJSON(t, test.want)) {
+			t.Errorf("%s: want %s, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	item := ConstructToDoItem("Keep sanity", "high", false)
+	t.Run("Merge patch only touches what it names", func(t *testing.T) {
+		change, err := parsePatch(mergePatchType, []byte(`{"complete":true}`))
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		patched := item
+
+		if err = change(&patched); err != nil || !bool(patched.Complete) || patched.Title != item.Title || patched.Priority != item.Priority {
+			t.Errorf("want only complete changed, got %v %v", patched, err)
+		}
+	})
+	t.Run("JSON Patch", func(t *testing.T) {
+		change, _ := parsePatch(jsonPatchType, []byte(`[{"op":"test","path":"/title","value":"Keep sanity"},{"op":"replace","path":"/title","value":"Lose sanity"}]`))
+		patched := item
+
+		if err := change(&patched); err != nil || patched.Title != "Lose sanity" || patched.Priority != item.Priority {
+			t.Errorf("want only the title changed, got %v %v", patched, err)
+		}
+	})
+	t.Run("Wrong types", func(t *testing.T) {
+		change, _ := parsePatch(mergePatchType, []byte(`{"title":5}`))
+		patched := item
+
+		if err := change(&patched); !errors.Is(err, ErrInvalidPatch) || !equalItems(patched, item) {
+			t.Errorf("want %v and the item untouched, got %v %v", ErrInvalidPatch, patched, err)
+		}
+	})
+	t.Run("Invalid documents", func(t *testing.T) {
+		documents := map[string]string{
+			mergePatchType: `{"title":`,
+			jsonPatchType:  `[{"op":"add","path":"/title"}]`,
+			"text/plain":   `title`,
+		}
+		for mediaType, document := range documents {
+			if _, err := parsePatch(mediaType, []byte(document)); !errors.Is(err, ErrInvalidPatch) {
+				t.Errorf("%s: want %v, got %v", mediaType, ErrInvalidPatch, err)
+			}
+		}
+	})
+}
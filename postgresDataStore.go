@@ -0,0 +1,658 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Each entry is applied once, in order, and recorded in schema_migrations.
+// Never edit an entry once it has been released, append a new one instead
+var postgresMigrations = []string{
+	`CREATE TABLE todos (
+		id       TEXT PRIMARY KEY,
+		title    TEXT NOT NULL,
+		priority TEXT NOT NULL,
+		complete BOOLEAN NOT NULL DEFAULT FALSE
+	)`,
+	`ALTER TABLE todos ADD COLUMN owner TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE accounts (
+		name          TEXT PRIMARY KEY,
+		password_hash TEXT NOT NULL
+	)`,
+	`CREATE TABLE api_keys (
+		id      TEXT PRIMARY KEY,
+		owner   TEXT NOT NULL REFERENCES accounts (name) ON DELETE CASCADE,
+		name    TEXT NOT NULL,
+		scope   TEXT NOT NULL,
+		hash    TEXT NOT NULL,
+		created TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE lists (
+		id   TEXT PRIMARY KEY,
+		name TEXT NOT NULL
+	)`,
+	`CREATE TABLE list_members (
+		list_id TEXT NOT NULL REFERENCES lists (id) ON DELETE CASCADE,
+		member  TEXT NOT NULL,
+		role    TEXT NOT NULL,
+		PRIMARY KEY (list_id, member)
+	)`,
+	`ALTER TABLE todos ADD COLUMN list_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE todos ADD COLUMN due TIMESTAMPTZ, ADD COLUMN due_offset INTEGER`,
+	`ALTER TABLE todos
+		ADD COLUMN created_at   TIMESTAMPTZ,
+		ADD COLUMN updated_at   TIMESTAMPTZ,
+		ADD COLUMN updated_by   TEXT NOT NULL DEFAULT '',
+		ADD COLUMN completed_at TIMESTAMPTZ`,
+	`ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 0`,
+	`CREATE INDEX todos_title_search ON todos USING GIN (to_tsvector('simple', title))`,
+	`ALTER TABLE todos ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}'`,
+	`CREATE INDEX todos_tags ON todos USING GIN (tags)`,
+	`ALTER TABLE todos ADD COLUMN checklist JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE todos ADD COLUMN blocked_by TEXT[] NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE todos
+		ADD COLUMN recurrence TEXT    NOT NULL DEFAULT '',
+		ADD COLUMN series     TEXT    NOT NULL DEFAULT '',
+		ADD COLUMN occurrence INTEGER NOT NULL DEFAULT 0`,
+	`CREATE INDEX todos_series ON todos (series) WHERE series <> ''`,
+}
+
+const (
+	pqForeignKeyViolation = "23503"
+	pqUniqueViolation     = "23505"
+)
+
+type postgresDataStore struct {
+	db *sql.DB
+}
+
+// Connects to the database described by `dsn` and brings its schema up to date
+func newPostgresDataStore(ctx context.Context, dsn string) (postgresDataStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return postgresDataStore{}, err
+	}
+	ds := postgresDataStore{db}
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return ds, err
+	}
+	if err = ds.migrate(ctx); err != nil {
+		db.Close()
+		return ds, err
+	}
+	return ds, nil
+}
+
+func (d postgresDataStore) close() error {
+	return d.db.Close()
+}
+
+// Held while a migration is applied, so servers starting together against
+// the same database apply each migration once
+const migrationLockKey = 7_245_116_100
+
+// Applies the migrations the database has not had yet, each in a
+// transaction with its schema_migrations row
+func (d postgresDataStore) migrate(ctx context.Context) error {
+	for {
+		version, err := d.migrateNext(ctx)
+		if err != nil || version == 0 {
+			return err
+		}
+		slog.InfoContext(ctx, "applied database migration", "version", version)
+	}
+}
+
+// Applies the first migration the database has not had under the migration
+// lock. Returns its version, or 0 if there was none left to apply
+func (d postgresDataStore) migrateNext(ctx context.Context) (int, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockKey); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if _, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	var version int
+	if err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if version >= len(postgresMigrations) {
+		return 0, tx.Commit()
+	}
+	if _, err = tx.ExecContext(ctx, postgresMigrations[version]); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("migration %d: %w", version+1, err)
+	}
+	if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version+1); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("migration %d: %w", version+1, err)
+	}
+	return version + 1, tx.Commit()
+}
+
+const todoColumns = `id, title, priority, complete, owner, list_id, due, due_offset, created_at, updated_at, updated_by, completed_at, version, tags, checklist, blocked_by, recurrence, series, occurrence`
+
+// TIMESTAMPTZ only keeps the instant, so the offset the due time was given
+// in is kept alongside it
+func scanToDoItem(row interface{ Scan(dest ...any) error }) (ToDoItem, error) {
+	var item ToDoItem
+	var due sql.NullTime
+	var offset sql.NullInt32
+	var created, updated, completed sql.NullTime
+	var tags pq.StringArray
+	var checklist []byte
+	var blockedBy pq.StringArray
+	err := row.Scan(&item.Id, &item.Title, &item.Priority, &item.Complete, &item.Owner, &item.List, &due, &offset,
+		&created, &updated, &item.UpdatedBy, &completed, &item.Version, &tags, &checklist, &blockedBy,
+		&item.Recurrence, &item.Series, &item.Occurrence)
+	if err == nil && due.Valid {
+		local := due.Time.In(time.FixedZone("", int(offset.Int32)))
+		item.Due = &local
+	}
+	item.CreatedAt, item.UpdatedAt, item.CompletedAt = utcTime(created), utcTime(updated), utcTime(completed)
+	for _, tag := range tags {
+		item.Tags = append(item.Tags, Tag(tag))
+	}
+	for _, id := range blockedBy {
+		item.BlockedBy = append(item.BlockedBy, Id(id))
+	}
+	if err == nil {
+		err = json.Unmarshal(checklist, &item.Checklist)
+	}
+	if len(item.Checklist) == 0 {
+		item.Checklist = nil
+	}
+	return item, err
+}
+
+func checklistColumn(checklist []SubItem) []byte {
+	if checklist == nil {
+		checklist = []SubItem{}
+	}
+	column, _ := json.Marshal(checklist)
+	return column
+}
+
+func blockedByColumn(blockedBy []Id) pq.StringArray {
+	column := pq.StringArray{}
+	for _, id := range blockedBy {
+		column = append(column, string(id))
+	}
+	return column
+}
+
+func tagsColumn(tags []Tag) pq.StringArray {
+	column := pq.StringArray{}
+	for _, tag := range tags {
+		column = append(column, string(tag))
+	}
+	return column
+}
+
+func utcTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func dueColumns(item ToDoItem) (sql.NullTime, sql.NullInt32) {
+	if item.Due == nil {
+		return sql.NullTime{}, sql.NullInt32{}
+	}
+	_, offset := item.Due.Zone()
+	return sql.NullTime{Time: *item.Due, Valid: true}, sql.NullInt32{Int32: int32(offset), Valid: true}
+}
+
+func (d postgresDataStore) read(ctx context.Context) ([]ToDoItem, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+todoColumns+` FROM todos`)
+	if err != nil {
+		return nil, &StorageError{"read", err}
+	}
+	defer rows.Close()
+	var dataSlice []ToDoItem
+	for rows.Next() {
+		item, err := scanToDoItem(rows)
+		if err != nil {
+			return nil, &StorageError{"read", err}
+		}
+		dataSlice = append(dataSlice, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &StorageError{"read", err}
+	}
+	return dataSlice, nil
+}
+
+// Work out the same strings as sortKey, compared byte by byte as Go does
+var postgresSortKeys = map[SortKey]string{
+	SortCreated:  `COALESCE(to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'), '') COLLATE "C"`,
+	SortPriority: `(CASE priority WHEN 'Low' THEN '0' WHEN 'Medium' THEN '1' WHEN 'High' THEN '2' ELSE '' END) COLLATE "C"`,
+	SortTitle:    `lower(title) COLLATE "C"`,
+}
+
+func (d postgresDataStore) query(ctx context.Context, q Query) (Page, error) {
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	where := []string{"list_id = " + arg(q.List)}
+	if q.List == "" {
+		where = append(where, "owner = "+arg(q.Owner))
+	}
+	if q.Complete != nil {
+		where = append(where, "complete = "+arg(*q.Complete))
+	}
+	if q.Priority != "" {
+		where = append(where, "priority = "+arg(q.Priority))
+	}
+	if q.TitleContains != "" {
+		where = append(where, "strpos(lower(title), lower("+arg(q.TitleContains)+")) > 0")
+	}
+	if q.Series != "" {
+		where = append(where, "series = "+arg(q.Series))
+	}
+	if len(q.Tags) > 0 {
+		// @> holds when the item has all the tags, && when it has any
+		operator := "&&"
+		if q.AllTags {
+			operator = "@>"
+		}
+		where = append(where, "tags "+operator+" "+arg(tagsColumn(q.Tags)))
+	}
+	switch q.Due {
+	case DueOverdue:
+		where = append(where, "NOT complete AND due < "+arg(q.Now))
+	case DueToday, DueThisWeek:
+		start, end := q.Due.window(q.Now)
+		where = append(where, "due >= "+arg(start)+" AND due < "+arg(end))
+	}
+	key, direction, after := postgresSortKeys[q.Sort], "ASC", ">"
+	if q.Descending {
+		direction, after = "DESC", "<"
+	}
+	if q.after != nil {
+		where = append(where, fmt.Sprintf(`(%s, id COLLATE "C") %s (%s, %s)`, key, after, arg(q.after.Key), arg(q.after.Id)))
+	}
+	statement := `SELECT ` + todoColumns + ` FROM todos WHERE ` + strings.Join(where, " AND ") +
+		fmt.Sprintf(` ORDER BY %s %s, id COLLATE "C" %s`, key, direction, direction)
+	if q.Limit > 0 {
+		// One more than the page, to tell whether there is a next one
+		statement += " LIMIT " + arg(q.Limit+1)
+	}
+	rows, err := d.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return Page{}, &StorageError{"query", err}
+	}
+	defer rows.Close()
+	var items []ToDoItem
+	for rows.Next() {
+		item, err := scanToDoItem(rows)
+		if err != nil {
+			return Page{}, &StorageError{"query", err}
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, &StorageError{"query", err}
+	}
+	return q.page(items), nil
+}
+
+// Uses PostgreSQL's own full text search, which splits titles into words
+// much as tokenise does. Matches are ranked a little differently to the
+// in memory index
+func (d postgresDataStore) search(ctx context.Context, text string) ([]ToDoItem, error) {
+	words := tokenise(text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	// tokenise leaves only letters and digits, which tsquery takes as they are
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT `+todoColumns+` FROM todos, to_tsquery('simple', $1) AS search
+		WHERE to_tsvector('simple', title) @@ search
+		ORDER BY ts_rank(to_tsvector('simple', title), search) DESC, id`,
+		strings.Join(words, " & "),
+	)
+	if err != nil {
+		return nil, &StorageError{"search", err}
+	}
+	defer rows.Close()
+	var items []ToDoItem
+	for rows.Next() {
+		item, err := scanToDoItem(rows)
+		if err != nil {
+			return nil, &StorageError{"search", err}
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &StorageError{"search", err}
+	}
+	return items, nil
+}
+
+func (d postgresDataStore) get(ctx context.Context, id Id) (ToDoItem, error) {
+	item, err := scanToDoItem(d.db.QueryRowContext(ctx,
+		`SELECT `+todoColumns+` FROM todos WHERE id = $1`,
+		id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ToDoItem{}, ErrCannotQuery
+	}
+	if err != nil {
+		return ToDoItem{}, &StorageError{"get", err}
+	}
+	return item, nil
+}
+
+func (d postgresDataStore) delete(ctx context.Context, item ToDoItem) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM todos WHERE id = $1`, item.Id)
+	return affectedOne("delete", result, err, ErrCannotDelete)
+}
+
+// Only replaces the version before `item`'s, so a write from another process
+// sharing the database is not lost. Fails with ErrConflict if the stored item
+// has moved on
+func (d postgresDataStore) update(ctx context.Context, item ToDoItem) error {
+	due, offset := dueColumns(item)
+	result, err := d.db.ExecContext(ctx,
+		`UPDATE todos SET title = $2, priority = $3, complete = $4, owner = $5, list_id = $6, due = $7, due_offset = $8,
+			created_at = $9, updated_at = $10, updated_by = $11, completed_at = $12, version = $13, tags = $14, checklist = $15, blocked_by = $16,
+			recurrence = $17, series = $18, occurrence = $19 WHERE id = $1 AND version = $20`,
+		item.Id, item.Title, item.Priority, item.Complete, item.Owner, item.List, due, offset,
+		nullTime(item.CreatedAt), nullTime(item.UpdatedAt), item.UpdatedBy, nullTime(item.CompletedAt), item.Version,
+		tagsColumn(item.Tags), checklistColumn(item.Checklist), blockedByColumn(item.BlockedBy),
+		item.Recurrence, item.Series, item.Occurrence, item.Version-1,
+	)
+	err = affectedOne("update", result, err, ErrCannotUpdate)
+	if !errors.Is(err, ErrCannotUpdate) {
+		return err
+	}
+	var exists bool
+	if err := d.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1)`, item.Id).Scan(&exists); err != nil {
+		return &StorageError{"update", err}
+	}
+	if exists {
+		return ErrConflict
+	}
+	return ErrCannotUpdate
+}
+
+func (d postgresDataStore) create(ctx context.Context, item ToDoItem) error {
+	due, offset := dueColumns(item)
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO todos (`+todoColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
+		item.Id, item.Title, item.Priority, item.Complete, item.Owner, item.List, due, offset,
+		nullTime(item.CreatedAt), nullTime(item.UpdatedAt), item.UpdatedBy, nullTime(item.CompletedAt), item.Version,
+		tagsColumn(item.Tags), checklistColumn(item.Checklist), blockedByColumn(item.BlockedBy),
+		item.Recurrence, item.Series, item.Occurrence,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return ErrCannotCreate
+	}
+	if err != nil {
+		return &StorageError{"create", err}
+	}
+	return nil
+}
+
+// Runs `work` in a transaction, committing it unless `work` fails
+func (d postgresDataStore) inTx(ctx context.Context, op string, work func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &StorageError{op, err}
+	}
+	if err = work(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return &StorageError{op, err}
+	}
+	return nil
+}
+
+func insertMembers(ctx context.Context, tx *sql.Tx, op string, list List) error {
+	for member, role := range list.Members {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO list_members (list_id, member, role) VALUES ($1, $2, $3)`,
+			list.Id, member, role,
+		)
+		if err != nil {
+			return &StorageError{op, err}
+		}
+	}
+	return nil
+}
+
+func (d postgresDataStore) createList(ctx context.Context, list List) error {
+	return d.inTx(ctx, "create list", func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO lists (id, name) VALUES ($1, $2)`, list.Id, list.Name)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+			return ErrListExists
+		}
+		if err != nil {
+			return &StorageError{"create list", err}
+		}
+		return insertMembers(ctx, tx, "create list", list)
+	})
+}
+
+func (d postgresDataStore) readLists(ctx context.Context) ([]List, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT l.id, l.name, m.member, m.role FROM lists l LEFT JOIN list_members m ON m.list_id = l.id`,
+	)
+	if err != nil {
+		return nil, &StorageError{"read lists", err}
+	}
+	defer rows.Close()
+	found := make(map[ListId]List)
+	var order []ListId
+	for rows.Next() {
+		var id ListId
+		var name string
+		var member, role sql.NullString
+		if err := rows.Scan(&id, &name, &member, &role); err != nil {
+			return nil, &StorageError{"read lists", err}
+		}
+		list, seen := found[id]
+		if !seen {
+			list = List{Id: id, Name: name, Members: make(map[User]Role)}
+			order = append(order, id)
+		}
+		if member.Valid {
+			list.Members[User(member.String)] = Role(role.String)
+		}
+		found[id] = list
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &StorageError{"read lists", err}
+	}
+	lists := make([]List, 0, len(order))
+	for _, id := range order {
+		lists = append(lists, found[id])
+	}
+	return lists, nil
+}
+
+func (d postgresDataStore) getList(ctx context.Context, id ListId) (List, error) {
+	list := List{Id: id, Members: make(map[User]Role)}
+	err := d.db.QueryRowContext(ctx, `SELECT name FROM lists WHERE id = $1`, id).Scan(&list.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return List{}, ErrNoList
+	}
+	if err != nil {
+		return List{}, &StorageError{"get list", err}
+	}
+	rows, err := d.db.QueryContext(ctx, `SELECT member, role FROM list_members WHERE list_id = $1`, id)
+	if err != nil {
+		return List{}, &StorageError{"get list", err}
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var member User
+		var role Role
+		if err := rows.Scan(&member, &role); err != nil {
+			return List{}, &StorageError{"get list", err}
+		}
+		list.Members[member] = role
+	}
+	if err := rows.Err(); err != nil {
+		return List{}, &StorageError{"get list", err}
+	}
+	return list, nil
+}
+
+// Replaces the list's name and all of its members
+func (d postgresDataStore) updateList(ctx context.Context, list List) error {
+	return d.inTx(ctx, "update list", func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE lists SET name = $2 WHERE id = $1`, list.Id, list.Name)
+		if err = affectedOne("update list", result, err, ErrNoList); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, `DELETE FROM list_members WHERE list_id = $1`, list.Id); err != nil {
+			return &StorageError{"update list", err}
+		}
+		return insertMembers(ctx, tx, "update list", list)
+	})
+}
+
+func (d postgresDataStore) deleteList(ctx context.Context, id ListId) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM lists WHERE id = $1`, id)
+	return affectedOne("delete list", result, err, ErrNoList)
+}
+
+func (d postgresDataStore) createAccount(ctx context.Context, account Account) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO accounts (name, password_hash) VALUES ($1, $2)`,
+		account.Name, account.PasswordHash,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return ErrAccountExists
+	}
+	if err != nil {
+		return &StorageError{"create account", err}
+	}
+	return nil
+}
+
+func (d postgresDataStore) getAccount(ctx context.Context, name User) (Account, error) {
+	var account Account
+	err := d.db.QueryRowContext(ctx,
+		`SELECT name, password_hash FROM accounts WHERE name = $1`,
+		name,
+	).Scan(&account.Name, &account.PasswordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Account{}, ErrNoAccount
+	}
+	if err != nil {
+		return Account{}, &StorageError{"get account", err}
+	}
+	return account, nil
+}
+
+func (d postgresDataStore) createAPIKey(ctx context.Context, owner User, key APIKey) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO api_keys (id, owner, name, scope, hash, created) VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.Id, owner, key.Name, key.Scope, key.Hash, key.Created,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqForeignKeyViolation {
+		return ErrNoAccount
+	}
+	if err != nil {
+		return &StorageError{"create api key", err}
+	}
+	return nil
+}
+
+func (d postgresDataStore) listAPIKeys(ctx context.Context, owner User) ([]APIKey, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, name, scope, hash, created FROM api_keys WHERE owner = $1 ORDER BY created`,
+		owner,
+	)
+	if err != nil {
+		return nil, &StorageError{"list api keys", err}
+	}
+	defer rows.Close()
+	var keys []APIKey
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.Id, &key.Name, &key.Scope, &key.Hash, &key.Created); err != nil {
+			return nil, &StorageError{"list api keys", err}
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &StorageError{"list api keys", err}
+	}
+	return keys, nil
+}
+
+func (d postgresDataStore) deleteAPIKey(ctx context.Context, owner User, id string) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM api_keys WHERE owner = $1 AND id = $2`, owner, id)
+	return affectedOne("delete api key", result, err, ErrNoAPIKey)
+}
+
+func (d postgresDataStore) getAPIKey(ctx context.Context, id string) (User, APIKey, error) {
+	var owner User
+	var key APIKey
+	err := d.db.QueryRowContext(ctx,
+		`SELECT owner, id, name, scope, hash, created FROM api_keys WHERE id = $1`,
+		id,
+	).Scan(&owner, &key.Id, &key.Name, &key.Scope, &key.Hash, &key.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AnonymousUser, APIKey{}, ErrNoAPIKey
+	}
+	if err != nil {
+		return AnonymousUser, APIKey{}, &StorageError{"get api key", err}
+	}
+	return owner, key, nil
+}
+
+// Turns a statement that touched no rows into `notFound`
+func affectedOne(op string, result sql.Result, err error, notFound error) error {
+	if err != nil {
+		return &StorageError{op, err}
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return &StorageError{op, err}
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
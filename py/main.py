@@ -1,6 +1,7 @@
 import requests
 from uuid import uuid4
 import json
+import os
 
 HOME = "http://localhost:8080/"
 CREATE = HOME + "create"
@@ -8,11 +9,14 @@ READ = HOME + "read"
 UPDATE = HOME + "update"
 DELETE = HOME + "delete"
 
+# Create a key with POST /v2/users/{user}/keys or the CLI's "create api key"
+HEADERS = {"Authorization": "Bearer " + os.environ.get("TODO_API_KEY", "")}
+
 
 def prompt_data() -> dict:
     id = uuid4()
     title = input("Give title: ")
-    prio = input("Give priority: ")
+    prio = input("Give priority (Low, Medium or High): ")
     comp = False
     return {
         "id": str(id),
@@ -38,20 +42,24 @@ def main():
                 r = requests.post(
                     url=CREATE,
                     data=json.dumps(data),
+                    headers=HEADERS,
                 )
                 print(r.content.decode("utf-8"))
             case "2":
                 r = requests.get(
                     url=READ,
+                    headers=HEADERS,
                 )
                 print(r.content.decode("utf-8"))
             case "3":
                 requests.post(
                     url=UPDATE,
+                    headers=HEADERS,
                 )
             case "4":
                 requests.post(
                     url=DELETE,
+                    headers=HEADERS,
                 )
             case "0":
                 exit(0)
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Orders items by one of their fields. Ties are broken by Id so the order is
+// the same from one page to the next
+type SortKey string
+
+const (
+	SortCreated  SortKey = "created"
+	SortPriority SortKey = "priority"
+	SortTitle    SortKey = "title"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Picks, orders and pages the items a read returns. The zero Query reads
+// every item, oldest first
+type Query struct {
+	// Set by the DAL from who is asking. Reads the List, or Owner's personal
+	// items if List is empty
+	Owner User
+	List  ListId
+	// nil reads complete and incomplete items alike
+	Complete *Complete
+	// Empty reads every priority
+	Priority Priority
+	// Matched ignoring case
+	TitleContains string
+	// Reads items with any of the Tags, or with all of them if AllTags is set.
+	// Empty reads every item
+	Tags    []Tag
+	AllTags bool
+	Due     DueFilter
+	// Reads only incomplete items whose blockers are all complete
+	Actionable bool
+	// Reads only the occurrences of a recurring item. Empty reads every item
+	Series Id
+	// When Due is worked out at
+	Now        time.Time
+	Sort       SortKey
+	Descending bool
+	// 0 reads every item
+	Limit int
+	// A Page's Next, to carry on from where it left off
+	After string
+
+	after *cursor
+}
+
+// One page of a Query's results
+type Page struct {
+	Items []ToDoItem
+	// Passed as Query.After to read the next page, empty on the last page
+	Next string
+}
+
+// Where a page ended. Only makes sense for the sort it was made for
+type cursor struct {
+	Sort       SortKey `json:"s"`
+	Descending bool    `json:"d,omitempty"`
+	Key        string  `json:"k"`
+	Id         Id      `json:"id"`
+}
+
+func (c cursor) encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	var c cursor
+	if err == nil {
+		err = json.Unmarshal(decoded, &c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: unreadable cursor", ErrInvalidQuery)
+	}
+	return &c, nil
+}
+
+// Checks the Query can be run, filling in the defaults. Stores can assume
+// every Query they are given has been through validate
+func (q Query) validate() (Query, error) {
+	if q.Sort == "" {
+		q.Sort = SortCreated
+	}
+	if !slices.Contains([]SortKey{SortCreated, SortPriority, SortTitle}, q.Sort) {
+		return q, fmt.Errorf("%w: sort must be created, priority or title", ErrInvalidQuery)
+	}
+	if q.Priority != "" {
+		priority, ok := q.Priority.normalise()
+		if !ok {
+			return q, fmt.Errorf(`%w: priority must be "Low", "Medium" or "High"`, ErrInvalidQuery)
+		}
+		q.Priority = priority
+	}
+	if !q.Due.valid() {
+		return q, ErrInvalidDueFilter
+	}
+	tags, ok := normaliseTags(q.Tags)
+	if !ok {
+		return q, fmt.Errorf("%w: tags must each be 1 to %d characters without commas", ErrInvalidQuery, maxTagLength)
+	}
+	q.Tags = tags
+	if q.Limit < 0 {
+		return q, fmt.Errorf("%w: limit cannot be negative", ErrInvalidQuery)
+	}
+	if q.Actionable {
+		if q.Complete != nil && *q.Complete {
+			return q, fmt.Errorf("%w: actionable items are never complete", ErrInvalidQuery)
+		}
+		incomplete := Complete(false)
+		q.Complete = &incomplete
+	}
+	q.after = nil
+	if q.After != "" {
+		after, err := decodeCursor(q.After)
+		if err != nil {
+			return q, err
+		}
+		if after.Sort != q.Sort || after.Descending != q.Descending {
+			return q, fmt.Errorf("%w: cursor is for a different sort", ErrInvalidQuery)
+		}
+		q.after = after
+	}
+	return q, nil
+}
+
+// The value items are ordered by, which compares the same way as strings as
+// it does in the sort. Times are UTC to the microsecond, as stamped
+const sortTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+func sortKey(item ToDoItem, sort SortKey) string {
+	switch sort {
+	case SortPriority:
+		if rank := slices.Index(priorities, item.Priority); rank >= 0 {
+			return fmt.Sprint(rank)
+		}
+		return ""
+	case SortTitle:
+		return strings.ToLower(string(item.Title))
+	default:
+		if item.CreatedAt == nil {
+			return ""
+		}
+		return item.CreatedAt.UTC().Format(sortTimeLayout)
+	}
+}
+
+// Whether `item` is one the Query picks, ignoring pages
+func (q Query) matches(item ToDoItem) bool {
+	if item.List != q.List || (q.List == "" && item.Owner != q.Owner) {
+		return false
+	}
+	if q.Complete != nil && item.Complete != *q.Complete {
+		return false
+	}
+	if q.Priority != "" && item.Priority != q.Priority {
+		return false
+	}
+	if q.Series != "" && item.Series != q.Series {
+		return false
+	}
+	if !strings.Contains(strings.ToLower(string(item.Title)), strings.ToLower(q.TitleContains)) {
+		return false
+	}
+	if len(q.Tags) > 0 {
+		matched := 0
+		for _, tag := range q.Tags {
+			if slices.Contains(item.Tags, tag) {
+				matched++
+			}
+		}
+		if matched == 0 || q.AllTags && matched < len(q.Tags) {
+			return false
+		}
+	}
+	return q.Due.matches(item, q.Now)
+}
+
+func (q Query) compare(key string, id Id, other string, otherId Id) int {
+	order := cmp.Or(cmp.Compare(key, other), cmp.Compare(id, otherId))
+	if q.Descending {
+		return -order
+	}
+	return order
+}
+
+// Runs the Query over every item a store holds. For stores that cannot do
+// better
+func (q Query) apply(items []ToDoItem) Page {
+	var picked []ToDoItem
+	for _, item := range items {
+		if !q.matches(item) {
+			continue
+		}
+		if q.after != nil && q.compare(sortKey(item, q.Sort), item.Id, q.after.Key, q.after.Id) <= 0 {
+			continue
+		}
+		picked = append(picked, item)
+	}
+	slices.SortFunc(picked, func(a, b ToDoItem) int {
+		return q.compare(sortKey(a, q.Sort), a.Id, sortKey(b, q.Sort), b.Id)
+	})
+	return q.page(picked)
+}
+
+// Cuts `items`, already picked and ordered, down to the Query's Limit
+func (q Query) page(items []ToDoItem) Page {
+	if q.Limit == 0 || len(items) <= q.Limit {
+		return Page{Items: items}
+	}
+	last := items[q.Limit-1]
+	return Page{
+		Items: items[:q.Limit],
+		Next:  cursor{q.Sort, q.Descending, sortKey(last, q.Sort), last.Id}.encode(),
+	}
+}
+
+// Reads the items in `q.List`, or in `user`'s personal list if it is empty,
+// that `q` picks. Fails with ErrInvalidQuery or ErrInvalidDueFilter if `q`
+// cannot be run
+func (d DataAccessLayer) Query(ctx context.Context, user User, q Query) (Page, error) {
+	q, err := q.validate()
+	if err != nil {
+		return Page{}, err
+	}
+	var page Page
+	err = d.transact(ctx, true, func(ctx context.Context, db DataStore) error {
+		var err error
+		page, err = d.query(ctx, user, q)
+		return err
+	})
+	return page, err
+}
+
+// Runs a validated Query for `user`
+func (d *DataAccessLayer) query(ctx context.Context, user User, q Query) (Page, error) {
+	q, err := d.scope(ctx, user, q)
+	if err != nil {
+		return Page{}, err
+	}
+	if !q.Actionable {
+		return d.db.query(ctx, q)
+	}
+	// Blockers can be in other lists, so the stores cannot tell which items
+	// are blocked. They pick every incomplete item and the DAL pages what is
+	// left
+	every := q
+	every.Limit = 0
+	page, err := d.db.query(ctx, every)
+	if err != nil {
+		return Page{}, err
+	}
+	return d.actionable(ctx, q, page)
+}
+
+// Sets the Query's Owner to `user` if it reads their personal list, or checks
+// they can see the List it reads
+func (d *DataAccessLayer) scope(ctx context.Context, user User, q Query) (Query, error) {
+	q.Owner = ""
+	if q.List == "" {
+		q.Owner = user
+	} else if _, err := d.listWithRole(ctx, user, q.List, RoleViewer); err != nil {
+		return q, err
+	}
+	return q, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateQuery(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		got, err := Query{Priority: " high "}.validate()
+
+		if err != nil || got.Sort != SortCreated || got.Priority != PriorityHigh {
+			t.Errorf("want created and High, got %v %v %v", got.Sort, got.Priority, err)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		titleCursor := cursor{SortTitle, false, "a", "1"}.encode()
+		queries := map[string]Query{
+			"sort":     {Sort: "colour"},
+			"priority": {Priority: "urgent"},
+			"limit":    {Limit: -1},
+			"cursor":   {After: "not a cursor"},
+			"mismatch": {Sort: SortTitle, Descending: true, After: titleCursor},
+		}
+		for name, q := range queries {
+			if _, err := q.validate(); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("%s: want %v, got %v", name, ErrInvalidQuery, err)
+			}
+		}
+		if _, err := (Query{Due: "someday"}).validate(); err != ErrInvalidDueFilter {
+			t.Errorf("want %v, got %v", ErrInvalidDueFilter, err)
+		}
+	})
+}
+
+func TestApplyQuery(t *testing.T) {
+	created := time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC)
+	var items []ToDoItem
+	for i, title := range []Title{"b", "a", "c", "d", "e"} {
+		item := ConstructToDoItem(title, "medium", false)
+		item = stamp(item, nil, AnonymousUser, created.Add(time.Duration(i)*time.Hour))
+		items = append(items, item)
+	}
+	titles := func(page Page) []Title {
+		var got []Title
+		for _, item := range page.Items {
+			got = append(got, item.Title)
+		}
+		return got
+	}
+	t.Run("Sorts", func(t *testing.T) {
+		q, _ := Query{Sort: SortTitle, Descending: true}.validate()
+
+		got := q.apply(items)
+
+		if want := []Title{"e", "d", "c", "b", "a"}; !reflect.DeepEqual(titles(got), want) || got.Next != "" {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	})
+	t.Run("Pages carry on from the cursor", func(t *testing.T) {
+		q, _ := Query{Limit: 2}.validate()
+		var got []Title
+		for pages := 0; ; pages++ {
+			if pages > len(items) {
+				t.Fatal("pages never ended")
+			}
+			page := q.apply(items)
+			got = append(got, titles(page)...)
+			if page.Next == "" {
+				break
+			}
+			q.After = page.Next
+			q, _ = q.validate()
+		}
+
+		if want := []Title{"b", "a", "c", "d", "e"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	})
+	t.Run("Items added before the cursor are not repeated", func(t *testing.T) {
+		q, _ := Query{Sort: SortTitle, Limit: 2}.validate()
+		first := q.apply(items)
+		q.After = first.Next
+		q, _ = q.validate()
+		added := stamp(ConstructToDoItem("0", "low", false), nil, AnonymousUser, created)
+
+		got := q.apply(append(items, added))
+
+		if want := []Title{"c", "d"}; !reflect.DeepEqual(titles(got), want) {
+			t.Errorf("want %v, got %v", want, titles(got))
+		}
+	})
+}
+
+func TestDALQuery(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	dal.Create(ctx, "alice", ConstructToDoItem("Keep sanity", "high", false))
+	dal.Create(ctx, "bob", ConstructToDoItem("Keep calm", "high", false))
+	t.Run("Personal items are the user's own", func(t *testing.T) {
+		got, err := dal.Query(ctx, "alice", Query{TitleContains: "keep"})
+
+		if err != nil || len(got.Items) != 1 || got.Items[0].Owner != "alice" {
+			t.Errorf("want only alice's item, got %v %v", got, err)
+		}
+	})
+	t.Run("Lists need a role", func(t *testing.T) {
+		list, _ := dal.CreateList(ctx, "alice", "Groceries")
+
+		if _, err := dal.Query(ctx, "bob", Query{List: list.Id}); err != ErrNoList {
+			t.Errorf("want %v, got %v", ErrNoList, err)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := dal.Query(ctx, "alice", Query{Sort: "colour"}); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("want %v, got %v", ErrInvalidQuery, err)
+		}
+	})
+}
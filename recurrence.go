@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How often an item comes round again, as "daily", "weekly", "monthly" or an
+// RRULE (RFC 5545) using only FREQ (DAILY, WEEKLY or MONTHLY), INTERVAL,
+// BYDAY (weekly only), BYMONTHDAY (monthly only), and COUNT or UNTIL. Kept
+// as an RRULE
+type Recurrence string
+
+var ErrNoSeries = errors.New("no open items in that series")
+
+var errInvalidRecurrence = errors.New("must be daily, weekly, monthly or an RRULE such as FREQ=WEEKLY;BYDAY=MO,TH")
+
+// A Recurrence taken apart
+type recurrenceRule struct {
+	freq       string
+	interval   int
+	byDay      []time.Weekday
+	byMonthDay int
+	count      int
+	// As given, the end of the day for a date alone
+	until string
+}
+
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+var recurrenceShorthands = map[string]Recurrence{
+	"daily":   "FREQ=DAILY",
+	"weekly":  "FREQ=WEEKLY",
+	"monthly": "FREQ=MONTHLY",
+}
+
+const (
+	untilDateLayout = "20060102"
+	untilTimeLayout = "20060102T150405Z"
+)
+
+func (r Recurrence) parse() (recurrenceRule, error) {
+	text := strings.TrimSpace(string(r))
+	if shorthand, ok := recurrenceShorthands[strings.ToLower(text)]; ok {
+		text = string(shorthand)
+	}
+	text = strings.TrimPrefix(strings.ToUpper(text), "RRULE:")
+	rule := recurrenceRule{interval: 1}
+	for _, part := range strings.Split(text, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return rule, errInvalidRecurrence
+		}
+		var err error
+		switch key {
+		case "FREQ":
+			if !slices.Contains([]string{"DAILY", "WEEKLY", "MONTHLY"}, value) {
+				return rule, errInvalidRecurrence
+			}
+			rule.freq = value
+		case "INTERVAL":
+			rule.interval, err = positive(value)
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day := slices.Index(weekdayCodes, code)
+				if day < 0 {
+					return rule, errInvalidRecurrence
+				}
+				if !slices.Contains(rule.byDay, time.Weekday(day)) {
+					rule.byDay = append(rule.byDay, time.Weekday(day))
+				}
+			}
+		case "BYMONTHDAY":
+			rule.byMonthDay, err = positive(value)
+			if rule.byMonthDay > 31 {
+				err = errInvalidRecurrence
+			}
+		case "COUNT":
+			rule.count, err = positive(value)
+		case "UNTIL":
+			_, err = time.Parse(untilDateLayout, value)
+			if err != nil {
+				_, err = time.Parse(untilTimeLayout, value)
+			}
+			rule.until = value
+		default:
+			err = errInvalidRecurrence
+		}
+		if err != nil {
+			return rule, errInvalidRecurrence
+		}
+	}
+	if rule.freq == "" || len(rule.byDay) > 0 && rule.freq != "WEEKLY" ||
+		rule.byMonthDay > 0 && rule.freq != "MONTHLY" || rule.count > 0 && rule.until != "" {
+		return rule, errInvalidRecurrence
+	}
+	return rule, nil
+}
+
+func positive(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err == nil && n < 1 {
+		err = errInvalidRecurrence
+	}
+	return n, err
+}
+
+func (rule recurrenceRule) String() string {
+	parts := []string{"FREQ=" + rule.freq}
+	if rule.interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", rule.interval))
+	}
+	if len(rule.byDay) > 0 {
+		var codes []string
+		// Weeks start on Monday
+		slices.SortFunc(rule.byDay, func(a, b time.Weekday) int { return int((a+6)%7) - int((b+6)%7) })
+		for _, day := range rule.byDay {
+			codes = append(codes, weekdayCodes[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if rule.byMonthDay > 0 {
+		parts = append(parts, fmt.Sprintf("BYMONTHDAY=%d", rule.byMonthDay))
+	}
+	if rule.count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", rule.count))
+	}
+	if rule.until != "" {
+		parts = append(parts, "UNTIL="+rule.until)
+	}
+	return strings.Join(parts, ";")
+}
+
+// Returns `r` as an RRULE. Monthly rules are pinned to the day of the month
+// `due` falls on, so a series due on the 31st comes back to it after shorter
+// months
+func (r Recurrence) normalise(due *time.Time) (Recurrence, error) {
+	if strings.TrimSpace(string(r)) == "" {
+		return "", nil
+	}
+	rule, err := r.parse()
+	if err != nil {
+		return r, err
+	}
+	if rule.freq == "MONTHLY" && rule.byMonthDay == 0 && due != nil {
+		rule.byMonthDay = due.Day()
+	}
+	return Recurrence(rule.String()), nil
+}
+
+// The first time after `due` the rule comes round, at the same time of day
+func (rule recurrenceRule) next(due time.Time) time.Time {
+	switch rule.freq {
+	case "MONTHLY":
+		day := rule.byMonthDay
+		if day == 0 {
+			day = due.Day()
+		}
+		hour, min, sec := due.Clock()
+		month := time.Date(due.Year(), due.Month()+time.Month(rule.interval), 1, hour, min, sec, 0, due.Location())
+		if last := month.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+		return month.AddDate(0, 0, day-1)
+	case "WEEKLY":
+		if len(rule.byDay) == 0 {
+			return due.AddDate(0, 0, 7*rule.interval)
+		}
+		for days := 1; ; days++ {
+			candidate := due.AddDate(0, 0, days)
+			weeks := int(startOfWeek(candidate).Sub(startOfWeek(due)).Round(24*time.Hour).Hours()) / (24 * 7)
+			if weeks%rule.interval == 0 && slices.Contains(rule.byDay, candidate.Weekday()) {
+				return candidate
+			}
+		}
+	default:
+		return due.AddDate(0, 0, rule.interval)
+	}
+}
+
+// Whether the rule has run out by the time `due` comes round. An UNTIL date
+// lasts to the end of that day where `due` is
+func (rule recurrenceRule) ended(due time.Time, occurrence int) bool {
+	if rule.count > 0 {
+		return occurrence > rule.count
+	}
+	if until, err := time.Parse(untilTimeLayout, rule.until); err == nil {
+		return due.After(until)
+	}
+	if until, err := time.ParseInLocation(untilDateLayout, rule.until, due.Location()); err == nil {
+		return !due.Before(until.AddDate(0, 0, 1))
+	}
+	return false
+}
+
+// Occurrences get an Id made from their series, so completing one again
+// never makes a second of the one after
+func occurrenceId(series Id, occurrence int) Id {
+	return Id(uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("series:%s/%d", series, occurrence))).String())
+}
+
+// Starts a series for an item that has just been given a Recurrence. Items
+// stay in the series they started in, whatever the request says
+func settleSeries(item ToDoItem, existing *ToDoItem) ToDoItem {
+	item.Series, item.Occurrence = "", 0
+	if existing != nil {
+		item.Series, item.Occurrence = existing.Series, existing.Occurrence
+	}
+	if item.Recurrence != "" && item.Series == "" {
+		item.Series, item.Occurrence = item.Id, 1
+	}
+	return item
+}
+
+// The open item that follows `item` in its series, with its checklist reset.
+// Its blockers are not carried over. Returns false if `item` does not recur
+// or its series has ended
+func (item ToDoItem) nextOccurrence() (ToDoItem, bool) {
+	if item.Recurrence == "" || item.Due == nil {
+		return ToDoItem{}, false
+	}
+	rule, err := item.Recurrence.parse()
+	if err != nil {
+		return ToDoItem{}, false
+	}
+	due := rule.next(*item.Due)
+	if rule.ended(due, item.Occurrence+1) {
+		return ToDoItem{}, false
+	}
+	next := item.clone()
+	next.Id = occurrenceId(item.Series, item.Occurrence+1)
+	next.Occurrence++
+	next.Due = &due
+	next.Complete = false
+	next.BlockedBy = nil
+	for i := range next.Checklist {
+		next.Checklist[i].Complete = false
+	}
+	return next, true
+}
+
+// Creates the next occurrence of `item` as it is completed over `existing`.
+// Returns the occurrence, or false if none was made. Does nothing if the
+// occurrence already exists, as it does when an item is reopened and
+// completed again
+func (d *DataAccessLayer) recur(ctx context.Context, user User, item ToDoItem, existing ToDoItem) (ToDoItem, bool, error) {
+	if !completing(item, &existing) {
+		return ToDoItem{}, false, nil
+	}
+	next, ok := item.nextOccurrence()
+	if !ok {
+		return ToDoItem{}, false, nil
+	}
+	next = stamp(next, nil, user, stampTime())
+	err := d.db.create(ctx, next)
+	if errors.Is(err, ErrCannotCreate) {
+		return ToDoItem{}, false, nil
+	}
+	return next, err == nil, err
+}
+
+// Applies `change` to every open item in `series`, in the order they occur,
+// the same as Patch would. Every item is changed and checked before any is
+// written, so a change one of them refuses is made to none. The store failing
+// part way through the writes can still leave the earlier ones changed.
+// Complete items are left as they were. Fails with ErrNoSeries if `user`
+// cannot see any open item in the series, or ErrForbidden if they cannot
+// change one of them
+func (d DataAccessLayer) EditSeries(ctx context.Context, user User, series Id, change func(item *ToDoItem) error) ([]ToDoItem, error) {
+	var edited []ToDoItem
+	err := d.transact(ctx, false, func(ctx context.Context, db DataStore) error {
+		items, err := db.read(ctx)
+		if err != nil {
+			return err
+		}
+		slices.SortFunc(items, func(a, b ToDoItem) int { return a.Occurrence - b.Occurrence })
+		var replaced []ToDoItem
+		for _, existing := range items {
+			if existing.Series != series || existing.Complete {
+				continue
+			}
+			err := d.authorise(ctx, user, existing, RoleEditor, ErrNoSeries)
+			if errors.Is(err, ErrNoSeries) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			patched, err := d.patch(ctx, user, existing, change)
+			if err != nil {
+				return err
+			}
+			edited = append(edited, patched)
+			replaced = append(replaced, existing)
+		}
+		if len(edited) == 0 {
+			return ErrNoSeries
+		}
+		for i, item := range edited {
+			if err := d.replace(ctx, user, item, replaced[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return edited, nil
+}
+
+// Stops every open item in `series` recurring, so no more are made. Checks
+// the same as EditSeries
+func (d DataAccessLayer) StopSeries(ctx context.Context, user User, series Id) ([]ToDoItem, error) {
+	return d.EditSeries(ctx, user, series, func(item *ToDoItem) error {
+		item.Recurrence = ""
+		return nil
+	})
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNormaliseRecurrence(t *testing.T) {
+	due := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		given Recurrence
+		want  Recurrence
+	}{
+		{"", ""},
+		{"daily", "FREQ=DAILY"},
+		{" Weekly ", "FREQ=WEEKLY"},
+		{"monthly", "FREQ=MONTHLY;BYMONTHDAY=31"},
+		{"RRULE:freq=weekly;byday=fr,mo;interval=2", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR"},
+		{"FREQ=DAILY;COUNT=3", "FREQ=DAILY;COUNT=3"},
+		{"FREQ=MONTHLY;BYMONTHDAY=15;UNTIL=20241231", "FREQ=MONTHLY;BYMONTHDAY=15;UNTIL=20241231"},
+	}
+	for _, c := range cases {
+		got, err := c.given.normalise(&due)
+		if err != nil || got != c.want {
+			t.Errorf("%q: want %q, got %q %v", c.given, c.want, got, err)
+		}
+	}
+	for _, bad := range []Recurrence{"hourly", "FREQ=YEARLY", "FREQ=DAILY;BYDAY=MO", "FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=DAILY;INTERVAL=0", "FREQ=DAILY;COUNT=2;UNTIL=20240101", "INTERVAL=2", "FREQ=MONTHLY;BYMONTHDAY=32"} {
+		if _, err := bad.normalise(&due); err == nil {
+			t.Errorf("%q: want an error", bad)
+		}
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	london, _ := time.LoadLocation("Europe/London")
+	// A Wednesday
+	due := time.Date(2024, time.January, 31, 9, 0, 0, 0, london)
+	cases := []struct {
+		rule Recurrence
+		want time.Time
+	}{
+		{"daily", time.Date(2024, time.February, 1, 9, 0, 0, 0, london)},
+		{"FREQ=DAILY;INTERVAL=3", time.Date(2024, time.February, 3, 9, 0, 0, 0, london)},
+		{"weekly", time.Date(2024, time.February, 7, 9, 0, 0, 0, london)},
+		{"FREQ=WEEKLY;BYDAY=MO,FR", time.Date(2024, time.February, 2, 9, 0, 0, 0, london)},
+		{"FREQ=WEEKLY;BYDAY=MO,TU;INTERVAL=2", time.Date(2024, time.February, 12, 9, 0, 0, 0, london)},
+		{"monthly", time.Date(2024, time.February, 29, 9, 0, 0, 0, london)},
+		{"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31", time.Date(2024, time.March, 31, 9, 0, 0, 0, london)},
+	}
+	for _, c := range cases {
+		rule, _ := c.rule.normalise(&due)
+		item := ToDoItem{Id: "1", Series: "1", Occurrence: 1, Recurrence: rule, Due: &due, Complete: true}
+
+		next, ok := item.nextOccurrence()
+
+		if !ok || !next.Due.Equal(c.want) || bool(next.Complete) || next.Occurrence != 2 || next.Series != "1" {
+			t.Errorf("%q: want an open second occurrence due %v, got %v %v", c.rule, c.want, next, ok)
+		}
+	}
+	t.Run("Month ends", func(t *testing.T) {
+		feb := time.Date(2024, time.February, 29, 9, 0, 0, 0, london)
+		item := ToDoItem{Recurrence: "FREQ=MONTHLY;BYMONTHDAY=31", Due: &feb}
+		if next, _ := item.nextOccurrence(); next.Due.Day() != 31 || next.Due.Hour() != 9 {
+			t.Errorf("want the 31st of March at 9, got %v", next.Due)
+		}
+	})
+	t.Run("Clocks change", func(t *testing.T) {
+		saturday := time.Date(2024, time.March, 30, 9, 0, 0, 0, london)
+		item := ToDoItem{Recurrence: "FREQ=DAILY", Due: &saturday}
+		if next, _ := item.nextOccurrence(); next.Due.Day() != 31 || next.Due.Hour() != 9 {
+			t.Errorf("want the time of day kept, got %v", next.Due)
+		}
+	})
+	t.Run("Ended", func(t *testing.T) {
+		for _, rule := range []Recurrence{"FREQ=DAILY;COUNT=1", "FREQ=DAILY;UNTIL=20240131", "FREQ=DAILY;UNTIL=20240201T085959Z"} {
+			item := ToDoItem{Recurrence: rule, Due: &due, Occurrence: 1}
+			if next, ok := item.nextOccurrence(); ok {
+				t.Errorf("%q: want no more occurrences, got %v", rule, next)
+			}
+		}
+		item := ToDoItem{Recurrence: "FREQ=DAILY;UNTIL=20240201", Due: &due, Occurrence: 1}
+		if _, ok := item.nextOccurrence(); !ok {
+			t.Errorf("want an occurrence on the UNTIL date")
+		}
+	})
+}
+
+func TestValidateRecurrence(t *testing.T) {
+	item := ConstructToDoItem("Feed cats", "high", false)
+	item.Recurrence = "daily"
+	var invalid *ValidationError
+	if _, err := item.validate(); !errors.As(err, &invalid) || invalid.Fields["recurrence"] == "" {
+		t.Errorf("want a problem with recurrence without a due date, got %v", err)
+	}
+	due := time.Now()
+	item.Due = &due
+	item.Recurrence = "sometimes"
+	if _, err := item.validate(); !errors.As(err, &invalid) || invalid.Fields["recurrence"] == "" {
+		t.Errorf("want a problem with recurrence, got %v", err)
+	}
+}
+
+func TestRecurrence(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	due := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	item := ConstructToDoItem("Feed cats", "high", false)
+	item.Due, item.Recurrence = &due, "daily"
+	item.Checklist = []SubItem{{Title: "Fill the bowl"}}
+	item, err := dal.Create(ctx, AnonymousUser, item)
+	if err != nil || item.Series != item.Id || item.Occurrence != 1 {
+		t.Fatalf("want the item to start its series, got %v %v", item, err)
+	}
+	series := func() []ToDoItem {
+		page, _ := dal.Query(ctx, AnonymousUser, Query{Series: item.Series})
+		return page.Items
+	}
+
+	t.Run("Completing makes the next occurrence", func(t *testing.T) {
+		item.Complete, item.Checklist[0].Complete = true, true
+		if item, err = dal.Update(ctx, AnonymousUser, item); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+
+		items := series()
+
+		if len(items) != 2 {
+			t.Fatalf("want both occurrences, got %v", items)
+		}
+		next := items[1]
+		if bool(next.Complete || next.Checklist[0].Complete) || next.Occurrence != 2 || !next.Due.Equal(due.AddDate(0, 0, 1)) || next.Version != 1 {
+			t.Errorf("want an open second occurrence due the next day with its checklist reset, got %v", next)
+		}
+	})
+	t.Run("Completing again makes no more", func(t *testing.T) {
+		item.Complete = false
+		item, _ = dal.Update(ctx, AnonymousUser, item)
+		item.Complete = true
+		item, _ = dal.Update(ctx, AnonymousUser, item)
+
+		if items := series(); len(items) != 2 {
+			t.Errorf("want still two occurrences, got %v", items)
+		}
+	})
+	t.Run("Series cannot be changed", func(t *testing.T) {
+		item.Series, item.Occurrence = "other", 7
+		updated, err := dal.Update(ctx, AnonymousUser, item)
+
+		if err != nil || updated.Series != item.Id || updated.Occurrence != 1 {
+			t.Errorf("want the series kept, got %v %v", updated, err)
+		}
+		item = updated
+	})
+	t.Run("Patch completes too", func(t *testing.T) {
+		next := series()[1]
+		if _, err := dal.Patch(ctx, AnonymousUser, next.Id, 0, func(item *ToDoItem) error {
+			item.Complete = true
+			return nil
+		}); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if items := series(); len(items) != 3 || !items[2].Due.Equal(due.AddDate(0, 0, 2)) {
+			t.Errorf("want a third occurrence, got %v", items)
+		}
+	})
+	t.Run("Edit series", func(t *testing.T) {
+		edited, err := dal.EditSeries(ctx, AnonymousUser, item.Series, func(item *ToDoItem) error {
+			item.Priority = "low"
+			return nil
+		})
+
+		if err != nil || len(edited) != 1 || edited[0].Priority != PriorityLow || edited[0].Occurrence != 3 {
+			t.Errorf("want only the open occurrence changed, got %v %v", edited, err)
+		}
+		if _, err := dal.EditSeries(ctx, "bob", item.Series, func(item *ToDoItem) error { return nil }); err != ErrNoSeries {
+			t.Errorf("want %v, got %v", ErrNoSeries, err)
+		}
+	})
+	t.Run("Stop series", func(t *testing.T) {
+		stopped, err := dal.StopSeries(ctx, AnonymousUser, item.Series)
+		if err != nil || len(stopped) != 1 || stopped[0].Recurrence != "" {
+			t.Fatalf("want the open occurrence to stop repeating, got %v %v", stopped, err)
+		}
+
+		last := stopped[0]
+		last.Complete = true
+		dal.Update(ctx, AnonymousUser, last)
+
+		if items := series(); len(items) != 3 {
+			t.Errorf("want no more occurrences, got %v", items)
+		}
+		if _, err := dal.StopSeries(ctx, AnonymousUser, item.Series); err != ErrNoSeries {
+			t.Errorf("want %v once nothing is open, got %v", ErrNoSeries, err)
+		}
+	})
+}
+
+func TestRecurrenceFailure(t *testing.T) {
+	ctx := context.Background()
+	db := newEmptyInMemoryDataStore()
+	due := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	item := ConstructToDoItem("Feed cats", "high", false)
+	item.Due, item.Recurrence = &due, "daily"
+	item, err := NewDataAccessLayer(&db).Create(ctx, AnonymousUser, item)
+	if err != nil {
+		t.Fatalf("Unexpected error thrown! Got: %v", err)
+	}
+	// Shares the items, but cannot create the next occurrence
+	broken := brokenDataStore{db}
+	dal := NewDataAccessLayer(&broken)
+
+	item.Complete = true
+	if _, err := dal.Update(ctx, AnonymousUser, item); err == nil {
+		t.Errorf("want an error")
+	}
+	_, err = dal.Patch(ctx, AnonymousUser, item.Id, item.Version, func(item *ToDoItem) error {
+		item.Complete = true
+		return nil
+	})
+	if err == nil {
+		t.Errorf("want an error")
+	}
+
+	if stored, _ := dal.Get(ctx, AnonymousUser, item.Id); stored.Complete || stored.Version != item.Version {
+		t.Errorf("want the item left as it was, got %v", stored)
+	}
+}
+
+func TestEditSeriesFailure(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	due := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	first := ConstructToDoItem("Feed cats", "high", false)
+	first.Due, first.Recurrence = &due, "daily"
+	first, _ = dal.Create(ctx, AnonymousUser, first)
+	first.Complete = true
+	first, _ = dal.Update(ctx, AnonymousUser, first)
+	first.Complete = false
+	first, err := dal.Update(ctx, AnonymousUser, first)
+	if err != nil {
+		t.Fatalf("Unexpected error thrown! Got: %v", err)
+	}
+	blocker := createBlocked(t, dal, "Buy food")
+	_, err = dal.Patch(ctx, AnonymousUser, occurrenceId(first.Series, 2), 0, func(item *ToDoItem) error {
+		item.BlockedBy = []Id{blocker.Id}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error thrown! Got: %v", err)
+	}
+
+	_, err = dal.EditSeries(ctx, AnonymousUser, first.Series, func(item *ToDoItem) error {
+		item.Complete = true
+		return nil
+	})
+
+	if err != ErrBlocked {
+		t.Errorf("want %v, got %v", ErrBlocked, err)
+	}
+	if stored, _ := dal.Get(ctx, AnonymousUser, first.Id); stored.Complete || stored.Version != first.Version {
+		t.Errorf("want the first occurrence left as it was, got %v", stored)
+	}
+}
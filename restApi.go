@@ -1,9 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 func handleError(err error, w http.ResponseWriter) {
@@ -17,11 +29,118 @@ func handleError(err error, w http.ResponseWriter) {
 	}
 }
 
+// Mirrors the ApiResponse definition in Reqs/to-do-app-api-v1.yaml. Fields
+// is only set for a ValidationError
+type apiResponse struct {
+	Code    int               `json:"code"`
+	Type    string            `json:"type"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	response := apiResponse{
+		Code:    status,
+		Type:    http.StatusText(status),
+		Message: err.Error(),
+	}
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		response.Fields = invalid.Fields
+	}
+	writeJSON(w, status, response)
+}
+
+func statusFromError(err error) int {
+	switch {
+	case errors.Is(err, ErrCannotCreate),
+		errors.Is(err, ErrAccountExists),
+		errors.Is(err, ErrListExists),
+		errors.Is(err, ErrPatchTestFailed),
+		errors.Is(err, ErrBlocked):
+		return http.StatusConflict
+	case errors.Is(err, ErrConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrInvalidDueFilter),
+		errors.Is(err, ErrInvalidQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrBadCredentials):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrInvalidUserName),
+		errors.Is(err, ErrWeakPassword),
+		errors.Is(err, ErrInvalidScope),
+		errors.Is(err, ErrInvalidRole),
+		errors.Is(err, ErrMissingListName),
+		errors.Is(err, ErrLastOwner),
+		errors.Is(err, ErrInvalidPatch),
+		errors.Is(err, ErrDependencyCycle),
+		errors.As(err, new(*ValidationError)):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrCannotUpdate),
+		errors.Is(err, ErrCannotDelete),
+		errors.Is(err, ErrCannotQuery),
+		errors.Is(err, ErrNoAPIKey),
+		errors.Is(err, ErrNoAccount),
+		errors.Is(err, ErrNoList),
+		errors.Is(err, ErrNoSubItem),
+		errors.Is(err, ErrNoSeries):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, ErrDataStoreLocked):
+		return http.StatusServiceUnavailable
+	case errors.As(err, new(*StorageError)):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Writes the status matching an error returned by the DAL, logging anything
+// that is the server's fault
+func writeDALError(w http.ResponseWriter, r *http.Request, err error) {
+	status := statusFromError(err)
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", "err", err)
+	}
+	writeAPIError(w, status, err)
+}
+
+var errInvalidBody = errors.New("request body is not a valid ToDo")
+var errInvalidId = errors.New("invalid ID supplied")
+var errInvalidTimezone = errors.New("tz must be an IANA timezone such as Europe/London")
+var errMissingSearch = errors.New("q must name something to search for")
+var errUnsupportedPatch = errors.New("patches must be " + mergePatchType + " or " + jsonPatchType)
+
+// Decodes a ToDo from the request body, writing a 400 or 422 and returning
+// false when it cannot be used
+func decodeToDoItem(w http.ResponseWriter, r *http.Request) (ToDoItem, bool) {
+	var item ToDoItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errInvalidBody)
+		return item, false
+	}
+	item, err := item.validate()
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return item, false
+	}
+	return item, true
+}
+
 type homeHandler struct{}
 
 func (h *homeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("This is the to do app"))
-	w.Write([]byte("Available endpoints are create/ read/ update/ delete/"))
+	w.Write([]byte("Available endpoints are v1/todo v1/todo/{id} v2/users/{user}/todos v2/users/{user}/todos/{id} v2/lists v2/lists/{list}/todos v2/lists/{list}/todos/{id} create/ read/ update/ delete/"))
 }
 
 type createHandler struct {
@@ -32,7 +151,7 @@ func (h *createHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		var data ToDoItem
 		json.NewDecoder(r.Body).Decode(&data)
-		err := h.dal.Create(data)
+		_, err := h.dal.Create(r.Context(), callerUser(r), data)
 		handleError(err, w)
 	}
 }
@@ -42,11 +161,15 @@ type readHandler struct {
 }
 
 func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	items := h.dal.Read()
+	items, err := h.dal.Read(r.Context(), callerUser(r), personalList(r))
+	if err != nil {
+		handleError(err, w)
+		return
+	}
 	data, err := json.MarshalIndent(items, "", "  ")
 	if err != nil {
 		errorMsg := fmt.Sprintf("ERROR! %q", err)
-		fmt.Println(errorMsg)
+		slog.ErrorContext(r.Context(), "could not encode items", "err", err)
 		w.Write([]byte(errorMsg))
 	} else {
 		w.Write([]byte(data))
@@ -61,7 +184,7 @@ func (h *updateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		var data ToDoItem
 		json.NewDecoder(r.Body).Decode(&data)
-		err := h.dal.Update(data)
+		_, err := h.dal.Update(r.Context(), callerUser(r), data)
 		handleError(err, w)
 	}
 }
@@ -74,17 +197,956 @@ func (h *deleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		var data ToDoItem
 		json.NewDecoder(r.Body).Decode(&data)
-		err := h.dal.Delete(data)
+		err := h.dal.Delete(r.Context(), callerUser(r), data)
 		handleError(err, w)
 	}
 }
 
-func StartAPI(dal DataAccessLayer) {
+// Works out who a request is acting for. The v1 endpoints act for whoever
+// is logged in, or AnonymousUser if nobody is, the v2 endpoints name the user
+// in the path
+type userResolver func(r *http.Request) User
+
+func callerUser(r *http.Request) User {
+	user, _ := UserFromContext(r.Context())
+	return user
+}
+
+func pathUser(r *http.Request) User {
+	return User(r.PathValue("user"))
+}
+
+// Works out which List a request is for. Everything outside /v2/lists is
+// for the user's personal list
+type listResolver func(r *http.Request) ListId
+
+func personalList(r *http.Request) ListId {
+	return ""
+}
+
+func pathList(r *http.Request) ListId {
+	return ListId(r.PathValue("list"))
+}
+
+// Fails with `notFound` if item `id` exists but is not in `list`, so an item
+// cannot be reached through another List's path. Items never change List, so
+// the answer cannot go stale before the caller acts on it
+func checkInList(ctx context.Context, dal DataAccessLayer, user User, id Id, list ListId, notFound error) error {
+	item, err := dal.Get(ctx, user, id)
+	if errors.Is(err, ErrCannotQuery) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if item.List != list {
+		return notFound
+	}
+	return nil
+}
+
+// An item's ETag is its Version, which changes on every write
+func setETag(w http.ResponseWriter, item ToDoItem) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(item.Version)+`"`)
+}
+
+// Reads the Version an If-Match header wants to write over. Returns 0, so the
+// write goes ahead regardless, if there is no header or it is *. Returns
+// false if it is not an ETag this API hands out, as it can never match
+func ifMatchVersion(r *http.Request) (int, bool) {
+	match := strings.TrimSpace(r.Header.Get("If-Match"))
+	if match == "" || match == "*" {
+		return 0, true
+	}
+	unquoted, quoted := strings.CutPrefix(match, `"`)
+	unquoted, closed := strings.CutSuffix(unquoted, `"`)
+	version, err := strconv.Atoi(unquoted)
+	if !quoted || !closed || err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// POST /v1/todo, POST /v2/users/{user}/todos, POST /v2/lists/{list}/todos
+type todoAddHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *todoAddHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	item, ok := decodeToDoItem(w, r)
+	if !ok {
+		return
+	}
+	if item.Id == "" {
+		item.Id = Id(uuid.NewString())
+	}
+	item.List = h.listOf(r)
+	created, err := h.dal.Create(r.Context(), h.userOf(r), item)
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	setETag(w, created)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// Writes to a request with ?force=true can complete items whose blockers are
+// still open
+func writeContext(r *http.Request) context.Context {
+	if r.URL.Query().Get("force") == "true" {
+		return WithForce(r.Context())
+	}
+	return r.Context()
+}
+
+// PUT /v1/todo, PUT /v2/users/{user}/todos/{id},
+// PUT /v2/lists/{list}/todos/{id}. Takes If-Match and ?force=true, the
+// body's version is ignored
+type todoAddOrUpdateHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *todoAddOrUpdateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	item, ok := decodeToDoItem(w, r)
+	if !ok {
+		return
+	}
+	if pathId := Id(r.PathValue("id")); pathId != "" {
+		if item.Id != "" && item.Id != pathId {
+			writeAPIError(w, http.StatusBadRequest, errInvalidId)
+			return
+		}
+		item.Id = pathId
+	}
+	if item.Id == "" {
+		writeAPIError(w, http.StatusBadRequest, errInvalidId)
+		return
+	}
+	version, matchable := ifMatchVersion(r)
+	if !matchable {
+		writeAPIError(w, http.StatusPreconditionFailed, ErrConflict)
+		return
+	}
+	conditional := r.Header.Get("If-Match") != ""
+	user := h.userOf(r)
+	item.List = h.listOf(r)
+	item.Version = version
+	err := checkInList(r.Context(), h.dal, user, item.Id, item.List, ErrCannotUpdate)
+	var stored ToDoItem
+	if err == nil {
+		stored, err = h.dal.Update(writeContext(r), user, item)
+	}
+	if errors.Is(err, ErrCannotUpdate) && conditional {
+		// If-Match never matches an item that is not there
+		err = ErrConflict
+	}
+	if errors.Is(err, ErrCannotUpdate) {
+		stored, err = h.dal.Create(writeContext(r), user, item)
+		if errors.Is(err, ErrCannotCreate) {
+			// It is there, but not for `user` to see
+			err = ErrCannotUpdate
+		}
+		if err == nil {
+			setETag(w, stored)
+			writeJSON(w, http.StatusCreated, stored)
+			return
+		}
+	}
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	setETag(w, stored)
+	writeJSON(w, http.StatusOK, stored)
+}
+
+// PATCH /v1/todo/{id}, PATCH /v2/users/{user}/todos/{id},
+// PATCH /v2/lists/{list}/todos/{id}. Takes a JSON Merge Patch, or a JSON
+// Patch sent as application/json-patch+json, If-Match and ?force=true
+type todoPatchHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+// Reads the patch in the request body, writing a 400 or 415 and returning
+// false when it cannot be used
+func readPatch(w http.ResponseWriter, r *http.Request) (func(item *ToDoItem) error, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType == "application/json" {
+		mediaType = mergePatchType
+	}
+	if mediaType != mergePatchType && mediaType != jsonPatchType {
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		writeAPIError(w, http.StatusUnsupportedMediaType, errUnsupportedPatch)
+		return nil, false
+	}
+	document, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, errInvalidBody)
+		return nil, false
+	}
+	change, err := parsePatch(mediaType, document)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return change, true
+}
+
+func (h *todoPatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	version, matchable := ifMatchVersion(r)
+	if !matchable {
+		writeAPIError(w, http.StatusPreconditionFailed, ErrConflict)
+		return
+	}
+	change, ok := readPatch(w, r)
+	if !ok {
+		return
+	}
+	list := h.listOf(r)
+	patched, err := h.dal.Patch(writeContext(r), h.userOf(r), Id(r.PathValue("id")), version, func(item *ToDoItem) error {
+		if item.List != list {
+			return ErrCannotUpdate
+		}
+		return change(item)
+	})
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	setETag(w, patched)
+	writeJSON(w, http.StatusOK, patched)
+}
+
+// PATCH /v1/todo/series/{series}, PATCH /v2/users/{user}/todos/series/{series},
+// PATCH /v2/lists/{list}/todos/series/{series}. Takes the same patches as
+// todoPatchHandler and applies them to every open item in the series, so
+// {"recurrence": null} stops it. Answers with the changed items
+type seriesPatchHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *seriesPatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	change, ok := readPatch(w, r)
+	if !ok {
+		return
+	}
+	list := h.listOf(r)
+	items, err := h.dal.EditSeries(writeContext(r), h.userOf(r), Id(r.PathValue("series")), func(item *ToDoItem) error {
+		if item.List != list {
+			return ErrNoSeries
+		}
+		return change(item)
+	})
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// Runs a change to item {id}'s checklist, honouring If-Match and
+// ?force=true, and answers with the changed item
+func changeChecklist(w http.ResponseWriter, r *http.Request, dal DataAccessLayer, userOf userResolver, listOf listResolver, status int,
+	change func(ctx context.Context, user User, id Id, version int) (ToDoItem, error)) {
+	version, matchable := ifMatchVersion(r)
+	if !matchable {
+		writeAPIError(w, http.StatusPreconditionFailed, ErrConflict)
+		return
+	}
+	user, id := userOf(r), Id(r.PathValue("id"))
+	if err := checkInList(r.Context(), dal, user, id, listOf(r), ErrCannotUpdate); err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	item, err := change(writeContext(r), user, id, version)
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	setETag(w, item)
+	writeJSON(w, status, item)
+}
+
+// POST /v1/todo/{id}/checklist, POST /v2/users/{user}/todos/{id}/checklist,
+// POST /v2/lists/{list}/todos/{id}/checklist
+type checklistAddHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *checklistAddHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Title Title `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errInvalidBody)
+		return
+	}
+	changeChecklist(w, r, h.dal, h.userOf, h.listOf, http.StatusCreated, func(ctx context.Context, user User, id Id, version int) (ToDoItem, error) {
+		return h.dal.AddSubItem(ctx, user, id, version, request.Title)
+	})
+}
+
+// POST .../todo(s)/{id}/checklist/{sub}/toggle
+type checklistToggleHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *checklistToggleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	changeChecklist(w, r, h.dal, h.userOf, h.listOf, http.StatusOK, func(ctx context.Context, user User, id Id, version int) (ToDoItem, error) {
+		return h.dal.ToggleSubItem(ctx, user, id, version, Id(r.PathValue("sub")))
+	})
+}
+
+// POST .../todo(s)/{id}/checklist/{sub}/move, taking {"index": ...}
+type checklistMoveHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *checklistMoveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Index *int `json:"index"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Index == nil {
+		writeAPIError(w, http.StatusBadRequest, errInvalidBody)
+		return
+	}
+	changeChecklist(w, r, h.dal, h.userOf, h.listOf, http.StatusOK, func(ctx context.Context, user User, id Id, version int) (ToDoItem, error) {
+		return h.dal.MoveSubItem(ctx, user, id, version, Id(r.PathValue("sub")), *request.Index)
+	})
+}
+
+// GET /v1/todo, GET /v2/users/{user}/todos, GET /v2/lists/{list}/todos
+type todoListHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+// Takes ?complete=true|false, ?priority=, ?title= to match part of the title,
+// ?tag= once per tag with ?tags=all to need every tag rather than any of them,
+// ?sort=created|priority|title with a leading - to reverse it, ?limit= and
+// ?cursor= from a previous page's next link. Also ?due=overdue|today|this-week,
+// with ?tz= naming the timezone today and this week are worked out in, the
+// server's own by default
+func (h *todoListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	q.List = h.listOf(r)
+	page, err := h.dal.Query(r.Context(), h.userOf(r), q)
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	if page.Next != "" {
+		next := *r.URL
+		values := next.Query()
+		values.Set("cursor", page.Next)
+		next.RawQuery = values.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+	if page.Items == nil {
+		page.Items = []ToDoItem{}
+	}
+	writeJSON(w, http.StatusOK, page.Items)
+}
+
+// Reads a Query from a list's query parameters. The Query is checked when it
+// is run, this only checks what cannot be passed on as it is
+func parseQuery(values url.Values, now time.Time) (Query, error) {
+	q := Query{
+		Priority:      Priority(values.Get("priority")),
+		TitleContains: values.Get("title"),
+		Due:           DueFilter(values.Get("due")),
+		Now:           now,
+		Sort:          SortKey(strings.TrimPrefix(values.Get("sort"), "-")),
+		Descending:    strings.HasPrefix(values.Get("sort"), "-"),
+		After:         values.Get("cursor"),
+		Series:        Id(values.Get("series")),
+	}
+	for _, tag := range values["tag"] {
+		q.Tags = append(q.Tags, Tag(tag))
+	}
+	switch values.Get("tags") {
+	case "", "any":
+	case "all":
+		q.AllTags = true
+	default:
+		return q, fmt.Errorf("%w: tags must be any or all", ErrInvalidQuery)
+	}
+	if tz := values.Get("tz"); tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			return q, errInvalidTimezone
+		}
+		q.Now = now.In(location)
+	}
+	if complete := values.Get("complete"); complete != "" {
+		parsed, err := strconv.ParseBool(complete)
+		if err != nil {
+			return q, fmt.Errorf("%w: complete must be true or false", ErrInvalidQuery)
+		}
+		q.Complete = (*Complete)(&parsed)
+	}
+	if actionable := values.Get("actionable"); actionable != "" {
+		parsed, err := strconv.ParseBool(actionable)
+		if err != nil {
+			return q, fmt.Errorf("%w: actionable must be true or false", ErrInvalidQuery)
+		}
+		q.Actionable = parsed
+	}
+	if limit := values.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, fmt.Errorf("%w: limit must be a whole number", ErrInvalidQuery)
+		}
+		q.Limit = parsed
+	}
+	return q, nil
+}
+
+// GET /v1/todo/search, GET /v2/users/{user}/todos/search,
+// GET /v2/lists/{list}/todos/search
+type todoSearchHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+// Takes ?q= and answers with the best matches first
+func (h *todoSearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	text := r.URL.Query().Get("q")
+	if len(tokenise(text)) == 0 {
+		writeAPIError(w, http.StatusBadRequest, errMissingSearch)
+		return
+	}
+	items, err := h.dal.Search(r.Context(), h.userOf(r), h.listOf(r), text)
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	if items == nil {
+		items = []ToDoItem{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// GET /v1/todo/tags, GET /v2/users/{user}/todos/tags,
+// GET /v2/lists/{list}/todos/tags
+type todoTagsHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *todoTagsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.dal.TagCounts(r.Context(), h.userOf(r), h.listOf(r))
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, counts)
+}
+
+// GET /v1/todo/{id}, GET /v2/users/{user}/todos/{id},
+// GET /v2/lists/{list}/todos/{id}
+type todoGetHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *todoGetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	item, err := h.dal.Get(r.Context(), h.userOf(r), Id(r.PathValue("id")))
+	if err == nil && item.List != h.listOf(r) {
+		err = ErrCannotQuery
+	}
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	setETag(w, item)
+	writeJSON(w, http.StatusOK, item)
+}
+
+// GET /v1/todo/{id}/dependencies, GET /v2/users/{user}/todos/{id}/dependencies,
+// GET /v2/lists/{list}/todos/{id}/dependencies
+type todoDependenciesHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *todoDependenciesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := Id(r.PathValue("id"))
+	graph, err := h.dal.Dependencies(r.Context(), h.userOf(r), id)
+	if err == nil && !slices.ContainsFunc(graph.Items, func(item ToDoItem) bool {
+		return item.Id == id && item.List == h.listOf(r)
+	}) {
+		err = ErrCannotQuery
+	}
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	if graph.Dependencies == nil {
+		graph.Dependencies = []Dependency{}
+	}
+	writeJSON(w, http.StatusOK, graph)
+}
+
+// DELETE /v1/todo/{id}, DELETE /v2/users/{user}/todos/{id},
+// DELETE /v2/lists/{list}/todos/{id}. Takes If-Match
+type todoDeleteHandler struct {
+	dal    DataAccessLayer
+	userOf userResolver
+	listOf listResolver
+}
+
+func (h *todoDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	version, matchable := ifMatchVersion(r)
+	if !matchable {
+		writeAPIError(w, http.StatusPreconditionFailed, ErrConflict)
+		return
+	}
+	user, id, list := h.userOf(r), Id(r.PathValue("id")), h.listOf(r)
+	err := checkInList(r.Context(), h.dal, user, id, list, ErrCannotDelete)
+	if err == nil {
+		err = h.dal.Delete(r.Context(), user, ToDoItem{Id: id, List: list, Version: version})
+	}
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /v2/lists
+type listCreateHandler struct {
+	dal DataAccessLayer
+}
+
+func (h *listCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errInvalidBody)
+		return
+	}
+	list, err := h.dal.CreateList(r.Context(), callerUser(r), request.Name)
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, list)
+}
+
+// GET /v2/lists
+type listListHandler struct {
+	dal DataAccessLayer
+}
+
+func (h *listListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lists, err := h.dal.Lists(r.Context(), callerUser(r))
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	if lists == nil {
+		lists = []List{}
+	}
+	writeJSON(w, http.StatusOK, lists)
+}
+
+// GET /v2/lists/{list}
+type listGetHandler struct {
+	dal DataAccessLayer
+}
+
+func (h *listGetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	list, err := h.dal.GetList(r.Context(), callerUser(r), pathList(r))
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// DELETE /v2/lists/{list}
+type listDeleteHandler struct {
+	dal DataAccessLayer
+}
+
+func (h *listDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.dal.DeleteList(r.Context(), callerUser(r), pathList(r)); err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /v2/lists/{list}/members/{member}
+type listShareHandler struct {
+	dal DataAccessLayer
+}
+
+func (h *listShareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Role Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errInvalidBody)
+		return
+	}
+	list, err := h.dal.ShareList(r.Context(), callerUser(r), pathList(r), User(r.PathValue("member")), request.Role)
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// DELETE /v2/lists/{list}/members/{member}
+type listUnshareHandler struct {
+	dal DataAccessLayer
+}
+
+func (h *listUnshareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, err := h.dal.UnshareList(r.Context(), callerUser(r), pathList(r), User(r.PathValue("member")))
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type credentials struct {
+	Name     User   `json:"name"`
+	Password string `json:"password"`
+}
+
+type loginResponse struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// POST /v2/users
+type registerHandler struct {
+	auth *Auth
+}
+
+func (h *registerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var c credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errInvalidBody)
+		return
+	}
+	if err := h.auth.Register(r.Context(), c.Name, c.Password); err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, struct {
+		Name User `json:"name"`
+	}{c.Name})
+}
+
+// POST /v2/login
+type loginHandler struct {
+	auth *Auth
+}
+
+func (h *loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var c credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errInvalidBody)
+		return
+	}
+	token, expires, err := h.auth.Login(r.Context(), c.Name, c.Password)
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{token, expires})
+}
+
+// POST /v2/logout
+type logoutHandler struct {
+	auth *Auth
+}
+
+func (h *logoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if token, ok := bearerToken(r); ok {
+		h.auth.Logout(token)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// An APIKey as shown to its owner, the hash is never handed out
+type apiKeyView struct {
+	Id      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scope   Scope     `json:"scope"`
+	Created time.Time `json:"created"`
+	// Only set when the key is created
+	Key string `json:"key,omitempty"`
+}
+
+func newAPIKeyView(key APIKey) apiKeyView {
+	return apiKeyView{Id: key.Id, Name: key.Name, Scope: key.Scope, Created: key.Created}
+}
+
+// POST /v2/users/{user}/keys
+type apiKeyCreateHandler struct {
+	auth *Auth
+}
+
+func (h *apiKeyCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name  string `json:"name"`
+		Scope Scope  `json:"scope"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errInvalidBody)
+		return
+	}
+	key, token, err := h.auth.CreateAPIKey(r.Context(), pathUser(r), request.Name, request.Scope)
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	view := newAPIKeyView(key)
+	view.Key = token
+	writeJSON(w, http.StatusCreated, view)
+}
+
+// GET /v2/users/{user}/keys
+type apiKeyListHandler struct {
+	auth *Auth
+}
+
+func (h *apiKeyListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.auth.ListAPIKeys(r.Context(), pathUser(r))
+	if err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	views := []apiKeyView{}
+	for _, key := range keys {
+		views = append(views, newAPIKeyView(key))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// DELETE /v2/users/{user}/keys/{id}
+type apiKeyRevokeHandler struct {
+	auth *Auth
+}
+
+func (h *apiKeyRevokeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.auth.RevokeAPIKey(r.Context(), pathUser(r), r.PathValue("id")); err != nil {
+		writeDALError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var errNotAuthenticated = errors.New("log in to make this request")
+var errForbidden = errors.New("you cannot access another user's todos")
+var errReadOnly = errors.New("this API key can only be used to read")
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+func isMutation(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+func writeUnauthenticated(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeAPIError(w, http.StatusUnauthorized, errNotAuthenticated)
+}
+
+// Puts the user a bearer token belongs to on the request context. Requests
+// with a bad token, and mutations with no token at all, are refused with a
+// 401 unless they are for one of the `public` paths. Mutations with a read
+// only APIKey are refused with a 403
+func withBearerAuth(auth *Auth, next http.Handler, public ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(public, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, presented := bearerToken(r)
+		user, scope, ok := auth.Authenticate(r.Context(), token)
+		if presented && !ok {
+			writeUnauthenticated(w)
+			return
+		}
+		if !ok && isMutation(r.Method) {
+			writeUnauthenticated(w)
+			return
+		}
+		if ok && isMutation(r.Method) && scope != ScopeReadWrite {
+			writeAPIError(w, http.StatusForbidden, errReadOnly)
+			return
+		}
+		if ok {
+			r = r.WithContext(WithUser(r.Context(), user, scope))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Everything under /v2/users/{user} is private to that user
+func ownUserOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeUnauthenticated(w)
+			return
+		}
+		if user != pathUser(r) {
+			writeAPIError(w, http.StatusForbidden, errForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Shared lists are only open to users who have logged in
+func loggedInOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := UserFromContext(r.Context()); !ok {
+			writeUnauthenticated(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Gives every request a TraceID, taken from the X-Trace-Id header when the
+// caller supplies one, and a deadline so a hung DataStore cannot hold the
+// handler forever. Requests are logged at Debug, so they stay out of the
+// prompts of a CLI running in the same process
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := TraceID(r.Header.Get(traceIDHeader))
+		if id == "" {
+			id = NewTraceID()
+		}
+		ctx, cancel := context.WithTimeout(WithTraceID(r.Context(), id), requestTimeout)
+		defer cancel()
+		w.Header().Set(traceIDHeader, string(id))
+
+		start := time.Now()
+		recorder := &statusRecorder{w, http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		slog.DebugContext(ctx, "handled request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+const requestTimeout = 10 * time.Second
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func newAPIMux(dal DataAccessLayer, auth *Auth) http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("/", &homeHandler{})
 	mux.Handle("/create", &createHandler{dal})
 	mux.Handle("/read", &readHandler{dal})
 	mux.Handle("/update", &updateHandler{dal})
 	mux.Handle("/delete", &deleteHandler{dal})
-	http.ListenAndServe(":8080", mux)
+	mux.Handle("POST /v1/todo", &todoAddHandler{dal, callerUser, personalList})
+	mux.Handle("PUT /v1/todo", &todoAddOrUpdateHandler{dal, callerUser, personalList})
+	mux.Handle("GET /v1/todo", &todoListHandler{dal, callerUser, personalList})
+	mux.Handle("GET /v1/todo/search", &todoSearchHandler{dal, callerUser, personalList})
+	mux.Handle("GET /v1/todo/tags", &todoTagsHandler{dal, callerUser, personalList})
+	mux.Handle("GET /v1/todo/{id}", &todoGetHandler{dal, callerUser, personalList})
+	mux.Handle("GET /v1/todo/{id}/dependencies", &todoDependenciesHandler{dal, callerUser, personalList})
+	mux.Handle("POST /v1/todo/{id}/checklist", &checklistAddHandler{dal, callerUser, personalList})
+	mux.Handle("POST /v1/todo/{id}/checklist/{sub}/toggle", &checklistToggleHandler{dal, callerUser, personalList})
+	mux.Handle("POST /v1/todo/{id}/checklist/{sub}/move", &checklistMoveHandler{dal, callerUser, personalList})
+	mux.Handle("PATCH /v1/todo/{id}", &todoPatchHandler{dal, callerUser, personalList})
+	mux.Handle("PATCH /v1/todo/series/{series}", &seriesPatchHandler{dal, callerUser, personalList})
+	mux.Handle("DELETE /v1/todo/{id}", &todoDeleteHandler{dal, callerUser, personalList})
+	mux.Handle("POST /v2/users/{user}/todos", ownUserOnly(&todoAddHandler{dal, pathUser, personalList}))
+	mux.Handle("GET /v2/users/{user}/todos", ownUserOnly(&todoListHandler{dal, pathUser, personalList}))
+	mux.Handle("GET /v2/users/{user}/todos/search", ownUserOnly(&todoSearchHandler{dal, pathUser, personalList}))
+	mux.Handle("GET /v2/users/{user}/todos/tags", ownUserOnly(&todoTagsHandler{dal, pathUser, personalList}))
+	mux.Handle("GET /v2/users/{user}/todos/{id}", ownUserOnly(&todoGetHandler{dal, pathUser, personalList}))
+	mux.Handle("GET /v2/users/{user}/todos/{id}/dependencies", ownUserOnly(&todoDependenciesHandler{dal, pathUser, personalList}))
+	mux.Handle("PUT /v2/users/{user}/todos/{id}", ownUserOnly(&todoAddOrUpdateHandler{dal, pathUser, personalList}))
+	mux.Handle("PATCH /v2/users/{user}/todos/{id}", ownUserOnly(&todoPatchHandler{dal, pathUser, personalList}))
+	mux.Handle("PATCH /v2/users/{user}/todos/series/{series}", ownUserOnly(&seriesPatchHandler{dal, pathUser, personalList}))
+	mux.Handle("DELETE /v2/users/{user}/todos/{id}", ownUserOnly(&todoDeleteHandler{dal, pathUser, personalList}))
+	mux.Handle("POST /v2/users/{user}/todos/{id}/checklist", ownUserOnly(&checklistAddHandler{dal, pathUser, personalList}))
+	mux.Handle("POST /v2/users/{user}/todos/{id}/checklist/{sub}/toggle", ownUserOnly(&checklistToggleHandler{dal, pathUser, personalList}))
+	mux.Handle("POST /v2/users/{user}/todos/{id}/checklist/{sub}/move", ownUserOnly(&checklistMoveHandler{dal, pathUser, personalList}))
+	mux.Handle("POST /v2/lists", loggedInOnly(&listCreateHandler{dal}))
+	mux.Handle("GET /v2/lists", loggedInOnly(&listListHandler{dal}))
+	mux.Handle("GET /v2/lists/{list}", loggedInOnly(&listGetHandler{dal}))
+	mux.Handle("DELETE /v2/lists/{list}", loggedInOnly(&listDeleteHandler{dal}))
+	mux.Handle("PUT /v2/lists/{list}/members/{member}", loggedInOnly(&listShareHandler{dal}))
+	mux.Handle("DELETE /v2/lists/{list}/members/{member}", loggedInOnly(&listUnshareHandler{dal}))
+	mux.Handle("POST /v2/lists/{list}/todos", loggedInOnly(&todoAddHandler{dal, callerUser, pathList}))
+	mux.Handle("GET /v2/lists/{list}/todos", loggedInOnly(&todoListHandler{dal, callerUser, pathList}))
+	mux.Handle("GET /v2/lists/{list}/todos/search", loggedInOnly(&todoSearchHandler{dal, callerUser, pathList}))
+	mux.Handle("GET /v2/lists/{list}/todos/tags", loggedInOnly(&todoTagsHandler{dal, callerUser, pathList}))
+	mux.Handle("GET /v2/lists/{list}/todos/{id}", loggedInOnly(&todoGetHandler{dal, callerUser, pathList}))
+	mux.Handle("GET /v2/lists/{list}/todos/{id}/dependencies", loggedInOnly(&todoDependenciesHandler{dal, callerUser, pathList}))
+	mux.Handle("PUT /v2/lists/{list}/todos/{id}", loggedInOnly(&todoAddOrUpdateHandler{dal, callerUser, pathList}))
+	mux.Handle("PATCH /v2/lists/{list}/todos/{id}", loggedInOnly(&todoPatchHandler{dal, callerUser, pathList}))
+	mux.Handle("PATCH /v2/lists/{list}/todos/series/{series}", loggedInOnly(&seriesPatchHandler{dal, callerUser, pathList}))
+	mux.Handle("DELETE /v2/lists/{list}/todos/{id}", loggedInOnly(&todoDeleteHandler{dal, callerUser, pathList}))
+	mux.Handle("POST /v2/lists/{list}/todos/{id}/checklist", loggedInOnly(&checklistAddHandler{dal, callerUser, pathList}))
+	mux.Handle("POST /v2/lists/{list}/todos/{id}/checklist/{sub}/toggle", loggedInOnly(&checklistToggleHandler{dal, callerUser, pathList}))
+	mux.Handle("POST /v2/lists/{list}/todos/{id}/checklist/{sub}/move", loggedInOnly(&checklistMoveHandler{dal, callerUser, pathList}))
+	mux.Handle("POST /v2/users/{user}/keys", ownUserOnly(&apiKeyCreateHandler{auth}))
+	mux.Handle("GET /v2/users/{user}/keys", ownUserOnly(&apiKeyListHandler{auth}))
+	mux.Handle("DELETE /v2/users/{user}/keys/{id}", ownUserOnly(&apiKeyRevokeHandler{auth}))
+	mux.Handle("POST /v2/users", &registerHandler{auth})
+	mux.Handle("POST /v2/login", &loginHandler{auth})
+	mux.Handle("POST /v2/logout", &logoutHandler{auth})
+	return withTracing(withBearerAuth(auth, mux, "/v2/users", "/v2/login"))
+}
+
+func StartAPI(dal DataAccessLayer, auth *Auth, addr string) error {
+	return http.ListenAndServe(addr, newAPIMux(dal, auth))
 }
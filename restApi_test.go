@@ -0,0 +1,996 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Who serveAPI calls the API as
+const testUser User = "tester"
+
+func newTestAuth() *Auth {
+	auth := NewAuth(newInMemoryAccountStore(), time.Hour)
+	auth.hashCost = bcrypt.MinCost
+	return auth
+}
+
+var testAuth = newTestAuth()
+
+func serveAPI(dal DataAccessLayer, method, target, body string) *httptest.ResponseRecorder {
+	return serveAPIAs(dal, testUser, method, target, body)
+}
+
+// Sends the request with a bearer token for `user`, or with no token at all
+// for AnonymousUser
+func serveAPIAs(dal DataAccessLayer, user User, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if user != AnonymousUser {
+		token, _, _ := testAuth.sessions.start(user)
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	newAPIMux(dal, testAuth).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestV1Add(t *testing.T) {
+	t.Run("Add value to store", func(t *testing.T) {
+		dal := NewEmptyDAL()
+		rec := serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Keep sanity"}`)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("want %v, got %v", http.StatusCreated, rec.Code)
+		}
+		var got ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if got.Id == "" || got.Priority != defaultPriority || got.CreatedAt == nil || got.UpdatedBy != testUser {
+			t.Errorf("id, default priority and stamps not applied, got %v", got)
+		}
+		if !equalSlicesNoOrder([]ToDoItem{got}, readAll(t, dal.db)) {
+			t.Errorf("want %v, got %v", []ToDoItem{got}, readAll(t, dal.db))
+		}
+	})
+	t.Run("Add existing value to store", func(t *testing.T) {
+		item := ConstructToDoItem("Keep sanity", "High", false)
+		dal := NewEmptyDAL()
+		dal.Create(context.Background(), testUser, item)
+		body, _ := json.Marshal(item)
+
+		rec := serveAPI(dal, http.MethodPost, "/v1/todo", string(body))
+
+		if rec.Code != http.StatusConflict {
+			t.Errorf("want %v, got %v", http.StatusConflict, rec.Code)
+		}
+	})
+	t.Run("Invalid input", func(t *testing.T) {
+		rec := serveAPI(NewEmptyDAL(), http.MethodPost, "/v1/todo", `{"title":`)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("want %v, got %v", http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("Validation exception", func(t *testing.T) {
+		rec := serveAPI(NewEmptyDAL(), http.MethodPost, "/v1/todo", `{"priority":"High"}`)
+
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("want %v, got %v", http.StatusUnprocessableEntity, rec.Code)
+		}
+	})
+	t.Run("Validation errors name each field", func(t *testing.T) {
+		rec := serveAPI(NewEmptyDAL(), http.MethodPost, "/v1/todo", `{"title":" ","priority":"pretty high"}`)
+
+		var got apiResponse
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusUnprocessableEntity || got.Fields["title"] == "" || got.Fields["priority"] == "" {
+			t.Errorf("want %v with title and priority problems, got %v %+v", http.StatusUnprocessableEntity, rec.Code, got)
+		}
+	})
+	t.Run("Priority case is normalised", func(t *testing.T) {
+		rec := serveAPI(NewEmptyDAL(), http.MethodPost, "/v1/todo", `{"title":"Keep sanity","priority":"hIGH"}`)
+
+		var got ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusCreated || got.Priority != PriorityHigh {
+			t.Errorf("want %v and %v, got %v %v", http.StatusCreated, PriorityHigh, rec.Code, got.Priority)
+		}
+	})
+}
+
+func TestV1AddOrUpdate(t *testing.T) {
+	t.Run("Update value in store", func(t *testing.T) {
+		item := ConstructToDoItem("Keep sanity", "High", false)
+		item.Owner = testUser
+		dal := NewEmptyDAL()
+		dal.Create(context.Background(), testUser, item)
+		item.Complete = true
+		body, _ := json.Marshal(item)
+
+		rec := serveAPI(dal, http.MethodPut, "/v1/todo", string(body))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("want %v, got %v", http.StatusOK, rec.Code)
+		}
+		if !equalSlicesNoOrder([]ToDoItem{item}, unstamped(readAll(t, dal.db))) {
+			t.Errorf("want %v, got %v", []ToDoItem{item}, readAll(t, dal.db))
+		}
+	})
+	t.Run("Add value to store", func(t *testing.T) {
+		item := ConstructToDoItem("Keep sanity", "High", false)
+		item.Owner = testUser
+		dal := NewEmptyDAL()
+		body, _ := json.Marshal(item)
+
+		rec := serveAPI(dal, http.MethodPut, "/v1/todo", string(body))
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("want %v, got %v", http.StatusCreated, rec.Code)
+		}
+		if !equalSlicesNoOrder([]ToDoItem{item}, unstamped(readAll(t, dal.db))) {
+			t.Errorf("want %v, got %v", []ToDoItem{item}, readAll(t, dal.db))
+		}
+	})
+	t.Run("Invalid ID supplied", func(t *testing.T) {
+		rec := serveAPI(NewEmptyDAL(), http.MethodPut, "/v1/todo", `{"title":"Keep sanity"}`)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("want %v, got %v", http.StatusBadRequest, rec.Code)
+		}
+	})
+}
+
+func TestV1Get(t *testing.T) {
+	items := populatedToDoList()
+	for i := range items {
+		items[i].Owner = testUser
+	}
+	_, data := toDoMapper(items)
+	db := inMemoryDataStore{data: data}
+	dal := NewDataAccessLayer(&db)
+
+	t.Run("Get existing item", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo/"+string(items[2].Id), "")
+
+		var got ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || !equalItems(got, items[2]) {
+			t.Errorf("want %v %v, got %v %v", http.StatusOK, items[2], rec.Code, got)
+		}
+	})
+	t.Run("Get non-existent item", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo/nope", "")
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("want %v, got %v", http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("List items", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo", "")
+
+		var got []ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if !equalSlicesNoOrder(items, got) {
+			t.Errorf("want %v, got %v", items, got)
+		}
+	})
+}
+
+func TestV1Delete(t *testing.T) {
+	t.Run("Deleting item", func(t *testing.T) {
+		item := ConstructToDoItem("Keep sanity", "High", false)
+		dal := NewEmptyDAL()
+		dal.Create(context.Background(), testUser, item)
+
+		rec := serveAPI(dal, http.MethodDelete, "/v1/todo/"+string(item.Id), "")
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("want %v, got %v", http.StatusNoContent, rec.Code)
+		}
+		if len(readAll(t, dal.db)) != 0 {
+			t.Errorf("item not deleted, got %v", readAll(t, dal.db))
+		}
+	})
+	t.Run("Deleting non-existent item", func(t *testing.T) {
+		rec := serveAPI(NewEmptyDAL(), http.MethodDelete, "/v1/todo/nope", "")
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("want %v, got %v", http.StatusNotFound, rec.Code)
+		}
+	})
+}
+
+func TestV2UserTodos(t *testing.T) {
+	dal := NewEmptyDAL()
+	rec := serveAPIAs(dal, "alice", http.MethodPost, "/v2/users/alice/todos", `{"title":"Keep sanity"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("want %v, got %v", http.StatusCreated, rec.Code)
+	}
+	var item ToDoItem
+	json.NewDecoder(rec.Body).Decode(&item)
+	if item.Owner != "alice" {
+		t.Fatalf("want owner alice, got %v", item)
+	}
+	target := "/v2/users/alice/todos/" + string(item.Id)
+
+	t.Run("Owner can get item", func(t *testing.T) {
+		rec := serveAPIAs(dal, "alice", http.MethodGet, target, "")
+
+		var got ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || !equalItems(got, item) {
+			t.Errorf("want %v %v, got %v %v", http.StatusOK, item, rec.Code, got)
+		}
+	})
+	t.Run("Other users cannot see item", func(t *testing.T) {
+		for _, target := range []string{
+			"/v2/users/bob/todos/" + string(item.Id),
+			"/v1/todo/" + string(item.Id),
+		} {
+			rec := serveAPIAs(dal, "bob", http.MethodGet, target, "")
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("%s: want %v, got %v", target, http.StatusNotFound, rec.Code)
+			}
+		}
+		rec := serveAPIAs(dal, "bob", http.MethodGet, "/v2/users/bob/todos", "")
+
+		if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+			t.Errorf("want [], got %s", body)
+		}
+	})
+	t.Run("Other users cannot use the owner's list", func(t *testing.T) {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			rec := serveAPIAs(dal, "bob", method, target, "")
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("%s: want %v, got %v", method, http.StatusForbidden, rec.Code)
+			}
+		}
+	})
+	t.Run("Other users cannot change item", func(t *testing.T) {
+		rec := serveAPIAs(dal, "bob", http.MethodDelete, "/v2/users/bob/todos/"+string(item.Id), "")
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("want %v, got %v", http.StatusNotFound, rec.Code)
+		}
+		// Answered as if the item were not there, rather than by creating it
+		for _, target := range []string{"/v2/users/bob/todos/" + string(item.Id), "/v1/todo"} {
+			rec = serveAPIAs(dal, "bob", http.MethodPut, target, `{"id":"`+string(item.Id)+`","title":"Mine now"}`)
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("%s: want %v, got %v", target, http.StatusNotFound, rec.Code)
+			}
+		}
+		if got, _ := dal.Get(context.Background(), "alice", item.Id); got.Title != item.Title {
+			t.Errorf("want the item unchanged, got %v", got)
+		}
+	})
+	t.Run("Owner can update item", func(t *testing.T) {
+		rec := serveAPIAs(dal, "alice", http.MethodPut, target, `{"title":"Keep sanity","complete":true}`)
+
+		var got ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || !got.Complete || got.Id != item.Id {
+			t.Errorf("want %v and a complete item, got %v %v", http.StatusOK, rec.Code, got)
+		}
+	})
+	t.Run("Mismatched ids", func(t *testing.T) {
+		rec := serveAPIAs(dal, "alice", http.MethodPut, target, `{"id":"other","title":"Keep sanity"}`)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("want %v, got %v", http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("Owner can delete item", func(t *testing.T) {
+		rec := serveAPIAs(dal, "alice", http.MethodDelete, target, "")
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("want %v, got %v", http.StatusNoContent, rec.Code)
+		}
+	})
+}
+
+func TestAuthentication(t *testing.T) {
+	dal := NewEmptyDAL()
+	// Its own accounts, so the users registered here are new every run
+	auth := newTestAuth()
+	serve := func(token, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		newAPIMux(dal, auth).ServeHTTP(rec, req)
+		return rec
+	}
+	t.Run("Mutations need a log in", func(t *testing.T) {
+		for _, target := range []string{"/v1/todo", "/create", "/v2/users/alice/todos"} {
+			rec := serve("", http.MethodPost, target, `{"title":"Keep sanity"}`)
+
+			if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("%s: want %v, got %v", target, http.StatusUnauthorized, rec.Code)
+			}
+		}
+		if got := readAll(t, dal.db); len(got) != 0 {
+			t.Errorf("item was created, got %v", got)
+		}
+	})
+	t.Run("Anonymous list can be read", func(t *testing.T) {
+		rec := serve("", http.MethodGet, "/v1/todo", "")
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("want %v, got %v", http.StatusOK, rec.Code)
+		}
+	})
+	t.Run("User lists need a log in", func(t *testing.T) {
+		rec := serve("", http.MethodGet, "/v2/users/alice/todos", "")
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("want %v, got %v", http.StatusUnauthorized, rec.Code)
+		}
+	})
+	t.Run("Bad tokens are refused", func(t *testing.T) {
+		rec := serve("nope", http.MethodGet, "/v1/todo", "")
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("want %v, got %v", http.StatusUnauthorized, rec.Code)
+		}
+	})
+	t.Run("Register, log in and create", func(t *testing.T) {
+		credentials := `{"name":"carol","password":"correct horse"}`
+		if rec := serve("", http.MethodPost, "/v2/users", credentials); rec.Code != http.StatusCreated {
+			t.Fatalf("register: want %v, got %v", http.StatusCreated, rec.Code)
+		}
+		if rec := serve("", http.MethodPost, "/v2/users", credentials); rec.Code != http.StatusConflict {
+			t.Errorf("register again: want %v, got %v", http.StatusConflict, rec.Code)
+		}
+		wrong := `{"name":"carol","password":"battery staple"}`
+		if rec := serve("", http.MethodPost, "/v2/login", wrong); rec.Code != http.StatusUnauthorized {
+			t.Errorf("wrong password: want %v, got %v", http.StatusUnauthorized, rec.Code)
+		}
+		rec := serve("", http.MethodPost, "/v2/login", credentials)
+		var login loginResponse
+		json.NewDecoder(rec.Body).Decode(&login)
+		if rec.Code != http.StatusOK || login.Token == "" {
+			t.Fatalf("log in: want %v and a token, got %v %v", http.StatusOK, rec.Code, login)
+		}
+
+		rec = serve(login.Token, http.MethodPost, "/v2/users/carol/todos", `{"title":"Keep sanity"}`)
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("create: want %v, got %v", http.StatusCreated, rec.Code)
+		}
+	})
+}
+
+func TestAPIKeyEndpoints(t *testing.T) {
+	dal := NewEmptyDAL()
+	testAuth.Register(context.Background(), "dave", "correct horse")
+	withKey := func(token, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		newAPIMux(dal, testAuth).ServeHTTP(rec, req)
+		return rec
+	}
+	createKey := func(scope Scope) apiKeyView {
+		rec := serveAPIAs(dal, "dave", http.MethodPost, "/v2/users/dave/keys", `{"name":"ci","scope":"`+string(scope)+`"}`)
+		var key apiKeyView
+		json.NewDecoder(rec.Body).Decode(&key)
+		if rec.Code != http.StatusCreated || key.Key == "" {
+			t.Fatalf("want %v and a key, got %v %v", http.StatusCreated, rec.Code, key)
+		}
+		return key
+	}
+
+	t.Run("Read only key", func(t *testing.T) {
+		key := createKey(ScopeRead)
+
+		if rec := withKey(key.Key, http.MethodGet, "/v2/users/dave/todos", ""); rec.Code != http.StatusOK {
+			t.Errorf("read: want %v, got %v", http.StatusOK, rec.Code)
+		}
+		if rec := withKey(key.Key, http.MethodPost, "/v2/users/dave/todos", `{"title":"Keep sanity"}`); rec.Code != http.StatusForbidden {
+			t.Errorf("write: want %v, got %v", http.StatusForbidden, rec.Code)
+		}
+	})
+	t.Run("Read write key", func(t *testing.T) {
+		key := createKey(ScopeReadWrite)
+
+		if rec := withKey(key.Key, http.MethodPost, "/v2/users/dave/todos", `{"title":"Keep sanity"}`); rec.Code != http.StatusCreated {
+			t.Errorf("write: want %v, got %v", http.StatusCreated, rec.Code)
+		}
+		if rec := withKey(key.Key, http.MethodGet, "/v2/users/alice/todos", ""); rec.Code != http.StatusForbidden {
+			t.Errorf("other user: want %v, got %v", http.StatusForbidden, rec.Code)
+		}
+	})
+	t.Run("Listing hides secrets", func(t *testing.T) {
+		rec := serveAPIAs(dal, "dave", http.MethodGet, "/v2/users/dave/keys", "")
+
+		if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"key"`) || strings.Contains(rec.Body.String(), `"hash"`) {
+			t.Errorf("want %v and no secrets, got %v %s", http.StatusOK, rec.Code, rec.Body)
+		}
+	})
+	t.Run("Revoked key", func(t *testing.T) {
+		key := createKey(ScopeReadWrite)
+
+		rec := serveAPIAs(dal, "dave", http.MethodDelete, "/v2/users/dave/keys/"+key.Id, "")
+
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("want %v, got %v", http.StatusNoContent, rec.Code)
+		}
+		if rec := withKey(key.Key, http.MethodGet, "/v2/users/dave/todos", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("want %v, got %v", http.StatusUnauthorized, rec.Code)
+		}
+		if rec := serveAPIAs(dal, "dave", http.MethodDelete, "/v2/users/dave/keys/"+key.Id, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("revoke again: want %v, got %v", http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("Invalid scope", func(t *testing.T) {
+		rec := serveAPIAs(dal, "dave", http.MethodPost, "/v2/users/dave/keys", `{"name":"ci","scope":"admin"}`)
+
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("want %v, got %v", http.StatusUnprocessableEntity, rec.Code)
+		}
+	})
+}
+
+func TestDueFilters(t *testing.T) {
+	dal := NewEmptyDAL()
+	serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Keep sanity","due":"2000-01-31T17:00:00+05:30"}`)
+	serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Lose sanity"}`)
+
+	t.Run("Due date is kept with its timezone", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo?due=overdue", "")
+
+		if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, `"due":"2000-01-31T17:00:00+05:30"`) || strings.Contains(body, "Lose sanity") {
+			t.Errorf("want %v and only the overdue item, got %v %s", http.StatusOK, rec.Code, body)
+		}
+	})
+	t.Run("Today", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo?due=today&tz=Asia/Kolkata", "")
+
+		if body := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || body != "[]" {
+			t.Errorf("want %v [], got %v %s", http.StatusOK, rec.Code, body)
+		}
+	})
+	for _, target := range []string{"/v1/todo?due=someday", "/v1/todo?due=today&tz=Nowhere/Special"} {
+		t.Run(target, func(t *testing.T) {
+			if rec := serveAPI(dal, http.MethodGet, target, ""); rec.Code != http.StatusBadRequest {
+				t.Errorf("want %v, got %v", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+func TestListQueries(t *testing.T) {
+	dal := NewEmptyDAL()
+	for _, body := range []string{
+		`{"title":"Buy milk","priority":"Low"}`,
+		`{"title":"buy eggs","priority":"High","complete":true}`,
+		`{"title":"Sell car","priority":"High"}`,
+	} {
+		serveAPI(dal, http.MethodPost, "/v1/todo", body)
+	}
+	titles := func(rec *httptest.ResponseRecorder) []Title {
+		var items []ToDoItem
+		json.NewDecoder(rec.Body).Decode(&items)
+		var got []Title
+		for _, item := range items {
+			got = append(got, item.Title)
+		}
+		return got
+	}
+
+	t.Run("Filters and sorts", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo?title=BUY&sort=-title", "")
+
+		if want, got := []Title{"Buy milk", "buy eggs"}, titles(rec); rec.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v %v, got %v %v", http.StatusOK, want, rec.Code, got)
+		}
+	})
+	t.Run("Complete and priority", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo?complete=false&priority=high", "")
+
+		if want, got := []Title{"Sell car"}, titles(rec); !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	})
+	t.Run("Next links walk every page", func(t *testing.T) {
+		var got []Title
+		target := "/v1/todo?sort=priority&limit=2"
+		for pages := 0; target != ""; pages++ {
+			if pages > 3 {
+				t.Fatal("next links never ended")
+			}
+			rec := serveAPI(dal, http.MethodGet, target, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("want %v, got %v %s", http.StatusOK, rec.Code, rec.Body)
+			}
+			got = append(got, titles(rec)...)
+			target = ""
+			if link := rec.Header().Get("Link"); link != "" {
+				target = strings.TrimPrefix(strings.TrimSuffix(link, `>; rel="next"`), "<")
+			}
+		}
+
+		if len(got) != 3 || got[0] != "Buy milk" {
+			t.Errorf("want all 3 items, lowest priority first, got %v", got)
+		}
+	})
+	for _, target := range []string{"/v1/todo?sort=colour", "/v1/todo?limit=lots", "/v1/todo?complete=maybe", "/v1/todo?cursor=nonsense"} {
+		t.Run(target, func(t *testing.T) {
+			if rec := serveAPI(dal, http.MethodGet, target, ""); rec.Code != http.StatusBadRequest {
+				t.Errorf("want %v, got %v", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+func TestTagEndpoints(t *testing.T) {
+	dal := NewEmptyDAL()
+	serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Buy milk","tags":["Home","errands"]}`)
+	serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Fix sink","tags":["home"]}`)
+
+	t.Run("All tags", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo?tag=home&tag=errands&tags=all", "")
+
+		var got []ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || len(got) != 1 || !reflect.DeepEqual(got[0].Tags, []Tag{"errands", "home"}) {
+			t.Errorf("want %v and only the item with both tags, got %v %v", http.StatusOK, rec.Code, got)
+		}
+	})
+	t.Run("Counts", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo/tags", "")
+
+		if body := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || body != `[{"tag":"home","count":2},{"tag":"errands","count":1}]` {
+			t.Errorf("want %v and the counts, got %v %s", http.StatusOK, rec.Code, body)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		if rec := serveAPI(dal, http.MethodGet, "/v1/todo?tag=home&tags=some", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("want %v, got %v", http.StatusBadRequest, rec.Code)
+		}
+		if rec := serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Buy milk","tags":[""]}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("want %v, got %v", http.StatusUnprocessableEntity, rec.Code)
+		}
+	})
+}
+
+func TestChecklistEndpoints(t *testing.T) {
+	dal := NewEmptyDAL()
+	rec := serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Finish go academy"}`)
+	var item ToDoItem
+	json.NewDecoder(rec.Body).Decode(&item)
+
+	rec = serveAPI(dal, http.MethodPost, "/v1/todo/"+string(item.Id)+"/checklist", `{"title":"Read the book"}`)
+
+	json.NewDecoder(rec.Body).Decode(&item)
+	if rec.Code != http.StatusCreated || len(item.Checklist) != 1 || rec.Header().Get("ETag") == "" {
+		t.Fatalf("want %v, the step and an ETag, got %v %v", http.StatusCreated, rec.Code, item)
+	}
+	sub := "/v1/todo/" + string(item.Id) + "/checklist/" + string(item.Checklist[0].Id)
+	t.Run("Toggle", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodPost, sub+"/toggle", "")
+
+		var got ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || !bool(got.Checklist[0].Complete) || !bool(got.Complete) {
+			t.Errorf("want %v and the step and item complete, got %v %v", http.StatusOK, rec.Code, got)
+		}
+	})
+	t.Run("Move", func(t *testing.T) {
+		if rec := serveAPI(dal, http.MethodPost, sub+"/move", `{"index":0}`); rec.Code != http.StatusOK {
+			t.Errorf("want %v, got %v", http.StatusOK, rec.Code)
+		}
+		if rec := serveAPI(dal, http.MethodPost, sub+"/move", `{"index":1}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("want %v, got %v", http.StatusUnprocessableEntity, rec.Code)
+		}
+		if rec := serveAPI(dal, http.MethodPost, sub+"/move", `{}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("want %v, got %v", http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("Missing", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodPost, "/v1/todo/"+string(item.Id)+"/checklist/nope/toggle", "")
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("want %v, got %v", http.StatusNotFound, rec.Code)
+		}
+	})
+}
+
+func TestDependencyEndpoints(t *testing.T) {
+	dal := NewEmptyDAL()
+	rec := serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Read the book"}`)
+	var blocker ToDoItem
+	json.NewDecoder(rec.Body).Decode(&blocker)
+	rec = serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Write the app","blocked_by":["`+string(blocker.Id)+`"]}`)
+	var blocked ToDoItem
+	json.NewDecoder(rec.Body).Decode(&blocked)
+	if rec.Code != http.StatusCreated || len(blocked.BlockedBy) != 1 {
+		t.Fatalf("want %v and the blocker kept, got %v %v", http.StatusCreated, rec.Code, blocked)
+	}
+
+	t.Run("Graph", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo/"+string(blocker.Id)+"/dependencies", "")
+
+		var got DependencyGraph
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || len(got.Items) != 2 || len(got.Dependencies) != 1 || got.Dependencies[0] != (Dependency{blocker.Id, blocked.Id}) {
+			t.Errorf("want %v and both items, got %v %v", http.StatusOK, rec.Code, got)
+		}
+		if rec := serveAPI(dal, http.MethodGet, "/v1/todo/nope/dependencies", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("want %v, got %v", http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("Actionable", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo?actionable=true", "")
+
+		var got []ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || len(got) != 1 || got[0].Id != blocker.Id {
+			t.Errorf("want %v and only the blocker, got %v %v", http.StatusOK, rec.Code, got)
+		}
+	})
+	t.Run("Cycle", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodPatch, "/v1/todo/"+string(blocker.Id), `{"blocked_by":["`+string(blocked.Id)+`"]}`)
+
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("want %v, got %v", http.StatusUnprocessableEntity, rec.Code)
+		}
+	})
+	t.Run("Complete", func(t *testing.T) {
+		path := "/v1/todo/" + string(blocked.Id)
+		if rec := serveAPI(dal, http.MethodPatch, path, `{"complete":true}`); rec.Code != http.StatusConflict {
+			t.Errorf("want %v, got %v", http.StatusConflict, rec.Code)
+		}
+		if rec := serveAPI(dal, http.MethodPatch, path+"?force=true", `{"complete":true}`); rec.Code != http.StatusOK {
+			t.Errorf("want %v when forced, got %v", http.StatusOK, rec.Code)
+		}
+	})
+}
+
+func TestSeriesEndpoints(t *testing.T) {
+	dal := NewEmptyDAL()
+	rec := serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Feed cats","due":"2024-01-31T09:00:00Z","recurrence":"daily"}`)
+	var item ToDoItem
+	json.NewDecoder(rec.Body).Decode(&item)
+	if rec.Code != http.StatusCreated || item.Recurrence != "FREQ=DAILY" || item.Series != item.Id {
+		t.Fatalf("want %v and the series started, got %v %v", http.StatusCreated, rec.Code, item)
+	}
+	serveAPI(dal, http.MethodPatch, "/v1/todo/"+string(item.Id), `{"complete":true}`)
+
+	t.Run("List", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo?series="+string(item.Series), "")
+
+		var got []ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || len(got) != 2 || got[1].Due.Format(time.DateOnly) != "2024-02-01" {
+			t.Errorf("want %v and both occurrences, got %v %v", http.StatusOK, rec.Code, got)
+		}
+	})
+	t.Run("Stop", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodPatch, "/v1/todo/series/"+string(item.Series), `{"recurrence":null}`)
+
+		var got []ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || len(got) != 1 || got[0].Recurrence != "" {
+			t.Errorf("want %v and the open occurrence stopped, got %v %v", http.StatusOK, rec.Code, got)
+		}
+		if rec := serveAPI(dal, http.MethodPatch, "/v1/todo/series/nope", `{"recurrence":null}`); rec.Code != http.StatusNotFound {
+			t.Errorf("want %v, got %v", http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Feed cats","recurrence":"daily"}`)
+
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("want %v without a due date, got %v", http.StatusUnprocessableEntity, rec.Code)
+		}
+	})
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	dal := NewEmptyDAL()
+	serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Feed the cat"}`)
+	serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Catalogue the catacombs"}`)
+	serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Walk dog"}`)
+
+	rec := serveAPI(dal, http.MethodGet, "/v1/todo/search?q=cat", "")
+
+	var got []ToDoItem
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || len(got) != 2 || got[0].Title != "Feed the cat" {
+		t.Errorf("want %v and the closest match first, got %v %v", http.StatusOK, rec.Code, got)
+	}
+	if rec := serveAPI(dal, http.MethodGet, "/v1/todo/search?q=", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("want %v for an empty search, got %v", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestSharedListEndpoints(t *testing.T) {
+	dal := NewEmptyDAL()
+	rec := serveAPIAs(dal, "alice", http.MethodPost, "/v2/lists", `{"name":"Groceries"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("want %v, got %v", http.StatusCreated, rec.Code)
+	}
+	var list List
+	json.NewDecoder(rec.Body).Decode(&list)
+	base := "/v2/lists/" + string(list.Id)
+	serveAPIAs(dal, "alice", http.MethodPut, base+"/members/bob", `{"role":"viewer"}`)
+	rec = serveAPIAs(dal, "alice", http.MethodPost, base+"/todos", `{"title":"Buy milk"}`)
+	var item ToDoItem
+	json.NewDecoder(rec.Body).Decode(&item)
+	if rec.Code != http.StatusCreated || item.List != list.Id {
+		t.Fatalf("want %v and an item in %s, got %v %v", http.StatusCreated, list.Id, rec.Code, item)
+	}
+
+	tests := []struct {
+		name   string
+		user   User
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"viewer reads items", "bob", http.MethodGet, base + "/todos", "", http.StatusOK},
+		{"viewer gets item", "bob", http.MethodGet, base + "/todos/" + string(item.Id), "", http.StatusOK},
+		{"viewer cannot add", "bob", http.MethodPost, base + "/todos", `{"title":"Buy bread"}`, http.StatusForbidden},
+		{"viewer cannot delete", "bob", http.MethodDelete, base + "/todos/" + string(item.Id), "", http.StatusForbidden},
+		{"viewer cannot share", "bob", http.MethodPut, base + "/members/carol", `{"role":"owner"}`, http.StatusForbidden},
+		{"non-member cannot read", "carol", http.MethodGet, base + "/todos", "", http.StatusNotFound},
+		{"non-member cannot see list", "carol", http.MethodGet, base, "", http.StatusNotFound},
+		{"item is not in the personal list", "alice", http.MethodGet, "/v1/todo/" + string(item.Id), "", http.StatusNotFound},
+		{"invalid role", "alice", http.MethodPut, base + "/members/carol", `{"role":"admin"}`, http.StatusUnprocessableEntity},
+		{"last owner", "alice", http.MethodDelete, base + "/members/alice", "", http.StatusUnprocessableEntity},
+		{"missing name", "alice", http.MethodPost, "/v2/lists", `{}`, http.StatusUnprocessableEntity},
+		{"owner updates item", "alice", http.MethodPut, base + "/todos/" + string(item.Id), `{"title":"Buy oat milk"}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := serveAPIAs(dal, test.user, test.method, test.target, test.body)
+
+			if rec.Code != test.want {
+				t.Errorf("want %v, got %v: %s", test.want, rec.Code, rec.Body)
+			}
+		})
+	}
+	t.Run("Lists need a log in", func(t *testing.T) {
+		rec := serveAPIAs(dal, AnonymousUser, http.MethodGet, "/v2/lists", "")
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("want %v, got %v", http.StatusUnauthorized, rec.Code)
+		}
+	})
+	t.Run("Members see the list", func(t *testing.T) {
+		rec := serveAPIAs(dal, "bob", http.MethodGet, "/v2/lists", "")
+
+		var lists []List
+		json.NewDecoder(rec.Body).Decode(&lists)
+		if len(lists) != 1 || lists[0].Members["bob"] != RoleViewer {
+			t.Errorf("want bob to see the list as a viewer, got %v", lists)
+		}
+	})
+	t.Run("Owner deletes the list", func(t *testing.T) {
+		rec := serveAPIAs(dal, "alice", http.MethodDelete, base, "")
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("want %v, got %v", http.StatusNoContent, rec.Code)
+		}
+		if rec := serveAPIAs(dal, "bob", http.MethodGet, base+"/todos", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("want %v, got %v", http.StatusNotFound, rec.Code)
+		}
+	})
+}
+
+func TestETags(t *testing.T) {
+	dal := NewEmptyDAL()
+	created := serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Keep sanity"}`)
+	var item ToDoItem
+	json.NewDecoder(created.Body).Decode(&item)
+	target := "/v1/todo/" + string(item.Id)
+	body := `{"id":"` + string(item.Id) + `","title":"Keep sanity"}`
+	serveIfMatch := func(method, target, body, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		token, _, _ := testAuth.sessions.start(testUser)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		newAPIMux(dal, testAuth).ServeHTTP(rec, req)
+		return rec
+	}
+
+	if got := created.Header().Get("ETag"); got != `"1"` {
+		t.Errorf("want ETag %q on create, got %q", `"1"`, got)
+	}
+	t.Run("Get returns the ETag", func(t *testing.T) {
+		if got := serveAPI(dal, http.MethodGet, target, "").Header().Get("ETag"); got != `"1"` {
+			t.Errorf("want %q, got %q", `"1"`, got)
+		}
+	})
+	t.Run("Matching If-Match updates", func(t *testing.T) {
+		rec := serveIfMatch(http.MethodPut, "/v1/todo", `{"id":"`+string(item.Id)+`","title":"Lose sanity","version":7}`, `"1"`)
+
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"2"` {
+			t.Errorf("want %v with ETag %q, got %v %q", http.StatusOK, `"2"`, rec.Code, rec.Header().Get("ETag"))
+		}
+	})
+	t.Run("Stale If-Match is refused", func(t *testing.T) {
+		if rec := serveIfMatch(http.MethodPut, "/v1/todo", body, `"1"`); rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("want %v, got %v", http.StatusPreconditionFailed, rec.Code)
+		}
+		if rec := serveIfMatch(http.MethodDelete, target, "", `"1"`); rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("want %v, got %v", http.StatusPreconditionFailed, rec.Code)
+		}
+		if got, _ := dal.Get(context.Background(), testUser, item.Id); got.Title != "Lose sanity" {
+			t.Errorf("stale write applied, got %v", got)
+		}
+	})
+	t.Run("Unknown ETags never match", func(t *testing.T) {
+		for _, ifMatch := range []string{`W/"2"`, "2", `"two"`} {
+			if rec := serveIfMatch(http.MethodPut, "/v1/todo", body, ifMatch); rec.Code != http.StatusPreconditionFailed {
+				t.Errorf("%s: want %v, got %v", ifMatch, http.StatusPreconditionFailed, rec.Code)
+			}
+		}
+	})
+	t.Run("If-Match does not create", func(t *testing.T) {
+		rec := serveIfMatch(http.MethodPut, "/v1/todo", `{"id":"`+uuid.NewString()+`","title":"Keep sanity"}`, "*")
+
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("want %v, got %v", http.StatusPreconditionFailed, rec.Code)
+		}
+	})
+	t.Run("Matching If-Match deletes", func(t *testing.T) {
+		if rec := serveIfMatch(http.MethodDelete, target, "", `"2"`); rec.Code != http.StatusNoContent {
+			t.Errorf("want %v, got %v", http.StatusNoContent, rec.Code)
+		}
+	})
+}
+
+func TestV1Patch(t *testing.T) {
+	dal := NewEmptyDAL()
+	item, _ := dal.Create(context.Background(), testUser, ConstructToDoItem("Keep sanity", "high", false))
+	target := "/v1/todo/" + string(item.Id)
+	servePatch := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body))
+		token, _, _ := testAuth.sessions.start(testUser)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		newAPIMux(dal, testAuth).ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Merge patch", func(t *testing.T) {
+		rec := servePatch(mergePatchType, `{"complete":true}`)
+
+		var got ToDoItem
+		json.NewDecoder(rec.Body).Decode(&got)
+		if rec.Code != http.StatusOK || !bool(got.Complete) || got.Title != "Keep sanity" || got.Priority != PriorityHigh {
+			t.Errorf("want %v with only complete changed, got %v %v", http.StatusOK, rec.Code, got)
+		}
+		if rec.Header().Get("ETag") != `"2"` {
+			t.Errorf("want ETag %q, got %q", `"2"`, rec.Header().Get("ETag"))
+		}
+	})
+	t.Run("JSON Patch", func(t *testing.T) {
+		rec := servePatch(jsonPatchType, `[{"op":"replace","path":"/title","value":"Lose sanity"}]`)
+
+		if got, _ := dal.Get(context.Background(), testUser, item.Id); rec.Code != http.StatusOK || got.Title != "Lose sanity" || !bool(got.Complete) {
+			t.Errorf("want %v with the title changed, got %v %v", http.StatusOK, rec.Code, got)
+		}
+	})
+	t.Run("Failed patches", func(t *testing.T) {
+		tests := []struct {
+			name, contentType, body string
+			want                    int
+		}{
+			{"malformed", mergePatchType, `{"title":`, http.StatusBadRequest},
+			{"unsupported", "text/plain", `title`, http.StatusUnsupportedMediaType},
+			{"failed test", jsonPatchType, `[{"op":"test","path":"/title","value":"Keep sanity"}]`, http.StatusConflict},
+			{"missing path", jsonPatchType, `[{"op":"remove","path":"/nothing"}]`, http.StatusUnprocessableEntity},
+			{"invalid result", mergePatchType, `{"title":null}`, http.StatusUnprocessableEntity},
+		}
+		for _, test := range tests {
+			if rec := servePatch(test.contentType, test.body); rec.Code != test.want {
+				t.Errorf("%s: want %v, got %v", test.name, test.want, rec.Code)
+			}
+		}
+	})
+	t.Run("Other users' items", func(t *testing.T) {
+		rec := serveAPIAs(dal, "mallory", http.MethodPatch, target, `{"title":"Mine now"}`)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("want %v, got %v", http.StatusNotFound, rec.Code)
+		}
+	})
+}
+
+func TestLegacyEndpoints(t *testing.T) {
+	item := ConstructToDoItem("Keep sanity", "high", false)
+	item.Owner = testUser
+	body, _ := json.Marshal(item)
+	dal := NewEmptyDAL()
+
+	rec := serveAPI(dal, http.MethodPost, "/create", string(body))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("want %v, got %v", http.StatusOK, rec.Code)
+	}
+	if !equalSlicesNoOrder([]ToDoItem{item}, unstamped(readAll(t, dal.db))) {
+		t.Errorf("want %v, got %v", []ToDoItem{item}, readAll(t, dal.db))
+	}
+}
+
+func TestTraceIDHeader(t *testing.T) {
+	t.Run("Incoming TraceID is kept", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/todo", nil)
+		req.Header.Set(traceIDHeader, "abc-123")
+		rec := httptest.NewRecorder()
+
+		newAPIMux(NewEmptyDAL(), testAuth).ServeHTTP(rec, req)
+
+		if got := rec.Header().Get(traceIDHeader); got != "abc-123" {
+			t.Errorf("want %q, got %q", "abc-123", got)
+		}
+	})
+	t.Run("TraceID is generated", func(t *testing.T) {
+		rec := serveAPI(NewEmptyDAL(), http.MethodGet, "/v1/todo", "")
+
+		if rec.Header().Get(traceIDHeader) == "" {
+			t.Error("no TraceID returned")
+		}
+	})
+}
+
+// Fails every operation as if the disk had gone away
+type brokenDataStore struct {
+	inMemoryDataStore
+}
+
+func (d *brokenDataStore) read(ctx context.Context) ([]ToDoItem, error) {
+	return nil, &StorageError{"read", os.ErrPermission}
+}
+
+func (d *brokenDataStore) query(ctx context.Context, q Query) (Page, error) {
+	return Page{}, &StorageError{"query", os.ErrPermission}
+}
+
+func (d *brokenDataStore) create(ctx context.Context, item ToDoItem) error {
+	return &StorageError{"place", os.ErrPermission}
+}
+
+func TestStorageErrors(t *testing.T) {
+	db := brokenDataStore{newEmptyInMemoryDataStore()}
+	dal := NewDataAccessLayer(&db)
+	t.Run("Failed read", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodGet, "/v1/todo", "")
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("want %v, got %v", http.StatusInternalServerError, rec.Code)
+		}
+	})
+	t.Run("Failed write", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodPost, "/v1/todo", `{"title":"Keep sanity"}`)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("want %v, got %v", http.StatusInternalServerError, rec.Code)
+		}
+	})
+	t.Run("Legacy endpoint", func(t *testing.T) {
+		rec := serveAPI(dal, http.MethodPost, "/create", `{"title":"Keep sanity"}`)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("want %v, got %v", http.StatusInternalServerError, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Splits text into lower cased words, dropping punctuation
+func tokenise(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// The words an item is found by
+func searchTerms(item ToDoItem) []string {
+	return tokenise(string(item.Title))
+}
+
+// An inverted index from each word to the items it appears in. Not safe for
+// concurrent use, the stores that keep one guard it as they guard their data
+type searchIndex struct {
+	// How many times each word appears in each item
+	postings map[string]map[Id]int
+	// Every word in postings, sorted so words with a prefix sit together
+	words []string
+	// The words each item was indexed under, so it can be taken out again
+	terms map[Id][]string
+}
+
+func newSearchIndex(items map[Id]ToDoItem) *searchIndex {
+	index := &searchIndex{
+		postings: make(map[string]map[Id]int),
+		terms:    make(map[Id][]string),
+	}
+	for _, item := range items {
+		index.add(item)
+	}
+	return index
+}
+
+// Indexes `item`, replacing whatever it was indexed under before
+func (x *searchIndex) add(item ToDoItem) {
+	x.remove(item.Id)
+	terms := searchTerms(item)
+	for _, word := range terms {
+		posting, exists := x.postings[word]
+		if !exists {
+			posting = make(map[Id]int)
+			x.postings[word] = posting
+			i, _ := slices.BinarySearch(x.words, word)
+			x.words = slices.Insert(x.words, i, word)
+		}
+		posting[item.Id]++
+	}
+	x.terms[item.Id] = terms
+}
+
+func (x *searchIndex) remove(id Id) {
+	for _, word := range x.terms[id] {
+		posting := x.postings[word]
+		delete(posting, id)
+		if len(posting) == 0 {
+			delete(x.postings, word)
+			if i, found := slices.BinarySearch(x.words, word); found {
+				x.words = slices.Delete(x.words, i, i+1)
+			}
+		}
+	}
+	delete(x.terms, id)
+}
+
+// The ids of the items that have a word starting with each word of `text`,
+// most relevant first. A word scores more the more of it the search spelled
+// out and the more often it appears
+func (x *searchIndex) search(text string) []Id {
+	query := tokenise(text)
+	if len(query) == 0 {
+		return nil
+	}
+	var scores map[Id]float64
+	for _, prefix := range query {
+		matched := make(map[Id]float64)
+		start, _ := slices.BinarySearch(x.words, prefix)
+		for _, word := range x.words[start:] {
+			if !strings.HasPrefix(word, prefix) {
+				break
+			}
+			weight := float64(len(prefix)) / float64(len(word))
+			for id, count := range x.postings[word] {
+				matched[id] += weight * float64(count)
+			}
+		}
+		// Every word of the search must match
+		if scores != nil {
+			for id, score := range matched {
+				if previous, found := scores[id]; found {
+					matched[id] = score + previous
+				} else {
+					delete(matched, id)
+				}
+			}
+		}
+		scores = matched
+	}
+	var ids []Id
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b Id) int {
+		return cmp.Or(cmp.Compare(scores[b], scores[a]), cmp.Compare(a, b))
+	})
+	return ids
+}
+
+// Reads the items with each id, in order, skipping any that have gone
+func itemsWithIds(data map[Id]ToDoItem, ids []Id) []ToDoItem {
+	var items []ToDoItem
+	for _, id := range ids {
+		if item, exists := data[id]; exists {
+			items = append(items, item.clone())
+		}
+	}
+	return items
+}
+
+// Finds the items `user` can see in `list`, or in their personal list if it
+// is empty, that have a word starting with each word of `text`. The best
+// matches come first
+func (d DataAccessLayer) Search(ctx context.Context, user User, list ListId, text string) ([]ToDoItem, error) {
+	var found []ToDoItem
+	err := d.transact(ctx, true, func(ctx context.Context, db DataStore) error {
+		q, err := d.scope(ctx, user, Query{List: list})
+		if err != nil {
+			return err
+		}
+		items, err := d.db.search(ctx, text)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if q.matches(item) {
+				found = append(found, item)
+			}
+		}
+		return nil
+	})
+	return found, err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTokenise(t *testing.T) {
+	got := tokenise("Finish Go-Academy, then  REST!")
+
+	if want := []string{"finish", "go", "academy", "then", "rest"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	items := map[Id]ToDoItem{}
+	for id, title := range map[Id]Title{
+		"1": "Feed cats",
+		"2": "Feed the cat",
+		"3": "Catalogue the catacombs",
+		"4": "Walk dog",
+	} {
+		items[id] = ToDoItem{Id: id, Title: title}
+	}
+	index := newSearchIndex(items)
+	tests := []struct {
+		text string
+		want []Id
+	}{
+		{"CAT", []Id{"2", "1", "3"}},
+		{"feed cat", []Id{"2", "1"}},
+		{"feed dog", nil},
+		{"!!", nil},
+	}
+	for _, test := range tests {
+		if got := index.search(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: want %v, got %v", test.text, test.want, got)
+		}
+	}
+	t.Run("Changes are kept up to date", func(t *testing.T) {
+		index.add(ToDoItem{Id: "4", Title: "Walk cat"})
+		index.remove("1")
+
+		if got, want := index.search("cat"), []Id{"2", "4", "3"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, got %v", want, got)
+		}
+		if got := index.search("dog"); len(got) != 0 {
+			t.Errorf("want nothing for a word no longer used, got %v", got)
+		}
+		if len(index.words) != len(index.postings) {
+			t.Errorf("words and postings out of step, %v %v", index.words, index.postings)
+		}
+	})
+}
+
+func TestDALSearch(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	mine, _ := dal.Create(ctx, "alice", ConstructToDoItem("Feed cats", "high", false))
+	dal.Create(ctx, "bob", ConstructToDoItem("Feed cats", "high", false))
+	t.Run("Only the user's own items", func(t *testing.T) {
+		got, err := dal.Search(ctx, "alice", "", "feed")
+
+		if err != nil || len(got) != 1 || got[0].Id != mine.Id {
+			t.Errorf("want [%v], got %v %v", mine, got, err)
+		}
+	})
+	t.Run("Lists need a role", func(t *testing.T) {
+		list, _ := dal.CreateList(ctx, "alice", "Chores")
+
+		if _, err := dal.Search(ctx, "bob", list.Id, "feed"); err != ErrNoList {
+			t.Errorf("want %v, got %v", ErrNoList, err)
+		}
+	})
+}
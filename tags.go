@@ -0,0 +1,83 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Longest a tag can be, in characters
+const maxTagLength = 32
+
+// Matches tags ignoring case and surrounding space. Commas are not allowed as
+// they separate tags wherever several are typed in at once
+func (t Tag) normalise() (Tag, bool) {
+	tag := Tag(strings.ToLower(strings.TrimSpace(string(t))))
+	length := utf8.RuneCountInString(string(tag))
+	return tag, length > 0 && length <= maxTagLength && !strings.Contains(string(tag), ",")
+}
+
+// Normalises each tag, then sorts them and drops repeats. An empty set is nil
+func normaliseTags(tags []Tag) ([]Tag, bool) {
+	var normalised []Tag
+	for _, tag := range tags {
+		tag, ok := tag.normalise()
+		if !ok {
+			return tags, false
+		}
+		normalised = append(normalised, tag)
+	}
+	slices.Sort(normalised)
+	return slices.Compact(normalised), true
+}
+
+// Splits comma separated tags as typed into the CLI or website. Blank ones are
+// dropped
+func parseTags(text string) []Tag {
+	var tags []Tag
+	for _, tag := range strings.Split(text, ",") {
+		if strings.TrimSpace(tag) != "" {
+			tags = append(tags, Tag(tag))
+		}
+	}
+	return tags
+}
+
+func formatTags(tags []Tag) string {
+	var formatted []string
+	for _, tag := range tags {
+		formatted = append(formatted, "#"+string(tag))
+	}
+	return strings.Join(formatted, " ")
+}
+
+// How many items carry a tag
+type TagCount struct {
+	Tag   Tag `json:"tag"`
+	Count int `json:"count"`
+}
+
+// Counts the tags on the items `user` can see in `list`, or in their
+// personal list if it is empty. The most used tags come first
+func (d DataAccessLayer) TagCounts(ctx context.Context, user User, list ListId) ([]TagCount, error) {
+	page, err := d.Query(ctx, user, Query{List: list})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[Tag]int)
+	for _, item := range page.Items {
+		for _, tag := range item.Tags {
+			counts[tag]++
+		}
+	}
+	tagCounts := []TagCount{}
+	for tag, count := range counts {
+		tagCounts = append(tagCounts, TagCount{tag, count})
+	}
+	slices.SortFunc(tagCounts, func(a, b TagCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Tag, b.Tag))
+	})
+	return tagCounts, nil
+}
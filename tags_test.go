@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormaliseTags(t *testing.T) {
+	tests := []struct {
+		given []Tag
+		want  []Tag
+		ok    bool
+	}{
+		{[]Tag{" Urgent", "home", "urgent "}, []Tag{"home", "urgent"}, true},
+		{nil, nil, true},
+		{[]Tag{"home", " "}, nil, false},
+		{[]Tag{"a,b"}, nil, false},
+		{[]Tag{Tag(strings.Repeat("a", maxTagLength+1))}, nil, false},
+	}
+	for _, test := range tests {
+		got, ok := normaliseTags(test.given)
+
+		if ok != test.ok || ok && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: want %q %v, got %q %v", test.given, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	if got, want := parseTags(" home, ,urgent,"), []Tag{" home", "urgent"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestTags(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	for _, tags := range [][]Tag{{"home", "urgent"}, {"Home"}, {"work"}, nil} {
+		item := ConstructToDoItem("Keep sanity", "high", false)
+		item.Tags = tags
+		dal.Create(ctx, "alice", item)
+	}
+	t.Run("Invalid tags are refused", func(t *testing.T) {
+		item := ConstructToDoItem("Keep sanity", "high", false)
+		item.Tags = []Tag{"a,b"}
+
+		var invalid *ValidationError
+		if _, err := dal.Create(ctx, "alice", item); !errors.As(err, &invalid) || invalid.Fields["tags"] == "" {
+			t.Errorf("want a problem with tags, got %v", err)
+		}
+	})
+	t.Run("Any or all", func(t *testing.T) {
+		tests := []struct {
+			query Query
+			want  int
+		}{
+			{Query{Tags: []Tag{"home", "work"}}, 3},
+			{Query{Tags: []Tag{"HOME", "urgent"}, AllTags: true}, 1},
+			{Query{Tags: []Tag{"home", "work"}, AllTags: true}, 0},
+		}
+		for _, test := range tests {
+			got, err := dal.Query(ctx, "alice", test.query)
+
+			if err != nil || len(got.Items) != test.want {
+				t.Errorf("%v: want %d items, got %v %v", test.query.Tags, test.want, got.Items, err)
+			}
+		}
+	})
+	t.Run("Counts", func(t *testing.T) {
+		got, err := dal.TagCounts(ctx, "alice", "")
+
+		want := []TagCount{{"home", 2}, {"urgent", 1}, {"work", 1}}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, got %v %v", want, got, err)
+		}
+	})
+	t.Run("Items read out do not share tags with the store", func(t *testing.T) {
+		page, _ := dal.Query(ctx, "alice", Query{Tags: []Tag{"work"}})
+		page.Items[0].Tags[0] = "play"
+
+		if again, _ := dal.Query(ctx, "alice", Query{Tags: []Tag{"work"}}); len(again.Items) != 1 {
+			t.Errorf("store changed through an item read out, got %v", again.Items)
+		}
+	})
+}
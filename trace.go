@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+type TraceID string
+
+type traceIDKey struct{}
+
+const traceIDHeader = "X-Trace-Id"
+
+func WithTraceID(ctx context.Context, id TraceID) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// Returns an empty TraceID if none has been set on the context
+func TraceIDFromContext(ctx context.Context) TraceID {
+	id, _ := ctx.Value(traceIDKey{}).(TraceID)
+	return id
+}
+
+func NewTraceID() TraceID {
+	return TraceID(uuid.NewString())
+}
+
+// Wraps a slog.Handler so every record logged with a context carrying a
+// TraceID gets a "traceID" attribute
+type traceHandler struct {
+	slog.Handler
+}
+
+func newTraceHandler(h slog.Handler) traceHandler {
+	return traceHandler{h}
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := TraceIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("traceID", string(id)))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestTraceHandler(t *testing.T) {
+	t.Run("TraceID is logged", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(newTraceHandler(slog.NewTextHandler(&buf, nil)))
+		ctx := WithTraceID(context.Background(), "abc-123")
+
+		logger.With("layer", "test").InfoContext(ctx, "hello")
+
+		if !strings.Contains(buf.String(), "traceID=abc-123") {
+			t.Errorf("traceID missing from %q", buf.String())
+		}
+	})
+	t.Run("Nothing added without a TraceID", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(newTraceHandler(slog.NewTextHandler(&buf, nil)))
+
+		logger.InfoContext(context.Background(), "hello")
+
+		if strings.Contains(buf.String(), "traceID") {
+			t.Errorf("unexpected traceID in %q", buf.String())
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The priorities allowed by the v1 spec
+const (
+	PriorityLow    Priority = "Low"
+	PriorityMedium Priority = "Medium"
+	PriorityHigh   Priority = "High"
+)
+
+var priorities = []Priority{PriorityLow, PriorityMedium, PriorityHigh}
+
+// Given to items created without a Priority
+const defaultPriority = PriorityMedium
+
+// Returned when an item cannot be stored as it is. Fields maps each field's
+// JSON name to what is wrong with it
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	var problems []string
+	for _, field := range slices.Sorted(maps.Keys(e.Fields)) {
+		problems = append(problems, field+" "+e.Fields[field])
+	}
+	return "invalid todo: " + strings.Join(problems, ", ")
+}
+
+// Records a problem with `field`, creating `e` if needed so it can be used as
+// `err = err.add(...)`
+func (e *ValidationError) add(field string, problem string) *ValidationError {
+	if e == nil {
+		e = &ValidationError{}
+	}
+	if e.Fields == nil {
+		e.Fields = map[string]string{}
+	}
+	e.Fields[field] = problem
+	return e
+}
+
+// Matches `p` against the allowed priorities ignoring case and surrounding
+// space. The empty Priority becomes defaultPriority
+func (p Priority) normalise() (Priority, bool) {
+	trimmed := strings.TrimSpace(string(p))
+	if trimmed == "" {
+		return defaultPriority, true
+	}
+	for _, allowed := range priorities {
+		if strings.EqualFold(trimmed, string(allowed)) {
+			return allowed, true
+		}
+	}
+	return p, false
+}
+
+// Returns `item` with its Priority normalised and defaults applied, along with
+// a *ValidationError if it still cannot be stored. The item is returned
+// either way so callers can show the user what they entered
+func (item ToDoItem) validate() (ToDoItem, error) {
+	var problems *ValidationError
+	item.Title = Title(strings.TrimSpace(string(item.Title)))
+	if item.Title == "" {
+		problems = problems.add("title", "is required")
+	}
+	priority, ok := item.Priority.normalise()
+	if !ok {
+		problems = problems.add("priority", `must be "Low", "Medium" or "High"`)
+	}
+	item.Priority = priority
+	tags, ok := normaliseTags(item.Tags)
+	if !ok {
+		problems = problems.add("tags", fmt.Sprintf("must each be 1 to %d characters without commas", maxTagLength))
+	}
+	item.Tags = tags
+	item.Checklist, problems = validateChecklist(slices.Clone(item.Checklist), problems)
+	item.BlockedBy, problems = validateBlockedBy(item, problems)
+	if item.Due != nil {
+		// Due times are kept to the second, whatever the store
+		due := item.Due.Truncate(time.Second)
+		item.Due = &due
+	}
+	recurrence, err := item.Recurrence.normalise(item.Due)
+	if err != nil {
+		problems = problems.add("recurrence", err.Error())
+	} else if recurrence != "" && item.Due == nil {
+		problems = problems.add("recurrence", "needs a due date to count from")
+	}
+	item.Recurrence = recurrence
+	if problems != nil {
+		return item, problems
+	}
+	return item, nil
+}
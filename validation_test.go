@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPriorityNormalise(t *testing.T) {
+	tests := []struct {
+		given Priority
+		want  Priority
+		ok    bool
+	}{
+		{"High", PriorityHigh, true},
+		{"high", PriorityHigh, true},
+		{" LOW ", PriorityLow, true},
+		{"medium", PriorityMedium, true},
+		{"", defaultPriority, true},
+		{"pretty high", "pretty high", false},
+		{"thanks", "thanks", false},
+	}
+	for _, test := range tests {
+		got, ok := test.given.normalise()
+
+		if got != test.want || ok != test.ok {
+			t.Errorf("%q: want %q %v, got %q %v", test.given, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+func TestNewToDoItem(t *testing.T) {
+	t.Run("Valid item is normalised", func(t *testing.T) {
+		item, err := NewToDoItem(" Keep sanity ", "high", false)
+
+		if err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if item.Id == "" || item.Title != "Keep sanity" || item.Priority != PriorityHigh {
+			t.Errorf("item not normalised, got %v", item)
+		}
+	})
+	t.Run("Every problem is reported", func(t *testing.T) {
+		_, err := NewToDoItem("", "thing", false)
+
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) {
+			t.Fatalf("want a ValidationError, got %v", err)
+		}
+		if len(invalid.Fields) != 2 || invalid.Fields["title"] == "" || invalid.Fields["priority"] == "" {
+			t.Errorf("want title and priority problems, got %v", invalid.Fields)
+		}
+	})
+}
+
+func TestDALValidates(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	item, err := dal.Create(ctx, AnonymousUser, ConstructToDoItem("Keep sanity", "high", false))
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		invalid := ConstructToDoItem("", "high", false)
+
+		if _, err := dal.Create(ctx, AnonymousUser, invalid); !errors.As(err, new(*ValidationError)) {
+			t.Errorf("want a ValidationError, got %v", err)
+		}
+	})
+	t.Run("Update", func(t *testing.T) {
+		invalid := item
+		invalid.Priority = "pretty high"
+
+		if _, err := dal.Update(ctx, AnonymousUser, invalid); !errors.As(err, new(*ValidationError)) {
+			t.Errorf("want a ValidationError, got %v", err)
+		}
+		if got, _ := dal.Get(ctx, AnonymousUser, item.Id); !equalItems(got, item) {
+			t.Errorf("want %v, got %v", item, got)
+		}
+	})
+	t.Run("Priority is normalised", func(t *testing.T) {
+		lowered := item
+		lowered.Priority = "low"
+
+		if _, err := dal.Update(ctx, AnonymousUser, lowered); err != nil {
+			t.Fatalf("Unexpected error thrown! Got: %v", err)
+		}
+		if got, _ := dal.Get(ctx, AnonymousUser, item.Id); got.Priority != PriorityLow {
+			t.Errorf("want %v, got %v", PriorityLow, got.Priority)
+		}
+	})
+}
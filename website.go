@@ -1,17 +1,147 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"html/template"
+	"log/slog"
 	"net/http"
-	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
 )
 
-func ServeWebsite(dal DataAccessLayer) {
-	tmpl := template.Must(template.ParseFiles("submission_form.html"))
+const sessionCookie = "todo_session"
+
+// Everything submission_form.html is rendered with
+type websitePage struct {
+	User      User
+	LoggedIn  bool
+	Submitted bool
+	Success   bool
+	Message   string
+	// What was wrong with each field of a rejected item
+	Errors map[string]string
+	// The List being worked in, chosen with the list query or form value
+	List  ListId
+	Lists []List
+	// Only the items matching Search, or tagged Tag, are shown if either is
+	// given
+	Search string
+	Tag    Tag
+	Items  []ToDoItem
+}
+
+func newWebsitePage(r *http.Request) websitePage {
+	user, ok := UserFromContext(r.Context())
+	return websitePage{User: user, LoggedIn: ok, List: ListId(r.FormValue("list")),
+		Search: r.FormValue("q"), Tag: Tag(r.FormValue("tag"))}
+}
+
+// Browsers send datetime-local inputs without a timezone, so it comes in its
+// own field, the server's own by default. Returns nil if no due date is given
+func parseFormDue(value string, tz string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	location := time.Local
+	if tz != "" {
+		var err error
+		if location, err = time.LoadLocation(tz); err != nil {
+			return nil, new(ValidationError).add("tz", "must be an IANA timezone such as Europe/London")
+		}
+	}
+	due, err := time.ParseInLocation("2006-01-02T15:04", value, location)
+	if err != nil {
+		return nil, new(ValidationError).add("due", "must be a date and time")
+	}
+	return &due, nil
+}
+
+// Fills in the Lists the user can pick from and the items in the current one
+func (p *websitePage) load(ctx context.Context, dal DataAccessLayer) {
+	if !p.LoggedIn {
+		return
+	}
+	var err error
+	if p.Lists, err = dal.Lists(ctx, p.User); err != nil {
+		slog.ErrorContext(ctx, "could not read lists", "err", err)
+	}
+	if p.Search != "" {
+		p.Items, err = dal.Search(ctx, p.User, p.List, p.Search)
+	} else {
+		q := Query{List: p.List}
+		if p.Tag != "" {
+			q.Tags = []Tag{p.Tag}
+		}
+		var page Page
+		page, err = dal.Query(ctx, p.User, q)
+		p.Items = page.Items
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "could not read items", "err", err, "list", p.List)
+		p.Message = err.Error()
+	}
+}
+
+// Like withBearerAuth but the session token comes from a cookie, and
+// unauthenticated mutations are sent back to the log in form
+func withSessionCookie(auth *Auth, tmpl *template.Template, next http.Handler, public ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			if user, scope, ok := auth.Authenticate(r.Context(), cookie.Value); ok {
+				r = r.WithContext(WithUser(r.Context(), user, scope))
+			}
+		}
+		_, loggedIn := UserFromContext(r.Context())
+		canWrite := ScopeFromContext(r.Context()) == ScopeReadWrite
+		if !(loggedIn && canWrite) && isMutation(r.Method) && !slices.Contains(public, r.URL.Path) {
+			w.WriteHeader(http.StatusUnauthorized)
+			tmpl.Execute(w, websitePage{Message: "Log in first"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func setSessionCookie(w http.ResponseWriter, auth *Auth, r *http.Request, name User, password string) error {
+	token, expires, err := auth.Login(r.Context(), name, password)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func ServeWebsite(dal DataAccessLayer, auth *Auth, addr string, templateFile string) error {
+	handler, err := newWebsiteMux(dal, auth, templateFile)
+	if err != nil {
+		return err
+	}
+	return http.ListenAndServe(addr, handler)
+}
+
+func newWebsiteMux(dal DataAccessLayer, auth *Auth, templateFile string) (http.Handler, error) {
+	tmpl, err := template.ParseFiles(templateFile)
+	if err != nil {
+		return nil, err
+	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		page := newWebsitePage(r)
 		if r.Method != http.MethodPost {
-			tmpl.Execute(w, nil)
+			page.load(r.Context(), dal)
+			tmpl.Execute(w, page)
 			return
 		}
 
@@ -21,25 +151,108 @@ func ServeWebsite(dal DataAccessLayer) {
 		} else if r.FormValue("complete") == "false" {
 			completeness = false
 		} else {
-			fmt.Println("incorrect form value")
+			slog.WarnContext(r.Context(), "incorrect form value", "complete", r.FormValue("complete"))
 		}
 		todo := ToDoItem{
-			Id:       Id(r.FormValue("id")),
-			Title:    Title(r.FormValue("title")),
-			Priority: Priority(r.FormValue("priority")),
-			Complete: Complete(completeness),
+			Id:         Id(r.FormValue("id")),
+			Title:      Title(r.FormValue("title")),
+			Priority:   Priority(r.FormValue("priority")),
+			Complete:   Complete(completeness),
+			List:       page.List,
+			Tags:       parseTags(r.FormValue("tags")),
+			Recurrence: Recurrence(r.FormValue("recurrence")),
+		}
+		if todo.Id == "" {
+			todo.Id = Id(uuid.NewString())
 		}
 
-		err := dal.db.create(todo)
+		due, err := parseFormDue(r.FormValue("due"), r.FormValue("tz"))
+		if err == nil {
+			todo.Due = due
+			_, err = dal.Create(r.Context(), page.User, todo)
+		}
 
+		page.Submitted = true
+		var invalid *ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			page.Errors = invalid.Fields
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		case err != nil:
+			slog.ErrorContext(r.Context(), "could not create item", "err", err)
+			page.Message = err.Error()
+			w.WriteHeader(statusFromError(err))
+		default:
+			page.Success = true
+		}
+		page.load(r.Context(), dal)
+		tmpl.Execute(w, page)
+	})
+	mux.HandleFunc("POST /lists", func(w http.ResponseWriter, r *http.Request) {
+		page := newWebsitePage(r)
+		list, err := dal.CreateList(r.Context(), page.User, r.FormValue("name"))
 		if err != nil {
-			fmt.Printf("ERROR!: %q", err)
-			tmpl.Execute(w, struct{ Success bool }{false})
-		} else {
-			tmpl.Execute(w, struct{ Success bool }{true})
+			page.Message = err.Error()
+			page.load(r.Context(), dal)
+			w.WriteHeader(statusFromError(err))
+			tmpl.Execute(w, page)
+			return
 		}
-
+		http.Redirect(w, r, "/?list="+url.QueryEscape(string(list.Id)), http.StatusSeeOther)
+	})
+	// Checklist changes go back to the list they were made from
+	changeChecklist := func(w http.ResponseWriter, r *http.Request, change func(page websitePage, id Id) error) {
+		page := newWebsitePage(r)
+		if err := change(page, Id(r.FormValue("id"))); err != nil {
+			page.Message = err.Error()
+			page.load(r.Context(), dal)
+			w.WriteHeader(statusFromError(err))
+			tmpl.Execute(w, page)
+			return
+		}
+		http.Redirect(w, r, "/?list="+url.QueryEscape(string(page.List)), http.StatusSeeOther)
+	}
+	mux.HandleFunc("POST /checklist", func(w http.ResponseWriter, r *http.Request) {
+		changeChecklist(w, r, func(page websitePage, id Id) error {
+			_, err := dal.AddSubItem(r.Context(), page.User, id, 0, Title(r.FormValue("title")))
+			return err
+		})
+	})
+	mux.HandleFunc("POST /checklist/toggle", func(w http.ResponseWriter, r *http.Request) {
+		changeChecklist(w, r, func(page websitePage, id Id) error {
+			_, err := dal.ToggleSubItem(r.Context(), page.User, id, 0, Id(r.FormValue("sub")))
+			return err
+		})
+	})
+	mux.HandleFunc("POST /register", func(w http.ResponseWriter, r *http.Request) {
+		name, password := User(r.FormValue("name")), r.FormValue("password")
+		err := auth.Register(r.Context(), name, password)
+		if err == nil {
+			err = setSessionCookie(w, auth, r, name, password)
+		}
+		if err != nil {
+			w.WriteHeader(statusFromError(err))
+			tmpl.Execute(w, websitePage{Message: err.Error()})
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		err := setSessionCookie(w, auth, r, User(r.FormValue("name")), r.FormValue("password"))
+		if err != nil {
+			w.WriteHeader(statusFromError(err))
+			tmpl.Execute(w, websitePage{Message: err.Error()})
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+	mux.HandleFunc("POST /logout", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			auth.Logout(cookie.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 	})
 
-	http.ListenAndServe(":6060", nil)
+	return withTracing(withSessionCookie(auth, tmpl, mux, "/login", "/register")), nil
 }
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func serveWebsite(t *testing.T, handler http.Handler, target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebsiteSessions(t *testing.T) {
+	dal := NewEmptyDAL()
+	auth := newTestAuth()
+	auth.Register(context.Background(), "alice", "correct horse")
+	handler, err := newWebsiteMux(dal, auth, "submission_form.html")
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	todo := url.Values{"title": {"Keep sanity"}, "priority": {"High"}, "complete": {"false"}}
+
+	t.Run("Submitting needs a log in", func(t *testing.T) {
+		rec := serveWebsite(t, handler, "/", todo)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("want %v, got %v", http.StatusUnauthorized, rec.Code)
+		}
+	})
+	t.Run("Wrong password", func(t *testing.T) {
+		rec := serveWebsite(t, handler, "/login", url.Values{"name": {"alice"}, "password": {"battery staple"}})
+
+		if rec.Code != http.StatusUnauthorized || len(rec.Result().Cookies()) != 0 {
+			t.Errorf("want %v and no cookie, got %v %v", http.StatusUnauthorized, rec.Code, rec.Result().Cookies())
+		}
+	})
+	t.Run("Log in and submit", func(t *testing.T) {
+		rec := serveWebsite(t, handler, "/login", url.Values{"name": {"alice"}, "password": {"correct horse"}})
+		cookies := rec.Result().Cookies()
+		if rec.Code != http.StatusSeeOther || len(cookies) != 1 || !cookies[0].HttpOnly {
+			t.Fatalf("want %v and a session cookie, got %v %v", http.StatusSeeOther, rec.Code, cookies)
+		}
+
+		rec = serveWebsite(t, handler, "/", todo, cookies[0])
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("want %v, got %v", http.StatusOK, rec.Code)
+		}
+		items, _ := dal.Read(context.Background(), "alice", "")
+		if len(items) != 1 || items[0].Title != "Keep sanity" {
+			t.Errorf("item not created for alice, got %v", items)
+		}
+	})
+}
+
+func TestWebsiteLists(t *testing.T) {
+	dal := NewEmptyDAL()
+	auth := newTestAuth()
+	auth.Register(context.Background(), "alice", "correct horse")
+	handler, err := newWebsiteMux(dal, auth, "submission_form.html")
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	cookie := serveWebsite(t, handler, "/login", url.Values{"name": {"alice"}, "password": {"correct horse"}}).Result().Cookies()[0]
+
+	rec := serveWebsite(t, handler, "/lists", url.Values{"name": {"Groceries"}}, cookie)
+
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	list := ListId(location.Query().Get("list"))
+	if rec.Code != http.StatusSeeOther || list == "" {
+		t.Fatalf("want %v and a redirect to the new list, got %v %v", http.StatusSeeOther, rec.Code, location)
+	}
+	todo := url.Values{"title": {"Buy milk"}, "priority": {"High"}, "complete": {"false"}, "list": {string(list)}}
+	rec = serveWebsite(t, handler, "/", todo, cookie)
+
+	if !strings.Contains(rec.Body.String(), "Buy milk") {
+		t.Errorf("list's items not shown, got %s", rec.Body)
+	}
+	if items, _ := dal.Read(context.Background(), "alice", list); len(items) != 1 {
+		t.Errorf("item not created in the list, got %v", items)
+	}
+	if items, _ := dal.Read(context.Background(), "alice", ""); len(items) != 0 {
+		t.Errorf("item created in the personal list, got %v", items)
+	}
+}
+
+func TestWebsiteValidation(t *testing.T) {
+	auth := newTestAuth()
+	auth.Register(context.Background(), "alice", "correct horse")
+	handler, err := newWebsiteMux(NewEmptyDAL(), auth, "submission_form.html")
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	cookie := serveWebsite(t, handler, "/login", url.Values{"name": {"alice"}, "password": {"correct horse"}}).Result().Cookies()[0]
+
+	rec := serveWebsite(t, handler, "/", url.Values{"title": {""}, "priority": {"thing"}, "complete": {"false"}}, cookie)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want %v, got %v", http.StatusUnprocessableEntity, rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "title is required") || !strings.Contains(body, "priority must be") {
+		t.Errorf("field problems not shown, got %s", body)
+	}
+}
+
+func TestWebsiteFailures(t *testing.T) {
+	ctx := context.Background()
+	dal := NewEmptyDAL()
+	auth := newTestAuth()
+	auth.Register(ctx, "alice", "correct horse")
+	handler, err := newWebsiteMux(dal, auth, "submission_form.html")
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	cookie := serveWebsite(t, handler, "/login", url.Values{"name": {"alice"}, "password": {"correct horse"}}).Result().Cookies()[0]
+	todo := url.Values{"title": {"Keep sanity"}, "priority": {"High"}, "complete": {"false"}}
+
+	t.Run("Items without an id get one", func(t *testing.T) {
+		for range 2 {
+			if rec := serveWebsite(t, handler, "/", todo, cookie); rec.Code != http.StatusOK {
+				t.Errorf("want %v, got %v", http.StatusOK, rec.Code)
+			}
+		}
+		if items, _ := dal.Read(ctx, "alice", ""); len(items) != 2 || items[0].Id == "" || items[1].Id == "" {
+			t.Errorf("want two items with ids, got %v", items)
+		}
+	})
+	t.Run("Other failures get their status", func(t *testing.T) {
+		list, _ := dal.CreateList(ctx, "bob", "Bob's")
+		dal.ShareList(ctx, "bob", list.Id, "alice", RoleViewer)
+		taken, _ := dal.Read(ctx, "alice", "")
+		cases := []struct {
+			form url.Values
+			want int
+		}{
+			{url.Values{"title": {"Keep sanity"}, "priority": {"High"}, "list": {string(list.Id)}}, http.StatusForbidden},
+			{url.Values{"title": {"Keep sanity"}, "priority": {"High"}, "id": {string(taken[0].Id)}}, http.StatusConflict},
+		}
+		for _, c := range cases {
+			rec := serveWebsite(t, handler, "/", c.form, cookie)
+
+			if rec.Code != c.want {
+				t.Errorf("%v: want %v, got %v", c.form, c.want, rec.Code)
+			}
+		}
+	})
+}
+
+func TestWebsiteDueDates(t *testing.T) {
+	dal := NewEmptyDAL()
+	auth := newTestAuth()
+	auth.Register(context.Background(), "alice", "correct horse")
+	handler, err := newWebsiteMux(dal, auth, "submission_form.html")
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	cookie := serveWebsite(t, handler, "/login", url.Values{"name": {"alice"}, "password": {"correct horse"}}).Result().Cookies()[0]
+	todo := url.Values{"title": {"Keep sanity"}, "priority": {"High"}, "complete": {"false"}, "due": {"2024-01-31T17:00"}, "tz": {"UTC"}}
+
+	rec := serveWebsite(t, handler, "/", todo, cookie)
+
+	if !strings.Contains(rec.Body.String(), "due 2024-01-31 17:00 UTC") {
+		t.Errorf("due date not shown, got %s", rec.Body)
+	}
+	todo.Set("tz", "Nowhere/Special")
+	if rec = serveWebsite(t, handler, "/", todo, cookie); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want %v, got %v", http.StatusUnprocessableEntity, rec.Code)
+	}
+}
+
+func TestWebsiteSearch(t *testing.T) {
+	dal := NewEmptyDAL()
+	auth := newTestAuth()
+	auth.Register(context.Background(), "alice", "correct horse")
+	handler, err := newWebsiteMux(dal, auth, "submission_form.html")
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	cookie := serveWebsite(t, handler, "/login", url.Values{"name": {"alice"}, "password": {"correct horse"}}).Result().Cookies()[0]
+	dal.Create(context.Background(), "alice", ConstructToDoItem("Buy milk", "high", false))
+	dal.Create(context.Background(), "alice", ConstructToDoItem("Sell car", "high", false))
+
+	req := httptest.NewRequest(http.MethodGet, "/?q=mil", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if body := rec.Body.String(); !strings.Contains(body, "Buy milk") || strings.Contains(body, "Sell car") || !strings.Contains(body, `value="mil"`) {
+		t.Errorf("want only the match and the search kept, got %s", body)
+	}
+}
+
+func TestWebsiteTags(t *testing.T) {
+	dal := NewEmptyDAL()
+	auth := newTestAuth()
+	auth.Register(context.Background(), "alice", "correct horse")
+	handler, err := newWebsiteMux(dal, auth, "submission_form.html")
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	cookie := serveWebsite(t, handler, "/login", url.Values{"name": {"alice"}, "password": {"correct horse"}}).Result().Cookies()[0]
+	serveWebsite(t, handler, "/", url.Values{"title": {"Buy milk"}, "priority": {"High"}, "complete": {"false"}, "tags": {"Home, errands"}}, cookie)
+	serveWebsite(t, handler, "/", url.Values{"title": {"Sell car"}, "priority": {"High"}, "complete": {"false"}}, cookie)
+
+	req := httptest.NewRequest(http.MethodGet, "/?tag=home", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "Buy milk") || strings.Contains(body, "Sell car") {
+		t.Errorf("want only the tagged item, got %s", body)
+	}
+	if !strings.Contains(body, `href="/?list=&tag=errands">#errands</a>`) {
+		t.Errorf("want a chip for each tag, got %s", body)
+	}
+}
+
+func TestWebsiteChecklist(t *testing.T) {
+	dal := NewEmptyDAL()
+	auth := newTestAuth()
+	auth.Register(context.Background(), "alice", "correct horse")
+	handler, err := newWebsiteMux(dal, auth, "submission_form.html")
+	if err != nil {
+		t.Fatalf("setup failed! -> %v", err)
+	}
+	cookie := serveWebsite(t, handler, "/login", url.Values{"name": {"alice"}, "password": {"correct horse"}}).Result().Cookies()[0]
+	item, _ := dal.Create(context.Background(), "alice", ConstructToDoItem("Finish go academy", "high", false))
+
+	rec := serveWebsite(t, handler, "/checklist", url.Values{"id": {string(item.Id)}, "title": {"Read the book"}}, cookie)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("want %v, got %v %s", http.StatusSeeOther, rec.Code, rec.Body)
+	}
+	item, _ = dal.Get(context.Background(), "alice", item.Id)
+	if len(item.Checklist) != 1 {
+		t.Fatalf("step not added, got %v", item.Checklist)
+	}
+	rec = serveWebsite(t, handler, "/checklist/toggle", url.Values{"id": {string(item.Id)}, "sub": {string(item.Checklist[0].Id)}}, cookie)
+
+	if item, _ = dal.Get(context.Background(), "alice", item.Id); rec.Code != http.StatusSeeOther || !bool(item.Checklist[0].Complete) {
+		t.Errorf("want %v and the step complete, got %v %v", http.StatusSeeOther, rec.Code, item.Checklist)
+	}
+	if rec = serveWebsite(t, handler, "/checklist/toggle", url.Values{"id": {string(item.Id)}, "sub": {"nope"}}, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("want %v, got %v", http.StatusNotFound, rec.Code)
+	}
+}